@@ -0,0 +1,200 @@
+package activity
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cykj40/beginner_go/internal/exercises"
+)
+
+const (
+	FormatGPX = "gpx"
+	FormatTCX = "tcx"
+	FormatFIT = "fit"
+
+	// used for calorie estimates when the caller has no body weight
+	defaultBodyWeightKg = 70.0
+	earthRadiusMeters   = 6371000.0
+	// climbs smaller than this are treated as GPS/barometer noise
+	elevationNoiseMeters = 1.0
+)
+
+var ErrUnknownFormat = errors.New("unknown activity file format, expected gpx, tcx or fit")
+
+type Point struct {
+	Time           time.Time
+	Lat            *float64
+	Lon            *float64
+	ElevationM     *float64
+	HeartRate      *int
+	DistanceMeters *float64
+}
+
+type Track struct {
+	Format   string
+	Name     string
+	Sport    string
+	Calories *int
+	Points   []Point
+}
+
+type Summary struct {
+	StartedAt           time.Time `json:"started_at"`
+	EndedAt             time.Time `json:"ended_at"`
+	DurationSeconds     int       `json:"duration_seconds"`
+	DistanceMeters      float64   `json:"distance_meters"`
+	ElevationGainMeters float64   `json:"elevation_gain_meters"`
+	AvgHeartRate        *int      `json:"avg_heart_rate"`
+	MaxHeartRate        *int      `json:"max_heart_rate"`
+	Calories            int       `json:"calories"`
+	CaloriesEstimated   bool      `json:"calories_estimated"`
+}
+
+// DetectFormat guesses the file format from its name, falling back to
+// sniffing the content
+func DetectFormat(filename string, data []byte) string {
+	switch strings.ToLower(strings.TrimPrefix(filepath.Ext(filename), ".")) {
+	case FormatGPX:
+		return FormatGPX
+	case FormatTCX:
+		return FormatTCX
+	case FormatFIT:
+		return FormatFIT
+	}
+
+	if len(data) >= 12 && string(data[8:12]) == ".FIT" {
+		return FormatFIT
+	}
+	head := data
+	if len(head) > 512 {
+		head = head[:512]
+	}
+	switch {
+	case bytes.Contains(head, []byte("<gpx")):
+		return FormatGPX
+	case bytes.Contains(head, []byte("<TrainingCenterDatabase")):
+		return FormatTCX
+	}
+	return ""
+}
+
+func Parse(format string, data []byte) (*Track, error) {
+	var track *Track
+	var err error
+
+	switch format {
+	case FormatGPX:
+		track, err = parseGPX(data)
+	case FormatTCX:
+		track, err = parseTCX(data)
+	case FormatFIT:
+		track, err = parseFIT(data)
+	default:
+		return nil, ErrUnknownFormat
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", format, err)
+	}
+
+	track.Format = format
+	if len(track.Points) == 0 {
+		return nil, fmt.Errorf("parsing %s: no timestamped track points found", format)
+	}
+	return track, nil
+}
+
+// Summarize derives the workout totals from the track. bodyWeightKg is only
+// used to estimate calories when the file does not report them; pass 0 to
+// use a default.
+func (t *Track) Summarize(bodyWeightKg float64) Summary {
+	var s Summary
+	if len(t.Points) == 0 {
+		return s
+	}
+
+	s.StartedAt = t.Points[0].Time
+	s.EndedAt = t.Points[len(t.Points)-1].Time
+	s.DurationSeconds = int(s.EndedAt.Sub(s.StartedAt).Seconds())
+
+	var recordedDistance, computedDistance float64
+	var prev *Point
+	var hrSum, hrCount, hrMax int
+	var elevAnchor *float64
+
+	for i := range t.Points {
+		p := &t.Points[i]
+
+		if p.DistanceMeters != nil && *p.DistanceMeters > recordedDistance {
+			recordedDistance = *p.DistanceMeters
+		}
+		if prev != nil && hasPosition(prev) && hasPosition(p) {
+			computedDistance += haversine(*prev.Lat, *prev.Lon, *p.Lat, *p.Lon)
+		}
+
+		if p.HeartRate != nil && *p.HeartRate > 0 {
+			hrSum += *p.HeartRate
+			hrCount++
+			hrMax = max(hrMax, *p.HeartRate)
+		}
+
+		if p.ElevationM != nil {
+			switch {
+			case elevAnchor == nil:
+				elevAnchor = p.ElevationM
+			case *p.ElevationM-*elevAnchor >= elevationNoiseMeters:
+				s.ElevationGainMeters += *p.ElevationM - *elevAnchor
+				elevAnchor = p.ElevationM
+			case *p.ElevationM < *elevAnchor:
+				elevAnchor = p.ElevationM
+			}
+		}
+
+		prev = p
+	}
+
+	// devices that record cumulative distance are more accurate than
+	// re-deriving it from positions
+	s.DistanceMeters = computedDistance
+	if recordedDistance > 0 {
+		s.DistanceMeters = recordedDistance
+	}
+	s.DistanceMeters = math.Round(s.DistanceMeters*10) / 10
+	s.ElevationGainMeters = math.Round(s.ElevationGainMeters*10) / 10
+
+	if hrCount > 0 {
+		avg := int(math.Round(float64(hrSum) / float64(hrCount)))
+		s.AvgHeartRate = &avg
+		s.MaxHeartRate = &hrMax
+	}
+
+	if t.Calories != nil && *t.Calories > 0 {
+		s.Calories = *t.Calories
+	} else {
+		if bodyWeightKg <= 0 {
+			bodyWeightKg = defaultBodyWeightKg
+		}
+		hours := float64(s.DurationSeconds) / 3600
+		s.Calories = int(math.Round(exercises.MET(t.Sport, "distance") * bodyWeightKg * hours))
+		s.CaloriesEstimated = true
+	}
+
+	return s
+}
+
+func hasPosition(p *Point) bool {
+	return p.Lat != nil && p.Lon != nil
+}
+
+func haversine(lat1, lon1, lat2, lon2 float64) float64 {
+	toRad := func(d float64) float64 { return d * math.Pi / 180 }
+	dLat := toRad(lat2 - lat1)
+	dLon := toRad(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusMeters * math.Asin(math.Sqrt(a))
+}
@@ -0,0 +1,156 @@
+package activity
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const sampleGPX = `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" creator="test" xmlns="http://www.topografix.com/GPX/1/1"
+  xmlns:gpxtpx="http://www.garmin.com/xmlschemas/TrackPointExtension/v1">
+  <metadata><name>Morning Run</name></metadata>
+  <trk>
+    <type>running</type>
+    <trkseg>
+      <trkpt lat="40.0000" lon="-74.0000"><ele>10</ele><time>2025-03-01T10:00:00Z</time>
+        <extensions><gpxtpx:TrackPointExtension><gpxtpx:hr>120</gpxtpx:hr></gpxtpx:TrackPointExtension></extensions></trkpt>
+      <trkpt lat="40.0090" lon="-74.0000"><ele>15</ele><time>2025-03-01T10:05:00Z</time>
+        <extensions><gpxtpx:TrackPointExtension><gpxtpx:hr>150</gpxtpx:hr></gpxtpx:TrackPointExtension></extensions></trkpt>
+      <trkpt lat="40.0180" lon="-74.0000"><ele>12</ele><time>2025-03-01T10:10:00Z</time>
+        <extensions><gpxtpx:TrackPointExtension><gpxtpx:hr>160</gpxtpx:hr></gpxtpx:TrackPointExtension></extensions></trkpt>
+    </trkseg>
+  </trk>
+</gpx>`
+
+const sampleTCX = `<?xml version="1.0" encoding="UTF-8"?>
+<TrainingCenterDatabase xmlns="http://www.garmin.com/xmlschemas/TrainingCenterDatabase/v2">
+  <Activities>
+    <Activity Sport="Biking">
+      <Id>2025-03-02T08:00:00Z</Id>
+      <Lap StartTime="2025-03-02T08:00:00Z">
+        <Calories>420</Calories>
+        <Track>
+          <Trackpoint><Time>2025-03-02T08:00:00Z</Time><AltitudeMeters>100</AltitudeMeters><DistanceMeters>0</DistanceMeters><HeartRateBpm><Value>110</Value></HeartRateBpm></Trackpoint>
+          <Trackpoint><Time>2025-03-02T08:30:00Z</Time><AltitudeMeters>130</AltitudeMeters><DistanceMeters>12000</DistanceMeters><HeartRateBpm><Value>140</Value></HeartRateBpm></Trackpoint>
+          <Trackpoint><Time>2025-03-02T09:00:00Z</Time><AltitudeMeters>120</AltitudeMeters><DistanceMeters>24500</DistanceMeters><HeartRateBpm><Value>150</Value></HeartRateBpm></Trackpoint>
+        </Track>
+      </Lap>
+    </Activity>
+  </Activities>
+</TrainingCenterDatabase>`
+
+func TestParseGPX(t *testing.T) {
+	data := []byte(sampleGPX)
+	require.Equal(t, FormatGPX, DetectFormat("run.xml", data))
+
+	track, err := Parse(FormatGPX, data)
+	require.NoError(t, err)
+	assert.Equal(t, "Morning Run", track.Name)
+	assert.Equal(t, "running", track.Sport)
+
+	s := track.Summarize(80)
+	assert.Equal(t, 600, s.DurationSeconds)
+	assert.InDelta(t, 2001, s.DistanceMeters, 5)
+	assert.Equal(t, 5.0, s.ElevationGainMeters)
+	assert.Equal(t, 143, *s.AvgHeartRate)
+	assert.Equal(t, 160, *s.MaxHeartRate)
+	assert.True(t, s.CaloriesEstimated)
+	assert.Equal(t, 131, s.Calories)
+}
+
+func TestParseTCX(t *testing.T) {
+	track, err := Parse(DetectFormat("ride.tcx", nil), []byte(sampleTCX))
+	require.NoError(t, err)
+	assert.Equal(t, "Biking", track.Sport)
+
+	s := track.Summarize(0)
+	assert.Equal(t, 3600, s.DurationSeconds)
+	assert.Equal(t, 24500.0, s.DistanceMeters)
+	assert.Equal(t, 30.0, s.ElevationGainMeters)
+	assert.Equal(t, 420, s.Calories)
+	assert.False(t, s.CaloriesEstimated)
+}
+
+func TestParseFIT(t *testing.T) {
+	start := time.Date(2025, 3, 3, 7, 0, 0, 0, time.UTC)
+	data := buildFIT(start)
+	require.Equal(t, FormatFIT, DetectFormat("", data))
+
+	track, err := Parse(FormatFIT, data)
+	require.NoError(t, err)
+	assert.Equal(t, "running", track.Sport)
+	require.Len(t, track.Points, 3)
+	assert.Equal(t, start.Add(20*time.Second), track.Points[2].Time)
+	assert.InDelta(t, 40.0, *track.Points[0].Lat, 1e-6)
+
+	s := track.Summarize(0)
+	assert.Equal(t, 20, s.DurationSeconds)
+	assert.Equal(t, 80.0, s.DistanceMeters)
+	assert.Equal(t, 4.0, s.ElevationGainMeters)
+	assert.Equal(t, 155, *s.MaxHeartRate)
+	assert.Equal(t, 25, s.Calories)
+
+	data[len(data)-3] ^= 0xFF
+	_, err = Parse(FormatFIT, data)
+	assert.Error(t, err)
+}
+
+// buildFIT encodes a minimal activity: three records, the last one using a
+// compressed timestamp header, followed by a session message
+func buildFIT(start time.Time) []byte {
+	le := binary.LittleEndian
+	var body bytes.Buffer
+	ts := uint32(start.Unix() - fitEpochOffset)
+	semicircles := func(deg float64) uint32 { return uint32(int32(deg / semicircleDeg)) }
+
+	// definition, local 0 -> record
+	body.Write([]byte{0x40, 0, 0})
+	body.Write(le.AppendUint16(nil, fitMesgRecord))
+	body.Write([]byte{6,
+		fitFieldTimestamp, 4, 0x86,
+		fitRecordLat, 4, 0x85,
+		fitRecordLon, 4, 0x85,
+		fitRecordAltitude, 2, 0x84,
+		fitRecordHeartRate, 1, 0x02,
+		fitRecordDistance, 4, 0x86,
+	})
+	for i, alt := range []uint16{2550, 2570} {
+		body.WriteByte(0x00)
+		body.Write(le.AppendUint32(nil, ts+uint32(i*10)))
+		body.Write(le.AppendUint32(nil, semicircles(40)))
+		body.Write(le.AppendUint32(nil, semicircles(-74)))
+		body.Write(le.AppendUint16(nil, alt))
+		body.WriteByte(byte(140 + i*10))
+		body.Write(le.AppendUint32(nil, uint32(i*4000)))
+	}
+
+	// definition, local 1 -> record without a timestamp field
+	body.Write([]byte{0x41, 0, 0})
+	body.Write(le.AppendUint16(nil, fitMesgRecord))
+	body.Write([]byte{2, fitRecordHeartRate, 1, 0x02, fitRecordDistance, 4, 0x86})
+	offset := byte((ts + 20) & 0x1F)
+	body.WriteByte(0x80 | 1<<5 | offset)
+	body.WriteByte(155)
+	body.Write(le.AppendUint32(nil, 8000))
+
+	// definition, local 2 -> session
+	body.Write([]byte{0x42, 0, 0})
+	body.Write(le.AppendUint16(nil, fitMesgSession))
+	body.Write([]byte{2, fitSessionSport, 1, 0x00, fitSessionTotalCalories, 2, 0x84})
+	body.WriteByte(0x02)
+	body.WriteByte(1)
+	body.Write(le.AppendUint16(nil, 25))
+
+	header := []byte{12, 0x10}
+	header = le.AppendUint16(header, 2100)
+	header = le.AppendUint32(header, uint32(body.Len()))
+	header = append(header, ".FIT"...)
+
+	file := append(header, body.Bytes()...)
+	return le.AppendUint16(file, fitCRC(file))
+}
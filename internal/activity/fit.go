@@ -0,0 +1,263 @@
+package activity
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	fitMesgSession = 18
+	fitMesgRecord  = 20
+
+	fitFieldTimestamp = 253
+
+	fitRecordLat              = 0
+	fitRecordLon              = 1
+	fitRecordAltitude         = 2
+	fitRecordHeartRate        = 3
+	fitRecordDistance         = 5
+	fitRecordEnhancedAltitude = 78
+
+	fitSessionSport         = 5
+	fitSessionTotalCalories = 11
+
+	// seconds between the unix epoch and the FIT epoch, 1989-12-31T00:00:00Z
+	fitEpochOffset = 631065600
+	semicircleDeg  = 180.0 / (1 << 31)
+)
+
+var fitSports = map[uint64]string{
+	1:  "running",
+	2:  "cycling",
+	5:  "swimming",
+	11: "walking",
+	15: "rowing",
+	17: "hiking",
+}
+
+type fitFieldDef struct {
+	num  byte
+	size int
+}
+
+type fitDefinition struct {
+	globalNum uint16
+	order     binary.ByteOrder
+	fields    []fitFieldDef
+	devSize   int
+}
+
+// parseFIT decodes the record and session messages of a FIT file. Only the
+// fields needed for a workout summary are interpreted; everything else is
+// skipped using the sizes from the definition messages.
+func parseFIT(data []byte) (*Track, error) {
+	if len(data) < 12 {
+		return nil, errors.New("file too short")
+	}
+	headerSize := int(data[0])
+	if headerSize < 12 || len(data) < headerSize || string(data[8:12]) != ".FIT" {
+		return nil, errors.New("missing .FIT signature")
+	}
+	dataSize := int(binary.LittleEndian.Uint32(data[4:8]))
+	end := headerSize + dataSize
+	if len(data) < end {
+		return nil, errors.New("truncated file")
+	}
+	if len(data) >= end+2 {
+		want := binary.LittleEndian.Uint16(data[end : end+2])
+		if want != 0 && fitCRC(data[:end]) != want {
+			return nil, errors.New("checksum mismatch")
+		}
+	}
+
+	track := &Track{}
+	defs := map[byte]*fitDefinition{}
+	var lastTimestamp uint32
+	pos := headerSize
+
+	for pos < end {
+		header := data[pos]
+		pos++
+
+		var local byte
+		compressedOffset := -1
+		switch {
+		case header&0x80 != 0:
+			local = (header >> 5) & 0x03
+			compressedOffset = int(header & 0x1F)
+		case header&0x40 != 0:
+			def, n, err := readFITDefinition(data[pos:end], header&0x20 != 0)
+			if err != nil {
+				return nil, err
+			}
+			defs[header&0x0F] = def
+			pos += n
+			continue
+		default:
+			local = header & 0x0F
+		}
+
+		def, ok := defs[local]
+		if !ok {
+			return nil, fmt.Errorf("data message for undefined local type %d", local)
+		}
+
+		values := map[byte]uint64{}
+		for _, field := range def.fields {
+			if pos+field.size > end {
+				return nil, errors.New("truncated data message")
+			}
+			if v, ok := readFITValue(data[pos:pos+field.size], def.order); ok {
+				values[field.num] = v
+			}
+			pos += field.size
+		}
+		pos += def.devSize
+		if pos > end {
+			return nil, errors.New("truncated data message")
+		}
+
+		if ts, ok := values[fitFieldTimestamp]; ok {
+			lastTimestamp = uint32(ts)
+		} else if compressedOffset >= 0 {
+			ts := lastTimestamp&^0x1F | uint32(compressedOffset)
+			if uint32(compressedOffset) < lastTimestamp&0x1F {
+				ts += 0x20
+			}
+			lastTimestamp = ts
+			values[fitFieldTimestamp] = uint64(ts)
+		}
+
+		switch def.globalNum {
+		case fitMesgRecord:
+			if p, ok := fitRecordPoint(values); ok {
+				track.Points = append(track.Points, p)
+			}
+		case fitMesgSession:
+			if sport, ok := values[fitSessionSport]; ok && track.Sport == "" {
+				track.Sport = fitSports[sport]
+			}
+			if calories, ok := values[fitSessionTotalCalories]; ok {
+				c := int(calories)
+				if track.Calories != nil {
+					c += *track.Calories
+				}
+				track.Calories = &c
+			}
+		}
+	}
+
+	return track, nil
+}
+
+func readFITDefinition(data []byte, hasDevFields bool) (*fitDefinition, int, error) {
+	if len(data) < 5 {
+		return nil, 0, errors.New("truncated definition message")
+	}
+	def := &fitDefinition{order: binary.LittleEndian}
+	if data[1] == 1 {
+		def.order = binary.BigEndian
+	}
+	def.globalNum = def.order.Uint16(data[2:4])
+	count := int(data[4])
+	n := 5
+
+	if len(data) < n+count*3 {
+		return nil, 0, errors.New("truncated definition message")
+	}
+	for i := 0; i < count; i++ {
+		def.fields = append(def.fields, fitFieldDef{num: data[n], size: int(data[n+1])})
+		n += 3
+	}
+
+	if hasDevFields {
+		if len(data) < n+1 {
+			return nil, 0, errors.New("truncated definition message")
+		}
+		devCount := int(data[n])
+		n++
+		if len(data) < n+devCount*3 {
+			return nil, 0, errors.New("truncated definition message")
+		}
+		for i := 0; i < devCount; i++ {
+			def.devSize += int(data[n+1])
+			n += 3
+		}
+	}
+
+	return def, n, nil
+}
+
+// readFITValue reads an unsigned integer field, reporting false for the
+// all-ones "invalid" marker and for sizes this parser does not interpret
+func readFITValue(b []byte, order binary.ByteOrder) (uint64, bool) {
+	switch len(b) {
+	case 1:
+		return uint64(b[0]), b[0] != 0xFF
+	case 2:
+		v := order.Uint16(b)
+		return uint64(v), v != 0xFFFF
+	case 4:
+		v := order.Uint32(b)
+		return uint64(v), v != 0xFFFFFFFF && v != 0x7FFFFFFF
+	}
+	return 0, false
+}
+
+func fitRecordPoint(values map[byte]uint64) (Point, bool) {
+	ts, ok := values[fitFieldTimestamp]
+	if !ok {
+		return Point{}, false
+	}
+	p := Point{Time: time.Unix(int64(ts)+fitEpochOffset, 0).UTC()}
+
+	lat, hasLat := values[fitRecordLat]
+	lon, hasLon := values[fitRecordLon]
+	if hasLat && hasLon {
+		latDeg := float64(int32(uint32(lat))) * semicircleDeg
+		lonDeg := float64(int32(uint32(lon))) * semicircleDeg
+		p.Lat = &latDeg
+		p.Lon = &lonDeg
+	}
+
+	if alt, ok := values[fitRecordEnhancedAltitude]; ok {
+		meters := float64(alt)/5 - 500
+		p.ElevationM = &meters
+	} else if alt, ok := values[fitRecordAltitude]; ok {
+		meters := float64(alt)/5 - 500
+		p.ElevationM = &meters
+	}
+
+	if hr, ok := values[fitRecordHeartRate]; ok {
+		bpm := int(hr)
+		p.HeartRate = &bpm
+	}
+
+	if dist, ok := values[fitRecordDistance]; ok {
+		meters := float64(dist) / 100
+		p.DistanceMeters = &meters
+	}
+
+	return p, true
+}
+
+var fitCRCTable = [16]uint16{
+	0x0000, 0xCC01, 0xD801, 0x1400, 0xF001, 0x3C00, 0x2800, 0xE401,
+	0xA001, 0x6C00, 0x7800, 0xB401, 0x5000, 0x9C01, 0x8801, 0x4400,
+}
+
+func fitCRC(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		tmp := fitCRCTable[crc&0xF]
+		crc = (crc >> 4) & 0x0FFF
+		crc = crc ^ tmp ^ fitCRCTable[b&0xF]
+
+		tmp = fitCRCTable[crc&0xF]
+		crc = (crc >> 4) & 0x0FFF
+		crc = crc ^ tmp ^ fitCRCTable[(b>>4)&0xF]
+	}
+	return crc
+}
@@ -0,0 +1,66 @@
+package activity
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+type gpxFile struct {
+	Name   string     `xml:"metadata>name"`
+	Tracks []gpxTrack `xml:"trk"`
+}
+
+type gpxTrack struct {
+	Name     string       `xml:"name"`
+	Type     string       `xml:"type"`
+	Segments []gpxSegment `xml:"trkseg"`
+}
+
+type gpxSegment struct {
+	Points []gpxPoint `xml:"trkpt"`
+}
+
+type gpxPoint struct {
+	Lat       float64  `xml:"lat,attr"`
+	Lon       float64  `xml:"lon,attr"`
+	Elevation *float64 `xml:"ele"`
+	Time      string   `xml:"time"`
+	HeartRate *int     `xml:"extensions>TrackPointExtension>hr"`
+}
+
+func parseGPX(data []byte) (*Track, error) {
+	var doc gpxFile
+	err := xml.Unmarshal(data, &doc)
+	if err != nil {
+		return nil, err
+	}
+
+	track := &Track{Name: doc.Name}
+	for _, trk := range doc.Tracks {
+		if track.Name == "" {
+			track.Name = trk.Name
+		}
+		if track.Sport == "" {
+			track.Sport = trk.Type
+		}
+		for _, seg := range trk.Segments {
+			for _, pt := range seg.Points {
+				t, err := time.Parse(time.RFC3339, pt.Time)
+				if err != nil {
+					// points without a timestamp cannot contribute to duration
+					continue
+				}
+				lat, lon := pt.Lat, pt.Lon
+				track.Points = append(track.Points, Point{
+					Time:       t,
+					Lat:        &lat,
+					Lon:        &lon,
+					ElevationM: pt.Elevation,
+					HeartRate:  pt.HeartRate,
+				})
+			}
+		}
+	}
+
+	return track, nil
+}
@@ -0,0 +1,70 @@
+package activity
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+type tcxFile struct {
+	Activities []tcxActivity `xml:"Activities>Activity"`
+}
+
+type tcxActivity struct {
+	Sport string   `xml:"Sport,attr"`
+	ID    string   `xml:"Id"`
+	Laps  []tcxLap `xml:"Lap"`
+}
+
+type tcxLap struct {
+	Calories *int         `xml:"Calories"`
+	Points   []tcxTrackpt `xml:"Track>Trackpoint"`
+}
+
+type tcxTrackpt struct {
+	Time      string   `xml:"Time"`
+	Lat       *float64 `xml:"Position>LatitudeDegrees"`
+	Lon       *float64 `xml:"Position>LongitudeDegrees"`
+	Altitude  *float64 `xml:"AltitudeMeters"`
+	Distance  *float64 `xml:"DistanceMeters"`
+	HeartRate *int     `xml:"HeartRateBpm>Value"`
+}
+
+func parseTCX(data []byte) (*Track, error) {
+	var doc tcxFile
+	err := xml.Unmarshal(data, &doc)
+	if err != nil {
+		return nil, err
+	}
+
+	track := &Track{}
+	calories := 0
+	for _, act := range doc.Activities {
+		if track.Sport == "" {
+			track.Sport = act.Sport
+		}
+		for _, lap := range act.Laps {
+			if lap.Calories != nil {
+				calories += *lap.Calories
+			}
+			for _, pt := range lap.Points {
+				t, err := time.Parse(time.RFC3339, pt.Time)
+				if err != nil {
+					continue
+				}
+				track.Points = append(track.Points, Point{
+					Time:           t,
+					Lat:            pt.Lat,
+					Lon:            pt.Lon,
+					ElevationM:     pt.Altitude,
+					HeartRate:      pt.HeartRate,
+					DistanceMeters: pt.Distance,
+				})
+			}
+		}
+	}
+
+	if calories > 0 {
+		track.Calories = &calories
+	}
+	return track, nil
+}
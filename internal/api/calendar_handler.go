@@ -0,0 +1,157 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cykj40/beginner_go/internal/ical"
+	"github.com/cykj40/beginner_go/internal/logging"
+	"github.com/cykj40/beginner_go/internal/middleware"
+	"github.com/cykj40/beginner_go/internal/problem"
+	"github.com/cykj40/beginner_go/internal/store"
+	"github.com/cykj40/beginner_go/internal/store/tokens"
+	"github.com/cykj40/beginner_go/internal/utils"
+	"github.com/go-chi/chi/v5"
+)
+
+type CalendarHandler struct {
+	workoutStore store.WorkoutStore
+	userStore    store.UserStore
+	tokenStore   store.TokenStore
+	tokenTTL     time.Duration
+}
+
+func NewCalendarHandler(workoutStore store.WorkoutStore, userStore store.UserStore, tokenStore store.TokenStore, tokenTTL time.Duration) *CalendarHandler {
+	return &CalendarHandler{
+		workoutStore: workoutStore,
+		userStore:    userStore,
+		tokenStore:   tokenStore,
+		tokenTTL:     tokenTTL,
+	}
+}
+
+// HandleRotateCalendarToken issues a new calendar feed token, invalidating
+// any feed URL handed out before. Login tokens are left untouched.
+func (h *CalendarHandler) HandleRotateCalendarToken(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	err := h.tokenStore.DeleteAllTokensForUser(r.Context(), currentUser.ID, tokens.ScopeCalendar)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("DeleteAllTokensForUser", "error", err)
+		problem.Write(w, r, problem.Internal(err, "internal server error"))
+		return
+	}
+
+	token, err := h.tokenStore.CreateNewToken(r.Context(), currentUser.ID, h.tokenTTL, tokens.ScopeCalendar)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("CreateNewToken", "error", err)
+		problem.Write(w, r, problem.Internal(err, "internal server error"))
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{
+		"calendar_token": token,
+		"url":            fmt.Sprintf("/calendar/%s.ics", token.Plaintext),
+	})
+}
+
+func (h *CalendarHandler) HandleGetCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	plaintext := chi.URLParam(r, "token")
+	if plaintext == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	user, err := h.userStore.GetUserToken(r.Context(), tokens.ScopeCalendar, plaintext)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("GetUserToken", "error", err)
+		problem.Write(w, r, problem.Internal(err, "internal server error"))
+		return
+	}
+	if user == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	workouts, err := h.workoutStore.ListWorkouts(r.Context(), user.ID, store.WorkoutFilter{Sort: "started_at"})
+	if err != nil {
+		logging.FromContext(r.Context()).Error("listWorkouts", "error", err)
+		problem.Write(w, r, problem.Internal(err, "internal server error"))
+		return
+	}
+
+	now := time.Now()
+	cal := ical.Calendar{
+		ProductID: "-//beginner_go//workouts//EN",
+		Name:      fmt.Sprintf("%s's workouts", user.Username),
+	}
+	for _, workout := range workouts {
+		workout.ConvertWeights(user.PreferredUnit)
+		cal.Events = append(cal.Events, workoutEvent(workout, now))
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	err = ical.Write(w, cal)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("writing calendar feed", "error", err)
+	}
+}
+
+// workoutEvent maps a workout onto a VEVENT. Workouts that start in the
+// future are scheduled sessions and are published as tentative.
+func workoutEvent(workout store.Workout, now time.Time) ical.Event {
+	end := workout.StartedAt.Add(time.Duration(workout.DurationMinutes) * time.Minute)
+	if workout.EndedAt != nil {
+		end = *workout.EndedAt
+	}
+
+	status := ical.StatusConfirmed
+	if workout.StartedAt.After(now) {
+		status = ical.StatusTentative
+	}
+
+	var description []string
+	if workout.Description != "" {
+		description = append(description, workout.Description, "")
+	}
+	for _, entry := range workout.Entries {
+		description = append(description, "- "+entrySummary(entry))
+	}
+	description = append(description, "", fmt.Sprintf("Duration: %d min", workout.DurationMinutes))
+	if workout.CaloriesBurned > 0 {
+		description = append(description, fmt.Sprintf("Calories: %d", workout.CaloriesBurned))
+	}
+
+	return ical.Event{
+		UID:         fmt.Sprintf("workout-%d@beginner_go", workout.ID),
+		Summary:     workout.Title,
+		Description: strings.Join(description, "\n"),
+		Start:       workout.StartedAt,
+		End:         end,
+		Status:      status,
+		Stamp:       now,
+	}
+}
+
+func entrySummary(entry store.WorkoutEntry) string {
+	var sb strings.Builder
+	sb.WriteString(entry.ExerciseName)
+	switch {
+	case entry.Distance != nil && entry.DistanceUnit != nil:
+		fmt.Fprintf(&sb, ": %g %s", *entry.Distance, *entry.DistanceUnit)
+		if entry.DurationSeconds != nil {
+			fmt.Fprintf(&sb, " in %s", time.Duration(*entry.DurationSeconds)*time.Second)
+		}
+	case entry.Reps != nil:
+		fmt.Fprintf(&sb, ": %d x %d", entry.Sets, *entry.Reps)
+	case entry.DurationSeconds != nil:
+		fmt.Fprintf(&sb, ": %d x %ds", entry.Sets, *entry.DurationSeconds)
+	}
+	if entry.Weight != nil {
+		fmt.Fprintf(&sb, " @ %g %s", *entry.Weight, entry.WeightUnit)
+	}
+	return sb.String()
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/cykj40/beginner_go/internal/problem"
+)
+
+// workoutETag is the entity tag for a workout version. It only tracks the
+// stored data, so the same tag covers every ?units= rendering.
+func workoutETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// etagListMatches reports whether a comma separated If-Match or
+// If-None-Match header names etag, a strong tag. If-Match needs the strong
+// comparison of RFC 7232, where a weak tag never matches; If-None-Match
+// uses the weak one, which compares tags by their opaque part.
+func etagListMatches(header, etag string, weak bool) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+		if weak {
+			tag = strings.TrimPrefix(tag, "W/")
+		}
+		if tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// ifMatchFails reports whether the request carries an If-Match header that
+// does not name the current version. A missing header passes here; it is
+// rejected by checkIfMatch when If-Match is required.
+func ifMatchFails(r *http.Request, version int) bool {
+	header := r.Header.Get("If-Match")
+	return header != "" && !etagListMatches(header, workoutETag(version), false)
+}
+
+// checkIfMatch guards a write to a workout at version. It answers 428 when
+// If-Match is required but missing and 412 when it names another version,
+// and reports whether the write may go ahead.
+func (wh *WorkoutHandler) checkIfMatch(w http.ResponseWriter, r *http.Request, version int) bool {
+	if wh.requireIfMatch && r.Header.Get("If-Match") == "" {
+		problem.Write(w, r, problem.PreconditionRequired("send If-Match with the workout's ETag to change it"))
+		return false
+	}
+	if ifMatchFails(r, version) {
+		w.Header().Set("ETag", workoutETag(version))
+		problem.Write(w, r, problem.PreconditionFailed("workout has been modified since it was fetched"))
+		return false
+	}
+	return true
+}
+
+// ifNoneMatchHits reports whether the client already has the current version
+func ifNoneMatchHits(r *http.Request, version int) bool {
+	header := r.Header.Get("If-None-Match")
+	return header != "" && etagListMatches(header, workoutETag(version), true)
+}
+
+// expectedVersion is the version a conditional write must still find in
+// the store, or 0 for an unconditional write
+func expectedVersion(r *http.Request, version int) int {
+	if r.Header.Get("If-Match") == "" {
+		return 0
+	}
+	return version
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEtagListMatches(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		weak   bool
+		want   bool
+	}{
+		{"exact", `"3"`, false, true},
+		{"mismatch", `"2"`, false, false},
+		{"list", `"1", "3" ,"5"`, false, true},
+		{"list without match", `"1","2"`, false, false},
+		{"star", `*`, false, true},
+		{"weak tag on strong comparison", `W/"3"`, false, false},
+		{"weak tag on weak comparison", `W/"3"`, true, true},
+		{"weak tag in list on weak comparison", `"1", W/"3"`, true, true},
+		{"unquoted", `3`, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, etagListMatches(tt.header, workoutETag(3), tt.weak))
+		})
+	}
+}
+
+func TestCheckIfMatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		require bool
+		ok      bool
+		status  int
+	}{
+		{"missing allowed", "", false, true, http.StatusOK},
+		{"missing required", "", true, false, http.StatusPreconditionRequired},
+		{"current version", `"3"`, true, true, http.StatusOK},
+		{"stale version", `"2"`, false, false, http.StatusPreconditionFailed},
+		{"weak tag", `W/"3"`, false, false, http.StatusPreconditionFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wh := &WorkoutHandler{requireIfMatch: tt.require}
+			r := httptest.NewRequest(http.MethodPut, "/workouts/1", nil)
+			if tt.header != "" {
+				r.Header.Set("If-Match", tt.header)
+			}
+			w := httptest.NewRecorder()
+
+			assert.Equal(t, tt.ok, wh.checkIfMatch(w, r, 3))
+			assert.Equal(t, tt.status, w.Code)
+			if tt.status == http.StatusPreconditionFailed {
+				assert.Equal(t, `"3"`, w.Header().Get("ETag"))
+			}
+		})
+	}
+}
+
+func TestIfNoneMatchHits(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/workouts/1", nil)
+	assert.False(t, ifNoneMatchHits(r, 3))
+
+	r.Header.Set("If-None-Match", `W/"3"`)
+	assert.True(t, ifNoneMatchHits(r, 3))
+
+	r.Header.Set("If-None-Match", `"4"`)
+	assert.False(t, ifNoneMatchHits(r, 3))
+}
@@ -0,0 +1,354 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/cykj40/beginner_go/internal/goals"
+	"github.com/cykj40/beginner_go/internal/logging"
+	"github.com/cykj40/beginner_go/internal/middleware"
+	"github.com/cykj40/beginner_go/internal/problem"
+	"github.com/cykj40/beginner_go/internal/store"
+	"github.com/cykj40/beginner_go/internal/utils"
+)
+
+type GoalHandler struct {
+	goalStore store.GoalStore
+}
+
+func NewGoalHandler(goalStore store.GoalStore) *GoalHandler {
+	return &GoalHandler{
+		goalStore: goalStore,
+	}
+}
+
+// evaluateGoal fills in the goal's progress over the window containing at
+func evaluateGoal(ctx context.Context, goalStore store.GoalStore, goal *store.Goal, at time.Time) error {
+	start, end, err := goal.Window(at)
+	if err != nil {
+		return err
+	}
+
+	value, err := goalStore.GetGoalValue(ctx, goal, start, end)
+	if err != nil {
+		return err
+	}
+
+	goal.Progress = &store.GoalProgress{
+		Value:       value,
+		Target:      goal.Target,
+		Percent:     goals.Percent(value, goal.Target),
+		Achieved:    value >= goal.Target,
+		PeriodStart: start,
+		PeriodEnd:   end,
+	}
+	return nil
+}
+
+// recordGoalEvents checks the user's goals against the window the workout
+// falls in and records an event for each goal the save has completed
+func recordGoalEvents(ctx context.Context, goalStore store.GoalStore, workout *store.Workout) ([]store.GoalEvent, error) {
+	userGoals, err := goalStore.ListGoals(ctx, int64(workout.UserID))
+	if err != nil {
+		return nil, err
+	}
+
+	events := []store.GoalEvent{}
+	for i := range userGoals {
+		goal := &userGoals[i]
+		if goal.Period == nil && goal.AchievedAt != nil {
+			continue
+		}
+
+		err = evaluateGoal(ctx, goalStore, goal, workout.StartedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		progress := goal.Progress
+		if !progress.Achieved || workout.StartedAt.Before(progress.PeriodStart) || !workout.StartedAt.Before(progress.PeriodEnd) {
+			continue
+		}
+
+		workoutID := int64(workout.ID)
+		event := store.GoalEvent{
+			GoalID:      goal.ID,
+			UserID:      goal.UserID,
+			WorkoutID:   &workoutID,
+			PeriodStart: progress.PeriodStart,
+			Value:       progress.Value,
+		}
+		created, err := goalStore.RecordGoalEvent(ctx, &event)
+		if err != nil {
+			return nil, err
+		}
+		if !created {
+			continue
+		}
+
+		if goal.Period == nil {
+			err = goalStore.MarkGoalAchieved(ctx, goal.ID, event.AchievedAt)
+			if err != nil {
+				return nil, err
+			}
+		}
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+// getOwnedGoal loads the goal named in the URL and writes the error
+// response itself when it is missing or belongs to someone else
+func (h *GoalHandler) getOwnedGoal(w http.ResponseWriter, r *http.Request) *store.Goal {
+	goalID, err := utils.ReadIDParam(r)
+	if err != nil {
+		problem.Write(w, r, problem.BadRequest("invalid goal id"))
+		return nil
+	}
+
+	goal, err := h.goalStore.GetGoal(r.Context(), goalID)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("getGoal", "error", err)
+		problem.Write(w, r, problem.Internal(err, "internal server error"))
+		return nil
+	}
+	if goal == nil {
+		problem.Write(w, r, problem.NotFound("goal not found"))
+		return nil
+	}
+
+	if goal.UserID != middleware.GetUser(r).ID {
+		problem.Write(w, r, problem.Forbidden("you can only access your own goals"))
+		return nil
+	}
+
+	return goal
+}
+
+func (h *GoalHandler) HandleListGoals(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	unit, err := readWeightUnit(r)
+	if err != nil {
+		problem.Write(w, r, problem.BadRequest(err.Error()))
+		return
+	}
+
+	userGoals, err := h.goalStore.ListGoals(r.Context(), currentUser.ID)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("listGoals", "error", err)
+		problem.Write(w, r, problem.Internal(err, "internal server error"))
+		return
+	}
+
+	now := time.Now()
+	for i := range userGoals {
+		err = evaluateGoal(r.Context(), h.goalStore, &userGoals[i], now)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("evaluateGoal", "error", err)
+			problem.Write(w, r, problem.Internal(err, "internal server error"))
+			return
+		}
+		userGoals[i].Convert(unit)
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"goals": userGoals})
+}
+
+func (h *GoalHandler) HandleGetGoal(w http.ResponseWriter, r *http.Request) {
+	goal := h.getOwnedGoal(w, r)
+	if goal == nil {
+		return
+	}
+
+	unit, err := readWeightUnit(r)
+	if err != nil {
+		problem.Write(w, r, problem.BadRequest(err.Error()))
+		return
+	}
+
+	err = evaluateGoal(r.Context(), h.goalStore, goal, time.Now())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("evaluateGoal", "error", err)
+		problem.Write(w, r, problem.Internal(err, "internal server error"))
+		return
+	}
+	goal.Convert(unit)
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"goal": goal})
+}
+
+func (h *GoalHandler) HandleCreateGoal(w http.ResponseWriter, r *http.Request) {
+	var goal store.Goal
+	err := json.NewDecoder(r.Body).Decode(&goal)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("decodingCreateGoal", "error", err)
+		problem.Write(w, r, problem.BadRequest("invalid request sent"))
+		return
+	}
+
+	unit, err := readWeightUnit(r)
+	if err != nil {
+		problem.Write(w, r, problem.BadRequest(err.Error()))
+		return
+	}
+	if goal.Unit == "" {
+		goal.Unit = unit
+	}
+
+	goal.UserID = middleware.GetUser(r).ID
+	goal.AchievedAt = nil
+
+	err = goal.Normalize()
+	if err != nil {
+		problem.Write(w, r, problem.BadRequest(err.Error()))
+		return
+	}
+
+	err = h.goalStore.CreateGoal(r.Context(), &goal)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("createGoal", "error", err)
+		problem.Write(w, r, problem.Internal(err, "failed to create goal"))
+		return
+	}
+
+	err = evaluateGoal(r.Context(), h.goalStore, &goal, time.Now())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("evaluateGoal", "error", err)
+	}
+	goal.Convert(unit)
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"goal": goal})
+}
+
+func (h *GoalHandler) HandleUpdateGoal(w http.ResponseWriter, r *http.Request) {
+	goal := h.getOwnedGoal(w, r)
+	if goal == nil {
+		return
+	}
+
+	unit, err := readWeightUnit(r)
+	if err != nil {
+		problem.Write(w, r, problem.BadRequest(err.Error()))
+		return
+	}
+
+	// decode over a copy shown in the caller's unit, so an omitted target
+	// is not read as kg
+	goal.Convert(unit)
+	goal.Unit = ""
+	if goal.GoalType == store.GoalMaxWeight {
+		goal.Unit = unit
+	}
+	existing := *goal
+	err = json.NewDecoder(r.Body).Decode(goal)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("decodingUpdateGoal", "error", err)
+		problem.Write(w, r, problem.BadRequest("invalid request payload"))
+		return
+	}
+	goal.ID, goal.UserID = existing.ID, existing.UserID
+	goal.AchievedAt, goal.CreatedAt = existing.AchievedAt, existing.CreatedAt
+	goal.Progress = nil
+	if goal.Unit == "" {
+		goal.Unit = unit
+	}
+
+	err = goal.Normalize()
+	if err != nil {
+		problem.Write(w, r, problem.BadRequest(err.Error()))
+		return
+	}
+
+	err = h.goalStore.UpdateGoal(r.Context(), goal)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("updateGoal", "error", err)
+		problem.Write(w, r, problem.Internal(err, "failed to update goal"))
+		return
+	}
+
+	err = evaluateGoal(r.Context(), h.goalStore, goal, time.Now())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("evaluateGoal", "error", err)
+	}
+	goal.Convert(unit)
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"goal": goal})
+}
+
+func (h *GoalHandler) HandleDeleteGoal(w http.ResponseWriter, r *http.Request) {
+	goal := h.getOwnedGoal(w, r)
+	if goal == nil {
+		return
+	}
+
+	err := h.goalStore.DeleteGoal(r.Context(), goal.ID)
+	if err == sql.ErrNoRows {
+		problem.Write(w, r, problem.NotFound("goal not found"))
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("deleteGoal", "error", err)
+		problem.Write(w, r, problem.Internal(err, "failed to delete goal"))
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+func (h *GoalHandler) HandleListGoalEvents(w http.ResponseWriter, r *http.Request) {
+	goal := h.getOwnedGoal(w, r)
+	if goal == nil {
+		return
+	}
+
+	events, err := h.goalStore.ListGoalEvents(r.Context(), goal.ID)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("listGoalEvents", "error", err)
+		problem.Write(w, r, problem.Internal(err, "internal server error"))
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"events": events})
+}
+
+// HandleGetStreaks reports the current and longest runs of consecutive
+// days or weeks with a workout, as chosen by ?period=
+func (h *GoalHandler) HandleGetStreaks(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = goals.PeriodDaily
+	}
+	if period != goals.PeriodDaily && period != goals.PeriodWeekly {
+		problem.Write(w, r, problem.BadRequest("period must be daily or weekly"))
+		return
+	}
+
+	loc, err := readLocation(r)
+	if err != nil {
+		problem.Write(w, r, problem.BadRequest(err.Error()))
+		return
+	}
+
+	times, err := h.goalStore.GetWorkoutTimes(r.Context(), currentUser.ID)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("getWorkoutTimes", "error", err)
+		problem.Write(w, r, problem.Internal(err, "internal server error"))
+		return
+	}
+
+	streak, err := goals.Streaks(period, times, time.Now(), loc)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("streaks", "error", err)
+		problem.Write(w, r, problem.Internal(err, "internal server error"))
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"streak": streak})
+}
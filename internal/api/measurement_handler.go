@@ -0,0 +1,384 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cykj40/beginner_go/internal/logging"
+	"github.com/cykj40/beginner_go/internal/middleware"
+	"github.com/cykj40/beginner_go/internal/problem"
+	"github.com/cykj40/beginner_go/internal/store"
+	"github.com/cykj40/beginner_go/internal/utils"
+)
+
+const defaultTrendWindow = 7
+
+type MeasurementHandler struct {
+	measurementStore store.MeasurementStore
+	userStore        store.UserStore
+}
+
+func NewMeasurementHandler(measurementStore store.MeasurementStore, userStore store.UserStore) *MeasurementHandler {
+	return &MeasurementHandler{
+		measurementStore: measurementStore,
+		userStore:        userStore,
+	}
+}
+
+// readLocation reads the tz query parameter, defaulting to UTC
+func readLocation(r *http.Request) (*time.Location, error) {
+	tz := r.URL.Query().Get("tz")
+	if tz == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, errors.New("invalid tz parameter")
+	}
+	return loc, nil
+}
+
+// syncBodyWeight copies the latest logged bodyweight onto the user's profile
+// so calorie estimates follow the log. Once no bodyweight is logged the
+// profile value is cleared rather than left stale.
+func (h *MeasurementHandler) syncBodyWeight(ctx context.Context, user *store.User) error {
+	latest, err := h.measurementStore.GetLatestMeasurement(ctx, user.ID, store.MetricBodyweight)
+	if err != nil {
+		return err
+	}
+
+	if latest == nil {
+		if user.BodyWeightKg == nil {
+			return nil
+		}
+		user.BodyWeightKg = nil
+		return h.userStore.UpdateUser(ctx, user)
+	}
+
+	if user.BodyWeightKg != nil && *user.BodyWeightKg == latest.Value {
+		return nil
+	}
+	user.BodyWeightKg = &latest.Value
+	return h.userStore.UpdateUser(ctx, user)
+}
+
+// getOwnedMeasurement loads the measurement named in the URL and writes the
+// error response itself when it is missing or belongs to someone else
+func (h *MeasurementHandler) getOwnedMeasurement(w http.ResponseWriter, r *http.Request) *store.Measurement {
+	measurementID, err := utils.ReadIDParam(r)
+	if err != nil {
+		problem.Write(w, r, problem.BadRequest("invalid measurement id"))
+		return nil
+	}
+
+	measurement, err := h.measurementStore.GetMeasurement(r.Context(), measurementID)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("getMeasurement", "error", err)
+		problem.Write(w, r, problem.Internal(err, "internal server error"))
+		return nil
+	}
+	if measurement == nil {
+		problem.Write(w, r, problem.NotFound("measurement not found"))
+		return nil
+	}
+
+	if measurement.UserID != middleware.GetUser(r).ID {
+		problem.Write(w, r, problem.Forbidden("you can only access your own measurements"))
+		return nil
+	}
+
+	return measurement
+}
+
+func (h *MeasurementHandler) HandleListMeasurements(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	loc, err := readLocation(r)
+	if err != nil {
+		problem.Write(w, r, problem.BadRequest(err.Error()))
+		return
+	}
+
+	unit, err := readWeightUnit(r)
+	if err != nil {
+		problem.Write(w, r, problem.BadRequest(err.Error()))
+		return
+	}
+
+	query := r.URL.Query()
+	filter := store.MeasurementFilter{Type: query.Get("type")}
+	if filter.Type != "" && !store.ValidMetric(filter.Type) {
+		problem.Write(w, r, problem.BadRequest("unknown measurement type"))
+		return
+	}
+
+	filter.From, err = parseTimeParam(query.Get("from"), loc)
+	if err != nil {
+		problem.Write(w, r, problem.BadRequest(err.Error()))
+		return
+	}
+	filter.To, err = parseTimeParam(query.Get("to"), loc)
+	if err != nil {
+		problem.Write(w, r, problem.BadRequest(err.Error()))
+		return
+	}
+
+	measurements, err := h.measurementStore.ListMeasurements(r.Context(), currentUser.ID, filter)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("listMeasurements", "error", err)
+		problem.Write(w, r, problem.Internal(err, "internal server error"))
+		return
+	}
+
+	for i := range measurements {
+		measurements[i].Convert(unit)
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"measurements": measurements})
+}
+
+// HandleGetMeasurementSeries returns one measurement type over time,
+// optionally averaged per day or week, with a trailing moving average
+func (h *MeasurementHandler) HandleGetMeasurementSeries(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+	query := r.URL.Query()
+
+	metric := query.Get("type")
+	if !store.ValidMetric(metric) {
+		problem.Write(w, r, problem.BadRequest("type is required and must be a known measurement type"))
+		return
+	}
+
+	var bucket string
+	switch query.Get("bucket") {
+	case "", "none":
+		bucket = store.BucketNone
+	case "daily":
+		bucket = store.BucketDaily
+	case "weekly":
+		bucket = store.BucketWeekly
+	default:
+		problem.Write(w, r, problem.BadRequest("bucket must be none, daily or weekly"))
+		return
+	}
+
+	window := defaultTrendWindow
+	if value := query.Get("window"); value != "" {
+		var err error
+		window, err = strconv.Atoi(value)
+		if err != nil || window < 1 || window > 365 {
+			problem.Write(w, r, problem.BadRequest("window must be between 1 and 365"))
+			return
+		}
+	}
+
+	loc, err := readLocation(r)
+	if err != nil {
+		problem.Write(w, r, problem.BadRequest(err.Error()))
+		return
+	}
+
+	unit, err := readWeightUnit(r)
+	if err != nil {
+		problem.Write(w, r, problem.BadRequest(err.Error()))
+		return
+	}
+
+	seriesQuery := store.SeriesQuery{Type: metric, Bucket: bucket, Location: loc}
+	seriesQuery.From, err = parseTimeParam(query.Get("from"), loc)
+	if err != nil {
+		problem.Write(w, r, problem.BadRequest(err.Error()))
+		return
+	}
+	seriesQuery.To, err = parseTimeParam(query.Get("to"), loc)
+	if err != nil {
+		problem.Write(w, r, problem.BadRequest(err.Error()))
+		return
+	}
+
+	points, err := h.measurementStore.GetMeasurementSeries(r.Context(), currentUser.ID, seriesQuery)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("getMeasurementSeries", "error", err)
+		problem.Write(w, r, problem.Internal(err, "internal server error"))
+		return
+	}
+
+	store.MovingAverage(points, window)
+	for i := range points {
+		points[i].Convert(metric, unit)
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"type":   metric,
+		"bucket": query.Get("bucket"),
+		"window": window,
+		"points": points,
+	})
+}
+
+func (h *MeasurementHandler) HandleGetMeasurement(w http.ResponseWriter, r *http.Request) {
+	measurement := h.getOwnedMeasurement(w, r)
+	if measurement == nil {
+		return
+	}
+
+	unit, err := readWeightUnit(r)
+	if err != nil {
+		problem.Write(w, r, problem.BadRequest(err.Error()))
+		return
+	}
+	measurement.Convert(unit)
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"measurement": measurement})
+}
+
+func (h *MeasurementHandler) HandleCreateMeasurement(w http.ResponseWriter, r *http.Request) {
+	var measurement store.Measurement
+	err := json.NewDecoder(r.Body).Decode(&measurement)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("decodingCreateMeasurement", "error", err)
+		problem.Write(w, r, problem.BadRequest("invalid request sent"))
+		return
+	}
+
+	unit, err := readWeightUnit(r)
+	if err != nil {
+		problem.Write(w, r, problem.BadRequest(err.Error()))
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	measurement.UserID = currentUser.ID
+
+	measurement.DefaultUnit(unit)
+	err = measurement.Normalize()
+	if err != nil {
+		problem.Write(w, r, problem.BadRequest(err.Error()))
+		return
+	}
+
+	err = h.measurementStore.CreateMeasurement(r.Context(), &measurement)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("createMeasurement", "error", err)
+		problem.Write(w, r, problem.Internal(err, "failed to create measurement"))
+		return
+	}
+
+	if measurement.Type == store.MetricBodyweight {
+		err = h.syncBodyWeight(r.Context(), currentUser)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("syncBodyWeight", "error", err)
+		}
+	}
+
+	measurement.Convert(unit)
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"measurement": measurement})
+}
+
+func (h *MeasurementHandler) HandleUpdateMeasurement(w http.ResponseWriter, r *http.Request) {
+	existing := h.getOwnedMeasurement(w, r)
+	if existing == nil {
+		return
+	}
+
+	var req struct {
+		Type       *string    `json:"type"`
+		Value      *float64   `json:"value"`
+		Unit       *string    `json:"unit"`
+		MeasuredAt *time.Time `json:"measured_at"`
+		Notes      *string    `json:"notes"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("decodingUpdateMeasurement", "error", err)
+		problem.Write(w, r, problem.BadRequest("invalid request payload"))
+		return
+	}
+
+	unit, err := readWeightUnit(r)
+	if err != nil {
+		problem.Write(w, r, problem.BadRequest(err.Error()))
+		return
+	}
+
+	previousType := existing.Type
+	if req.Type != nil {
+		existing.Type = *req.Type
+	}
+	if req.Value != nil {
+		existing.Value = *req.Value
+		existing.Unit = ""
+	}
+	if req.Unit != nil {
+		existing.Unit = *req.Unit
+	}
+	if req.MeasuredAt != nil {
+		existing.MeasuredAt = *req.MeasuredAt
+	}
+	if req.Notes != nil {
+		existing.Notes = req.Notes
+	}
+
+	// a stored value is already canonical for its type, so a type change
+	// without a new value cannot be converted meaningfully
+	if existing.Type != previousType && req.Value == nil {
+		problem.Write(w, r, problem.BadRequest("value is required when changing type"))
+		return
+	}
+
+	existing.DefaultUnit(unit)
+	err = existing.Normalize()
+	if err != nil {
+		problem.Write(w, r, problem.BadRequest(err.Error()))
+		return
+	}
+
+	err = h.measurementStore.UpdateMeasurement(r.Context(), existing)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("updateMeasurement", "error", err)
+		problem.Write(w, r, problem.Internal(err, "failed to update measurement"))
+		return
+	}
+
+	if existing.Type == store.MetricBodyweight || previousType == store.MetricBodyweight {
+		err = h.syncBodyWeight(r.Context(), middleware.GetUser(r))
+		if err != nil {
+			logging.FromContext(r.Context()).Error("syncBodyWeight", "error", err)
+		}
+	}
+
+	existing.Convert(unit)
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"measurement": existing})
+}
+
+func (h *MeasurementHandler) HandleDeleteMeasurement(w http.ResponseWriter, r *http.Request) {
+	measurement := h.getOwnedMeasurement(w, r)
+	if measurement == nil {
+		return
+	}
+
+	err := h.measurementStore.DeleteMeasurement(r.Context(), measurement.ID)
+	if err == sql.ErrNoRows {
+		problem.Write(w, r, problem.NotFound("measurement not found"))
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("deleteMeasurement", "error", err)
+		problem.Write(w, r, problem.Internal(err, "failed to delete measurement"))
+		return
+	}
+
+	if measurement.Type == store.MetricBodyweight {
+		err = h.syncBodyWeight(r.Context(), middleware.GetUser(r))
+		if err != nil {
+			logging.FromContext(r.Context()).Error("syncBodyWeight", "error", err)
+		}
+	}
+
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cykj40/beginner_go/internal/middleware"
+	"github.com/cykj40/beginner_go/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeMeasurementStore struct {
+	store.MeasurementStore
+	created *store.Measurement
+}
+
+func (f *fakeMeasurementStore) CreateMeasurement(ctx context.Context, m *store.Measurement) error {
+	saved := *m
+	f.created = &saved
+	return nil
+}
+
+func (f *fakeMeasurementStore) GetLatestMeasurement(ctx context.Context, userID int64, metric string) (*store.Measurement, error) {
+	return f.created, nil
+}
+
+func TestHandleCreateMeasurementUsesPreferredUnit(t *testing.T) {
+	measurementStore := &fakeMeasurementStore{}
+	h := NewMeasurementHandler(measurementStore, &fakeUserStore{})
+
+	r := httptest.NewRequest(http.MethodPost, "/measurements", strings.NewReader(`{"type":"bodyweight","value":176.37}`))
+	r = middleware.SetUser(r, &store.User{ID: 7, PreferredUnit: "lb"})
+	w := httptest.NewRecorder()
+	h.HandleCreateMeasurement(w, r)
+
+	require.Equal(t, http.StatusCreated, w.Code)
+	require.NotNil(t, measurementStore.created)
+	assert.Equal(t, "kg", measurementStore.created.Unit)
+	assert.InDelta(t, 80.0, measurementStore.created.Value, 0.01)
+	assert.Contains(t, w.Body.String(), `"value":176.37`)
+}
@@ -2,19 +2,22 @@ package api
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
 	"time"
 
+	"github.com/cykj40/beginner_go/internal/logging"
+	"github.com/cykj40/beginner_go/internal/metrics"
+	"github.com/cykj40/beginner_go/internal/problem"
 	"github.com/cykj40/beginner_go/internal/store"
 	"github.com/cykj40/beginner_go/internal/store/tokens"
 	"github.com/cykj40/beginner_go/internal/utils"
+	"github.com/cykj40/beginner_go/internal/validator"
 )
 
 type TokenHandler struct {
 	tokenStore store.TokenStore
 	userStore  store.UserStore
-	logger     *log.Logger
+	tokenTTL   time.Duration
 }
 
 type createTokenRequest struct {
@@ -22,11 +25,11 @@ type createTokenRequest struct {
 	Password string `json:"password"`
 }
 
-func NewTokenHandler(tokenStore store.TokenStore, userStore store.UserStore, logger *log.Logger) *TokenHandler {
+func NewTokenHandler(tokenStore store.TokenStore, userStore store.UserStore, tokenTTL time.Duration) *TokenHandler {
 	return &TokenHandler{
 		tokenStore: tokenStore,
 		userStore:  userStore,
-		logger:     logger,
+		tokenTTL:   tokenTTL,
 	}
 }
 
@@ -34,39 +37,50 @@ func (h *TokenHandler) HandleCreateToken(w http.ResponseWriter, r *http.Request)
 	var req createTokenRequest
 	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
-		h.logger.Printf("ERROR: createTokenRequest: %v", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		logging.FromContext(r.Context()).Error("createTokenRequest", "error", err)
+		problem.Write(w, r, problem.BadRequest("invalid request payload"))
+		return
+	}
+
+	v := validator.New()
+	v.Check(validator.NotBlank(req.Email), "email", "email is required")
+	v.Check(validator.NotBlank(req.Password), "password", "password is required")
+	if !v.Valid() {
+		problem.Write(w, r, problem.Unprocessable(v))
 		return
 	}
 
 	// let's get the user
-	user, err := h.userStore.GetUserByEmail(req.Email)
+	user, err := h.userStore.GetUserByEmail(r.Context(), req.Email)
 	if err != nil {
-		h.logger.Printf("ERROR: GetUser/byemail: %v", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		logging.FromContext(r.Context()).Error("GetUser/byemail", "error", err)
+		problem.Write(w, r, problem.Internal(err, "internal server error"))
 		return
 	}
 
 	if user == nil {
-		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid credentials"})
+		metrics.AuthAttempt("password", false)
+		problem.Write(w, r, problem.Unauthorized("invalid credentials"))
 		return
 	}
 
 	passwordsDoMatch, err := user.Password.Matches(req.Password)
 	if err != nil {
-		h.logger.Printf("ERROR: Password.Matches: %v", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		logging.FromContext(r.Context()).Error("Password.Matches", "error", err)
+		problem.Write(w, r, problem.Internal(err, "internal server error"))
 		return
 	}
 	if !passwordsDoMatch {
-		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid credentials"})
+		metrics.AuthAttempt("password", false)
+		problem.Write(w, r, problem.Unauthorized("invalid credentials"))
 		return
 	}
+	metrics.AuthAttempt("password", true)
 
-	token, err := h.tokenStore.CreateNewToken(user.ID, time.Hour*24, tokens.ScopeAuth)
+	token, err := h.tokenStore.CreateNewToken(r.Context(), user.ID, h.tokenTTL, tokens.ScopeAuth)
 	if err != nil {
-		h.logger.Printf("ERROR: CreateNewToken: %v", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		logging.FromContext(r.Context()).Error("CreateNewToken", "error", err)
+		problem.Write(w, r, problem.Internal(err, "internal server error"))
 		return
 	}
 
@@ -2,76 +2,79 @@ package api
 
 import (
 	"encoding/json"
-	"errors"
-	"log"
 	"net/http"
-	"regexp"
 
+	"github.com/cykj40/beginner_go/internal/logging"
+	"github.com/cykj40/beginner_go/internal/middleware"
+	"github.com/cykj40/beginner_go/internal/problem"
 	"github.com/cykj40/beginner_go/internal/store"
+	"github.com/cykj40/beginner_go/internal/units"
 	"github.com/cykj40/beginner_go/internal/utils"
+	"github.com/cykj40/beginner_go/internal/validator"
 )
 
 type registerUserRequest struct {
-	Username string `json:"username"`
-	Email    string `json:"email"`
-	Password string `json:"password"`
-	Bio      string `json:"bio"`
+	Username      string `json:"username"`
+	Email         string `json:"email"`
+	Password      string `json:"password"`
+	Bio           string `json:"bio"`
+	PreferredUnit string `json:"preferred_unit"`
+}
+
+type updateUserRequest struct {
+	Bio           *string  `json:"bio"`
+	PreferredUnit *string  `json:"preferred_unit"`
+	BodyWeightKg  *float64 `json:"body_weight_kg"`
 }
 
 type UserHandler struct {
 	userStore store.UserStore
-	logger    *log.Logger
 }
 
-func NewUserHandler(userStore store.UserStore, logger *log.Logger) *UserHandler {
+func NewUserHandler(userStore store.UserStore) *UserHandler {
 	return &UserHandler{
 		userStore: userStore,
-		logger:    logger,
 	}
 }
 
 func (h *UserHandler) validateRegisterRequest(reg *registerUserRequest) error {
-	if reg.Username == "" {
-		return errors.New("username is required")
-	}
+	v := validator.New()
 
-	if len(reg.Username) > 50 {
-		return errors.New("username cannot be greater than 50 characters")
-	}
+	v.Check(validator.NotBlank(reg.Username), "username", "username is required")
+	v.Check(validator.MaxChars(reg.Username, 50), "username", "username cannot be greater than 50 characters")
 
-	if reg.Email == "" {
-		return errors.New("email is required")
-	}
-	emailRegex := regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
-	if !emailRegex.MatchString(reg.Email) {
-		return errors.New("invalid email format")
-	}
+	v.Check(validator.NotBlank(reg.Email), "email", "email is required")
+	v.Check(reg.Email == "" || validator.Matches(reg.Email, validator.EmailRX), "email", "invalid email format")
+	v.Check(validator.MaxChars(reg.Email, 255), "email", "email cannot be greater than 255 characters")
 
-	if reg.Password == "" {
-		return errors.New("password is required")
-	}
+	v.Check(reg.Password != "", "password", "password is required")
+	// bcrypt ignores everything past 72 bytes
+	v.Check(len(reg.Password) <= 72, "password", "password cannot be greater than 72 bytes")
 
-	return nil
+	v.Check(reg.PreferredUnit == "" || units.ValidWeightUnit(reg.PreferredUnit), "preferred_unit", "preferred_unit must be kg or lb")
+
+	return v.Err()
 }
 
 func (h *UserHandler) HandleRegisterUser(w http.ResponseWriter, r *http.Request) {
 	var req registerUserRequest
 	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
-		h.logger.Printf("ERROR: decoding register request: %v", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		logging.FromContext(r.Context()).Error("decoding register request", "error", err)
+		problem.Write(w, r, problem.BadRequest("invalid request payload"))
 		return
 	}
 
 	err = h.validateRegisterRequest(&req)
 	if err != nil {
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		problem.Write(w, r, problem.Unprocessable(err))
 		return
 	}
 
 	user := &store.User{
-		Username: req.Username,
-		Email:    req.Email,
+		Username:      req.Username,
+		Email:         req.Email,
+		PreferredUnit: req.PreferredUnit,
 	}
 
 	if req.Bio != "" {
@@ -80,19 +83,58 @@ func (h *UserHandler) HandleRegisterUser(w http.ResponseWriter, r *http.Request)
 
 	err = user.Password.Set(req.Password)
 	if err != nil {
-		h.logger.Printf("ERROR: hashing password %v", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to hash password"})
+		logging.FromContext(r.Context()).Error("hashing password", "error", err)
+		problem.Write(w, r, problem.Internal(err, "failed to hash password"))
 		return
 	}
 
 	user.PasswordHash = user.Password.Hash
 
-	err = h.userStore.CreateUser(user)
+	err = h.userStore.CreateUser(r.Context(), user)
 	if err != nil {
-		h.logger.Printf("ERROR: creating user %v", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to create user"})
+		logging.FromContext(r.Context()).Error("creating user", "error", err)
+		problem.Write(w, r, problem.Internal(err, "failed to create user"))
 		return
 	}
 
 	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"user": user})
 }
+
+func (h *UserHandler) HandleUpdateCurrentUser(w http.ResponseWriter, r *http.Request) {
+	var req updateUserRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("decoding update user request", "error", err)
+		problem.Write(w, r, problem.BadRequest("invalid request payload"))
+		return
+	}
+
+	v := validator.New()
+	v.Check(req.PreferredUnit == nil || units.ValidWeightUnit(*req.PreferredUnit), "preferred_unit", "preferred_unit must be kg or lb")
+	v.Check(req.BodyWeightKg == nil || (*req.BodyWeightKg > 0 && *req.BodyWeightKg <= 500), "body_weight_kg", "body_weight_kg must be between 0 and 500")
+	if !v.Valid() {
+		problem.Write(w, r, problem.Unprocessable(v))
+		return
+	}
+
+	user := middleware.GetUser(r)
+
+	if req.Bio != nil {
+		user.Bio = *req.Bio
+	}
+	if req.PreferredUnit != nil {
+		user.PreferredUnit = *req.PreferredUnit
+	}
+	if req.BodyWeightKg != nil {
+		user.BodyWeightKg = req.BodyWeightKg
+	}
+
+	err = h.userStore.UpdateUser(r.Context(), user)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("updating user", "error", err)
+		problem.Write(w, r, problem.Internal(err, "failed to update user"))
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"user": user})
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cykj40/beginner_go/internal/middleware"
+	"github.com/cykj40/beginner_go/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type fakeUserStore struct {
+	store.UserStore
+	updated *store.User
+}
+
+func (f *fakeUserStore) UpdateUser(ctx context.Context, user *store.User) error {
+	f.updated = user
+	return nil
+}
+
+func TestHandleUpdateCurrentUserHidesPassword(t *testing.T) {
+	store.SetBcryptCost(bcrypt.MinCost)
+	user := &store.User{ID: 7, Username: "sam", Email: "sam@example.com", PreferredUnit: "kg"}
+	require.NoError(t, user.Password.Set("correct horse battery"))
+	user.PasswordHash = user.Password.Hash
+
+	userStore := &fakeUserStore{}
+	h := NewUserHandler(userStore)
+
+	r := httptest.NewRequest(http.MethodPatch, "/users/me", strings.NewReader(`{"bio":"lifts","preferred_unit":"lb"}`))
+	r = middleware.SetUser(r, user)
+	w := httptest.NewRecorder()
+	h.HandleUpdateCurrentUser(w, r)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NotNil(t, userStore.updated)
+
+	body := w.Body.String()
+	assert.Contains(t, body, `"username":"sam"`)
+	assert.Contains(t, body, `"preferred_unit":"lb"`)
+	assert.NotContains(t, body, base64.StdEncoding.EncodeToString(user.PasswordHash))
+	assert.NotContains(t, strings.ToLower(body), "password")
+	assert.NotContains(t, strings.ToLower(body), "hash")
+}
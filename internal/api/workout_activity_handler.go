@@ -0,0 +1,196 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/cykj40/beginner_go/internal/activity"
+	"github.com/cykj40/beginner_go/internal/logging"
+	"github.com/cykj40/beginner_go/internal/middleware"
+	"github.com/cykj40/beginner_go/internal/problem"
+	"github.com/cykj40/beginner_go/internal/utils"
+
+	"github.com/cykj40/beginner_go/internal/store"
+)
+
+const maxActivityBytes = 25 << 20
+
+var activityContentTypes = map[string]string{
+	activity.FormatGPX: "application/gpx+xml",
+	activity.FormatTCX: "application/vnd.garmin.tcx+xml",
+	activity.FormatFIT: "application/vnd.ant.fit",
+}
+
+// HandleImportActivity creates a workout from a GPX, TCX or FIT recording.
+// The file is sent either as the "file" field of a multipart form or as the
+// raw request body; "format", "title" and "timezone" are optional form
+// fields or query parameters.
+func (wh *WorkoutHandler) HandleImportActivity(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+	r.Body = http.MaxBytesReader(w, r.Body, maxActivityBytes)
+
+	var source io.Reader = r.Body
+	filename := r.URL.Query().Get("filename")
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		err := r.ParseMultipartForm(maxActivityBytes)
+		if err != nil {
+			problem.Write(w, r, problem.BadRequest("invalid multipart form"))
+			return
+		}
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			problem.Write(w, r, problem.BadRequest("file field is required"))
+			return
+		}
+		defer file.Close()
+		source = file
+		filename = header.Filename
+	}
+
+	data, err := io.ReadAll(source)
+	if err != nil {
+		problem.Write(w, r, problem.PayloadTooLarge("activity file is too large"))
+		return
+	}
+
+	format := strings.ToLower(r.FormValue("format"))
+	if format == "" {
+		format = activity.DetectFormat(filename, data)
+	}
+
+	track, err := activity.Parse(format, data)
+	if err != nil {
+		problem.Write(w, r, problem.BadRequest(err.Error()))
+		return
+	}
+
+	bodyWeightKg := 0.0
+	if currentUser.BodyWeightKg != nil {
+		bodyWeightKg = *currentUser.BodyWeightKg
+	}
+
+	summary := track.Summarize(bodyWeightKg)
+	workout := activityWorkout(track, summary, r.FormValue("title"))
+	workout.UserID = int(currentUser.ID)
+	workout.Timezone = r.FormValue("timezone")
+
+	err = wh.validateWorkout(workout)
+	if err != nil {
+		problem.Write(w, r, problem.Unprocessable(err))
+		return
+	}
+
+	record := &store.WorkoutActivity{
+		Format:              format,
+		Filename:            filename,
+		RawData:             data,
+		Sport:               track.Sport,
+		DistanceMeters:      &summary.DistanceMeters,
+		ElevationGainMeters: &summary.ElevationGainMeters,
+		AvgHeartRate:        summary.AvgHeartRate,
+		MaxHeartRate:        summary.MaxHeartRate,
+	}
+
+	createdWorkout, err := wh.workoutStore.CreateWorkoutWithActivity(r.Context(), workout, record)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("createWorkoutWithActivity", "error", err)
+		problem.Write(w, r, problem.Internal(err, "failed to import activity"))
+		return
+	}
+
+	events := wh.goalEvents(r.Context(), createdWorkout)
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"workout": createdWorkout, "summary": summary, "goal_events": events})
+}
+
+func (wh *WorkoutHandler) HandleGetWorkoutActivity(w http.ResponseWriter, r *http.Request) {
+	workoutID, err := utils.ReadIDParam(r)
+	if err != nil {
+		problem.Write(w, r, problem.BadRequest("invalid workout id"))
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	workoutOwner, err := wh.workoutStore.GetWorkoutOwner(r.Context(), workoutID)
+	if err == sql.ErrNoRows {
+		problem.Write(w, r, problem.NotFound("workout not found"))
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("getWorkoutOwner", "error", err)
+		problem.Write(w, r, problem.Internal(err, "internal server error"))
+		return
+	}
+	if workoutOwner != int(currentUser.ID) {
+		problem.Write(w, r, problem.Forbidden("you can only download your own activities"))
+		return
+	}
+
+	record, err := wh.workoutStore.GetWorkoutActivity(r.Context(), workoutID)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("getWorkoutActivity", "error", err)
+		problem.Write(w, r, problem.Internal(err, "internal server error"))
+		return
+	}
+	if record == nil {
+		problem.Write(w, r, problem.NotFound("workout has no activity file"))
+		return
+	}
+
+	filename := record.Filename
+	if filename == "" {
+		filename = fmt.Sprintf("workout-%d.%s", record.WorkoutID, record.Format)
+	}
+
+	w.Header().Set("Content-Type", activityContentTypes[record.Format])
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+	w.Write(record.RawData)
+}
+
+// activityWorkout builds a single-entry workout from an imported track
+func activityWorkout(track *activity.Track, summary activity.Summary, title string) *store.Workout {
+	sport := "Activity"
+	if track.Sport != "" {
+		sport = strings.ToUpper(track.Sport[:1]) + strings.ToLower(track.Sport[1:])
+	}
+	if title == "" {
+		title = track.Name
+	}
+	if title == "" {
+		title = sport
+	}
+
+	endedAt := summary.EndedAt
+	duration := summary.DurationSeconds
+	distanceKm := math.Round(summary.DistanceMeters) / 1000
+	distanceUnit := "km"
+	elevation := summary.ElevationGainMeters
+	return &store.Workout{
+		Title:             title,
+		Description:       fmt.Sprintf("Imported from %s", strings.ToUpper(track.Format)),
+		DurationMinutes:   int(math.Round(float64(duration) / 60)),
+		CaloriesBurned:    summary.Calories,
+		CaloriesEstimated: summary.CaloriesEstimated,
+		StartedAt:         summary.StartedAt,
+		EndedAt:           &endedAt,
+		Entries: []store.WorkoutEntry{
+			{
+				ExerciseName:        sport,
+				MeasurementType:     store.MeasurementDistance,
+				Sets:                1,
+				DurationSeconds:     &duration,
+				Distance:            &distanceKm,
+				DistanceUnit:        &distanceUnit,
+				AvgHeartRate:        summary.AvgHeartRate,
+				MaxHeartRate:        summary.MaxHeartRate,
+				ElevationGainMeters: &elevation,
+				OrderIndex:          1,
+			},
+		},
+	}
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/cykj40/beginner_go/internal/logging"
+	"github.com/cykj40/beginner_go/internal/middleware"
+	"github.com/cykj40/beginner_go/internal/problem"
+	"github.com/cykj40/beginner_go/internal/units"
+	"github.com/cykj40/beginner_go/internal/utils"
+	"github.com/cykj40/beginner_go/internal/workoutcsv"
+
+	"github.com/cykj40/beginner_go/internal/store"
+)
+
+const maxImportBytes = 10 << 20
+
+func (wh *WorkoutHandler) HandleExportWorkouts(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	filter, err := readWorkoutFilter(r)
+	if err != nil {
+		problem.Write(w, r, problem.BadRequest(err.Error()))
+		return
+	}
+
+	unit, err := readWeightUnit(r)
+	if err != nil {
+		problem.Write(w, r, problem.BadRequest(err.Error()))
+		return
+	}
+
+	workouts, err := wh.workoutStore.ListWorkouts(r.Context(), currentUser.ID, filter)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("listWorkouts", "error", err)
+		problem.Write(w, r, problem.Internal(err, "internal server error"))
+		return
+	}
+
+	for i := range workouts {
+		workouts[i].ConvertWeights(unit)
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="workouts.csv"`)
+	err = workoutcsv.Export(w, workouts)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("exporting workouts csv", "error", err)
+	}
+}
+
+// HandleImportWorkouts accepts either a multipart form with a "file" field
+// or a raw text/csv body. The "mapping" (a JSON object of field name to CSV
+// header) and "dry_run" options are read from form fields or the query string.
+func (wh *WorkoutHandler) HandleImportWorkouts(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+
+	var source io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		err := r.ParseMultipartForm(maxImportBytes)
+		if err != nil {
+			problem.Write(w, r, problem.BadRequest("invalid multipart form"))
+			return
+		}
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			problem.Write(w, r, problem.BadRequest("file field is required"))
+			return
+		}
+		defer file.Close()
+		source = file
+	}
+
+	var mapping map[string]string
+	if raw := r.FormValue("mapping"); raw != "" {
+		err := json.Unmarshal([]byte(raw), &mapping)
+		if err != nil {
+			problem.Write(w, r, problem.BadRequest("mapping must be a JSON object of field names to CSV column names"))
+			return
+		}
+	}
+
+	dryRun := false
+	if raw := r.FormValue("dry_run"); raw != "" {
+		var err error
+		dryRun, err = strconv.ParseBool(raw)
+		if err != nil {
+			problem.Write(w, r, problem.BadRequest("dry_run must be true or false"))
+			return
+		}
+	}
+
+	parsed, rowErrors, err := workoutcsv.Import(source, mapping)
+	if err != nil {
+		problem.Write(w, r, problem.BadRequest(err.Error()))
+		return
+	}
+
+	workouts := make([]*store.Workout, 0, len(parsed))
+	for _, p := range parsed {
+		p.Workout.UserID = int(currentUser.ID)
+		applyPreferredUnit(p.Workout, currentUser)
+		err = wh.validateWorkout(p.Workout)
+		if err != nil {
+			rowErrors = append(rowErrors, workoutcsv.RowError{Row: p.Row, Message: err.Error()})
+			continue
+		}
+		estimateCalories(p.Workout, currentUser)
+		workouts = append(workouts, p.Workout)
+	}
+
+	if rowErrors == nil {
+		rowErrors = []workoutcsv.RowError{}
+	}
+
+	if dryRun {
+		utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+			"dry_run":  true,
+			"valid":    len(rowErrors) == 0,
+			"workouts": len(parsed),
+			"errors":   rowErrors,
+		})
+		return
+	}
+
+	if len(rowErrors) > 0 {
+		perr := problem.Invalid(fmt.Sprintf("%d row(s) failed validation, nothing was imported", len(rowErrors)))
+		perr.Errors = map[string][]string{}
+		for _, rowErr := range rowErrors {
+			key := fmt.Sprintf("rows[%d]", rowErr.Row)
+			if rowErr.Field != "" {
+				key += "." + rowErr.Field
+			}
+			perr.Errors[key] = append(perr.Errors[key], rowErr.Message)
+		}
+		problem.Write(w, r, perr)
+		return
+	}
+
+	err = wh.workoutStore.CreateWorkouts(r.Context(), workouts)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("createWorkouts", "error", err)
+		problem.Write(w, r, problem.Internal(err, "failed to import workouts"))
+		return
+	}
+
+	events := wh.goalEvents(r.Context(), workouts...)
+
+	unit, err := readWeightUnit(r)
+	if err != nil {
+		unit = units.Kilograms
+	}
+	for _, workout := range workouts {
+		workout.ConvertWeights(unit)
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"imported": len(workouts), "workouts": workouts, "goal_events": events})
+}
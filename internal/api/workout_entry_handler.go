@@ -0,0 +1,306 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/cykj40/beginner_go/internal/jsonpatch"
+	"github.com/cykj40/beginner_go/internal/logging"
+	"github.com/cykj40/beginner_go/internal/middleware"
+	"github.com/cykj40/beginner_go/internal/problem"
+	"github.com/cykj40/beginner_go/internal/store"
+	"github.com/cykj40/beginner_go/internal/units"
+	"github.com/cykj40/beginner_go/internal/utils"
+	"github.com/go-chi/chi/v5"
+)
+
+// loadWorkoutForEntryChange loads the workout named in the URL for an
+// entry-level write, checking ownership and If-Match. It writes the error
+// response itself and returns nil when the write cannot go ahead.
+func (wh *WorkoutHandler) loadWorkoutForEntryChange(w http.ResponseWriter, r *http.Request) *store.Workout {
+	workoutID, ok := wh.readOwnedWorkoutID(w, r)
+	if !ok {
+		return nil
+	}
+
+	workout, err := wh.workoutStore.GetWorkoutByID(r.Context(), workoutID)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("getWorkoutByID", "error", err)
+		problem.Write(w, r, problem.Internal(err, "internal server error"))
+		return nil
+	}
+	if workout == nil {
+		problem.Write(w, r, problem.NotFound("workout not found"))
+		return nil
+	}
+
+	if !wh.checkIfMatch(w, r, workout.Version) {
+		return nil
+	}
+
+	for i := range workout.Groups {
+		workout.Groups[i].Entries = nil
+	}
+	return workout
+}
+
+// saveEntryChange renumbers, validates and stores a workout after one of
+// its entries changed. It reports whether the save succeeded, having
+// written the error response when not.
+func (wh *WorkoutHandler) saveEntryChange(w http.ResponseWriter, r *http.Request, workout *store.Workout) bool {
+	workout.RenumberEntries()
+
+	currentUser := middleware.GetUser(r)
+	applyPreferredUnit(workout, currentUser)
+	err := wh.validateWorkout(workout)
+	if err != nil {
+		problem.Write(w, r, problem.Unprocessable(err))
+		return false
+	}
+
+	estimateCalories(workout, currentUser)
+
+	workout.Version = expectedVersion(r, workout.Version)
+	err = wh.workoutStore.UpdateWorkout(r.Context(), workout, currentUser.ID)
+	if errors.Is(err, store.ErrVersionConflict) {
+		problem.Write(w, r, problem.PreconditionFailed("workout has been modified since it was fetched"))
+		return false
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("updateWorkout", "error", err)
+		problem.Write(w, r, problem.Internal(err, "failed to update the workout"))
+		return false
+	}
+
+	wh.goalEvents(r.Context(), workout)
+	w.Header().Set("ETag", workoutETag(workout.Version))
+	return true
+}
+
+func findEntry(workout *store.Workout, entryID int) int {
+	for i, entry := range workout.Entries {
+		if entry.ID == entryID {
+			return i
+		}
+	}
+	return -1
+}
+
+// moveEntry moves the entry at index i to the 1-based position, clamped to
+// the ends of the list
+func moveEntry(workout *store.Workout, i, position int) {
+	entry := workout.Entries[i]
+	workout.Entries = append(workout.Entries[:i], workout.Entries[i+1:]...)
+
+	at := min(max(position-1, 0), len(workout.Entries))
+	workout.Entries = append(workout.Entries, store.WorkoutEntry{})
+	copy(workout.Entries[at+1:], workout.Entries[at:])
+	workout.Entries[at] = entry
+
+	for j := range workout.Entries {
+		workout.Entries[j].OrderIndex = j + 1
+	}
+}
+
+func (wh *WorkoutHandler) writeEntryResponse(w http.ResponseWriter, r *http.Request, status int, workout *store.Workout, entryID int) {
+	unit, err := readWeightUnit(r)
+	if err != nil {
+		unit = units.Kilograms
+	}
+	workout.ConvertWeights(unit)
+
+	i := findEntry(workout, entryID)
+	if i < 0 {
+		utils.WriteJSON(w, status, utils.Envelope{"workout": workout})
+		return
+	}
+	utils.WriteJSON(w, status, utils.Envelope{"entry": workout.Entries[i], "workout": workout})
+}
+
+// HandleCreateWorkoutEntry adds one entry to a workout without touching the
+// IDs of the others. order_index picks the 1-based position to insert at;
+// when omitted the entry is appended.
+func (wh *WorkoutHandler) HandleCreateWorkoutEntry(w http.ResponseWriter, r *http.Request) {
+	workout := wh.loadWorkoutForEntryChange(w, r)
+	if workout == nil {
+		return
+	}
+
+	var entry store.WorkoutEntry
+	err := json.NewDecoder(r.Body).Decode(&entry)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("decodingCreateWorkoutEntry", "error", err)
+		problem.Write(w, r, problem.BadRequest("invalid request sent"))
+		return
+	}
+
+	entry.ID = 0
+	position := entry.OrderIndex
+	if position <= 0 {
+		position = len(workout.Entries) + 1
+	}
+
+	workout.RenumberEntries()
+	workout.Entries = append(workout.Entries, entry)
+	moveEntry(workout, len(workout.Entries)-1, position)
+	at := min(position, len(workout.Entries)) - 1
+
+	if !wh.saveEntryChange(w, r, workout) {
+		return
+	}
+
+	wh.writeEntryResponse(w, r, http.StatusCreated, workout, workout.Entries[at].ID)
+}
+
+// HandlePatchWorkoutEntry merge-patches a single entry in place. Changing
+// order_index moves the entry to that position.
+func (wh *WorkoutHandler) HandlePatchWorkoutEntry(w http.ResponseWriter, r *http.Request) {
+	entryID, err := strconv.Atoi(chi.URLParam(r, "entryID"))
+	if err != nil {
+		problem.Write(w, r, problem.BadRequest("invalid entry id"))
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		problem.Write(w, r, problem.BadRequest("invalid request sent"))
+		return
+	}
+	var patch interface{}
+	err = json.Unmarshal(body, &patch)
+	if _, isObject := patch.(map[string]interface{}); err != nil || !isObject {
+		problem.Write(w, r, problem.BadRequest("an entry patch must be a JSON object"))
+		return
+	}
+
+	unit, err := readWeightUnit(r)
+	if err != nil {
+		problem.Write(w, r, problem.BadRequest(err.Error()))
+		return
+	}
+
+	workout := wh.loadWorkoutForEntryChange(w, r)
+	if workout == nil {
+		return
+	}
+
+	workout.RenumberEntries()
+	i := findEntry(workout, entryID)
+	if i < 0 {
+		problem.Write(w, r, problem.NotFound("entry not found"))
+		return
+	}
+
+	workout.ConvertWeights(unit)
+	raw, err := json.Marshal(workout.Entries[i])
+	if err != nil {
+		logging.FromContext(r.Context()).Error("marshalEntry", "error", err)
+		problem.Write(w, r, problem.Internal(err, "internal server error"))
+		return
+	}
+	var doc interface{}
+	_ = json.Unmarshal(raw, &doc)
+
+	raw, err = json.Marshal(jsonpatch.MergePatch(doc, patch))
+	if err != nil {
+		logging.FromContext(r.Context()).Error("marshalPatchedEntry", "error", err)
+		problem.Write(w, r, problem.Internal(err, "internal server error"))
+		return
+	}
+
+	var patched store.WorkoutEntry
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(&patched)
+	if err != nil {
+		problem.Write(w, r, problem.Invalid("patched entry is invalid: "+err.Error()))
+		return
+	}
+
+	patched.ID = entryID
+	position := patched.OrderIndex
+	workout.Entries[i] = patched
+	if position != i+1 {
+		moveEntry(workout, i, position)
+	}
+
+	if !wh.saveEntryChange(w, r, workout) {
+		return
+	}
+
+	wh.writeEntryResponse(w, r, http.StatusOK, workout, entryID)
+}
+
+func (wh *WorkoutHandler) HandleDeleteWorkoutEntry(w http.ResponseWriter, r *http.Request) {
+	entryID, err := strconv.Atoi(chi.URLParam(r, "entryID"))
+	if err != nil {
+		problem.Write(w, r, problem.BadRequest("invalid entry id"))
+		return
+	}
+
+	workout := wh.loadWorkoutForEntryChange(w, r)
+	if workout == nil {
+		return
+	}
+
+	i := findEntry(workout, entryID)
+	if i < 0 {
+		problem.Write(w, r, problem.NotFound("entry not found"))
+		return
+	}
+	workout.Entries = append(workout.Entries[:i], workout.Entries[i+1:]...)
+
+	if !wh.saveEntryChange(w, r, workout) {
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+// HandleReorderWorkoutEntries takes {"entry_ids": [...]}, every entry of the
+// workout exactly once, and renumbers order_index to match
+func (wh *WorkoutHandler) HandleReorderWorkoutEntries(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		EntryIDs []int `json:"entry_ids"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		problem.Write(w, r, problem.BadRequest("invalid request sent"))
+		return
+	}
+
+	workout := wh.loadWorkoutForEntryChange(w, r)
+	if workout == nil {
+		return
+	}
+
+	if len(req.EntryIDs) != len(workout.Entries) {
+		problem.Write(w, r, problem.Invalid("entry_ids must list every entry of the workout exactly once"))
+		return
+	}
+
+	reordered := make([]store.WorkoutEntry, 0, len(req.EntryIDs))
+	seen := map[int]bool{}
+	for _, id := range req.EntryIDs {
+		i := findEntry(workout, id)
+		if i < 0 || seen[id] {
+			problem.Write(w, r, problem.Invalid("entry_ids must list every entry of the workout exactly once"))
+			return
+		}
+		seen[id] = true
+		entry := workout.Entries[i]
+		entry.OrderIndex = len(reordered) + 1
+		reordered = append(reordered, entry)
+	}
+	workout.Entries = reordered
+
+	if !wh.saveEntryChange(w, r, workout) {
+		return
+	}
+
+	wh.writeEntryResponse(w, r, http.StatusOK, workout, 0)
+}
@@ -1,127 +1,439 @@
 package api
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"math"
 	"net/http"
 	"strconv"
+	"time"
 
+	"github.com/cykj40/beginner_go/internal/calories"
+	"github.com/cykj40/beginner_go/internal/logging"
 	"github.com/cykj40/beginner_go/internal/middleware"
+	"github.com/cykj40/beginner_go/internal/problem"
+	"github.com/cykj40/beginner_go/internal/units"
 	"github.com/cykj40/beginner_go/internal/utils"
+	"github.com/cykj40/beginner_go/internal/validator"
 
 	"github.com/cykj40/beginner_go/internal/store"
 	"github.com/go-chi/chi/v5"
 )
 
 type WorkoutHandler struct {
-	workoutStore store.WorkoutStore
-	logger       *log.Logger
+	workoutStore   store.WorkoutStore
+	goalStore      store.GoalStore
+	requireIfMatch bool
 }
 
-func NewWorkoutHandler(workoutStore store.WorkoutStore, logger *log.Logger) *WorkoutHandler {
+func NewWorkoutHandler(workoutStore store.WorkoutStore, goalStore store.GoalStore, requireIfMatch bool) *WorkoutHandler {
 	return &WorkoutHandler{
-		workoutStore: workoutStore,
-		logger:       logger,
+		workoutStore:   workoutStore,
+		goalStore:      goalStore,
+		requireIfMatch: requireIfMatch,
 	}
 }
 
+// goalEvents records the goals completed by saved workouts. The workouts
+// are already stored, so a failure here is logged rather than returned.
+func (wh *WorkoutHandler) goalEvents(ctx context.Context, workouts ...*store.Workout) []store.GoalEvent {
+	events := []store.GoalEvent{}
+	for _, workout := range workouts {
+		created, err := recordGoalEvents(ctx, wh.goalStore, workout)
+		if err != nil {
+			logging.FromContext(ctx).Error("recordGoalEvents", "error", err)
+			continue
+		}
+		events = append(events, created...)
+	}
+	return events
+}
+
+// durationToleranceMinutes is how far duration_minutes may drift from the
+// started_at/ended_at interval, to allow for rounding on the client
+const durationToleranceMinutes = 1
+
+func (wh *WorkoutHandler) validateWorkout(workout *store.Workout) error {
+	v := validator.New()
+
+	v.Check(validator.NotBlank(workout.Title), "title", "title is required")
+	v.Check(validator.MaxChars(workout.Title, 255), "title", "title cannot be greater than 255 characters")
+	v.Check(workout.DurationMinutes >= 0, "duration_minutes", "duration_minutes cannot be negative")
+	v.Check(workout.CaloriesBurned >= 0, "calories_burned", "calories_burned cannot be negative")
+
+	if workout.Timezone == "" {
+		workout.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(workout.Timezone); err != nil {
+		v.Add("timezone", "timezone must be a valid IANA timezone name")
+	}
+
+	// weights are only normalised once every unit is known to be valid
+	for i, entry := range workout.Entries {
+		v.Check(entry.WeightUnit == "" || units.ValidWeightUnit(entry.WeightUnit), fmt.Sprintf("entries[%d].weight_unit", i), "weight_unit must be kg or lb")
+	}
+	if v.Valid() {
+		err := workout.NormalizeWeights()
+		if err != nil {
+			return err
+		}
+	}
+
+	for i := range workout.Entries {
+		validateWorkoutEntry(v.Scope(fmt.Sprintf("entries[%d].", i)), &workout.Entries[i])
+	}
+
+	err := workout.ValidateGroups()
+	if err != nil {
+		v.Add("groups", err.Error())
+	}
+
+	if workout.EndedAt != nil {
+		validateWorkoutInterval(v, workout)
+	}
+
+	return v.Err()
+}
+
+func validateWorkoutInterval(v *validator.Validator, workout *store.Workout) {
+	if workout.StartedAt.IsZero() {
+		v.Add("started_at", "started_at is required when ended_at is set")
+		return
+	}
+	if workout.EndedAt.Before(workout.StartedAt) {
+		v.Add("ended_at", "ended_at cannot be before started_at")
+		return
+	}
+
+	// derive the duration from the interval when the client left it out
+	intervalMinutes := int(math.Round(workout.EndedAt.Sub(workout.StartedAt).Minutes()))
+	if workout.DurationMinutes == 0 {
+		workout.DurationMinutes = intervalMinutes
+		return
+	}
+
+	diff := workout.DurationMinutes - intervalMinutes
+	if diff > durationToleranceMinutes || diff < -durationToleranceMinutes {
+		v.Add("duration_minutes", fmt.Sprintf("duration_minutes (%d) does not match the started_at/ended_at interval (%d minutes)", workout.DurationMinutes, intervalMinutes))
+	}
+}
+
+func validateWorkoutEntry(v *validator.Validator, entry *store.WorkoutEntry) {
+	v.Check(validator.NotBlank(entry.ExerciseName), "exercise_name", "exercise_name is required")
+	v.Check(validator.MaxChars(entry.ExerciseName, 255), "exercise_name", "exercise_name cannot be greater than 255 characters")
+	v.Check(entry.Sets >= 0, "sets", "sets cannot be negative")
+	v.Check(entry.Reps == nil || *entry.Reps >= 0, "reps", "reps cannot be negative")
+	v.Check(entry.DurationSeconds == nil || *entry.DurationSeconds >= 0, "duration_seconds", "duration_seconds cannot be negative")
+	v.Check(entry.Weight == nil || *entry.Weight >= 0, "weight", "weight cannot be negative")
+	v.Check(entry.Reps == nil || entry.DurationSeconds == nil || len(entry.SetDetails) > 0, "duration_seconds", "reps and duration_seconds cannot both be set")
+
+	for _, field := range []struct {
+		name  string
+		value *int
+	}{{"avg_heart_rate", entry.AvgHeartRate}, {"max_heart_rate", entry.MaxHeartRate}} {
+		v.Check(field.value == nil || validator.Between(*field.value, 20, 250), field.name, field.name+" must be between 20 and 250 bpm")
+	}
+	if entry.AvgHeartRate != nil && entry.MaxHeartRate != nil && *entry.AvgHeartRate > *entry.MaxHeartRate {
+		v.Add("avg_heart_rate", "avg_heart_rate cannot be greater than max_heart_rate")
+	}
+	v.Check(entry.RPE == nil || validator.Between(*entry.RPE, 1, 10), "rpe", "rpe must be between 1 and 10")
+	v.Check(entry.Distance == nil || *entry.Distance >= 0, "distance", "distance cannot be negative")
+	v.Check(entry.DistanceUnit == nil || entry.Distance != nil, "distance_unit", "distance_unit cannot be set without distance")
+	v.Check(entry.ElevationGainMeters == nil || *entry.ElevationGainMeters >= 0, "elevation_gain_meters", "elevation_gain_meters cannot be negative")
+	v.Check(entry.Cadence == nil || *entry.Cadence >= 0, "cadence", "cadence cannot be negative")
+
+	err := entry.SummarizeSets()
+	if err != nil {
+		v.Add("set_details", err.Error())
+		return
+	}
+
+	// the measurement type is inferred from the fields checked above, so
+	// its rules only add something when those passed
+	if v.HasPrefix() {
+		return
+	}
+	err = entry.ResolveMeasurementType()
+	if err != nil {
+		v.Add("measurement_type", err.Error())
+		return
+	}
+
+	for i, set := range entry.SetDetails {
+		if entry.MeasurementType == store.MeasurementReps && set.Reps == nil {
+			v.Add(fmt.Sprintf("set_details[%d].reps", i), "reps is required for reps entries")
+		}
+		if entry.MeasurementType == store.MeasurementDuration && set.DurationSeconds == nil {
+			v.Add(fmt.Sprintf("set_details[%d].duration_seconds", i), "duration_seconds is required for duration entries")
+		}
+	}
+}
+
+// estimateCalories fills in calories_burned from the exercise catalog and
+// the user's body weight unless the client supplied the value, which is
+// kept even when it is 0
+func estimateCalories(workout *store.Workout, user *store.User) {
+	if !workout.CaloriesEstimated {
+		return
+	}
+
+	bodyWeightKg := 0.0
+	if user.BodyWeightKg != nil {
+		bodyWeightKg = *user.BodyWeightKg
+	}
+	workout.CaloriesBurned = calories.Estimate(workout, bodyWeightKg)
+	workout.CaloriesEstimated = true
+}
+
+// parseTimeParam accepts RFC 3339 timestamps or plain dates, which are
+// interpreted as midnight in loc
+func parseTimeParam(value string, loc *time.Location) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, loc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time %q, expected RFC 3339 or YYYY-MM-DD", value)
+	}
+	return &t, nil
+}
+
+// readWorkoutFilter reads the from, to, tz and sort query parameters shared
+// by the workout listing endpoints
+func readWorkoutFilter(r *http.Request) (store.WorkoutFilter, error) {
+	query := r.URL.Query()
+	filter := store.WorkoutFilter{Sort: query.Get("sort")}
+
+	loc := time.UTC
+	if tz := query.Get("tz"); tz != "" {
+		var err error
+		loc, err = time.LoadLocation(tz)
+		if err != nil {
+			return filter, errors.New("invalid tz parameter")
+		}
+	}
+
+	var err error
+	filter.From, err = parseTimeParam(query.Get("from"), loc)
+	if err != nil {
+		return filter, err
+	}
+
+	filter.To, err = parseTimeParam(query.Get("to"), loc)
+	if err != nil {
+		return filter, err
+	}
+
+	if !store.ValidWorkoutSort(filter.Sort) {
+		return filter, errors.New("sort must be started_at or -started_at")
+	}
+
+	return filter, nil
+}
+
+// applyPreferredUnit takes entry weights sent without a weight_unit to be in
+// the user's preferred unit rather than kilograms
+func applyPreferredUnit(workout *store.Workout, user *store.User) {
+	if user.IsAnonymous() || user.PreferredUnit == "" {
+		return
+	}
+	for i := range workout.Entries {
+		if workout.Entries[i].WeightUnit == "" {
+			workout.Entries[i].WeightUnit = user.PreferredUnit
+		}
+	}
+}
+
+// readWeightUnit picks the unit weights are returned in: an explicit
+// ?units= parameter wins over the user's preferred unit
+func readWeightUnit(r *http.Request) (string, error) {
+	if unit := r.URL.Query().Get("units"); unit != "" {
+		if !units.ValidWeightUnit(unit) {
+			return "", errors.New("units must be kg or lb")
+		}
+		return unit, nil
+	}
+
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() || user.PreferredUnit == "" {
+		return units.Kilograms, nil
+	}
+	return user.PreferredUnit, nil
+}
+
+func (wh *WorkoutHandler) HandleListWorkouts(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	filter, err := readWorkoutFilter(r)
+	if err != nil {
+		problem.Write(w, r, problem.BadRequest(err.Error()))
+		return
+	}
+
+	unit, err := readWeightUnit(r)
+	if err != nil {
+		problem.Write(w, r, problem.BadRequest(err.Error()))
+		return
+	}
+
+	workouts, err := wh.workoutStore.ListWorkouts(r.Context(), currentUser.ID, filter)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("listWorkouts", "error", err)
+		problem.Write(w, r, problem.Internal(err, "internal server error"))
+		return
+	}
+
+	for i := range workouts {
+		workouts[i].ConvertWeights(unit)
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workouts": workouts})
+}
+
 func (wh *WorkoutHandler) HandleGetWorkoutByID(w http.ResponseWriter, r *http.Request) {
 	workoutID, err := utils.ReadIDParam(r)
 	if err != nil {
-		wh.logger.Printf("ERROR: getWorkoutByID: %v", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		problem.Write(w, r, problem.BadRequest("invalid workout id"))
+		return
+	}
+
+	unit, err := readWeightUnit(r)
+	if err != nil {
+		problem.Write(w, r, problem.BadRequest(err.Error()))
 		return
 	}
 
-	workout, err := wh.workoutStore.GetWorkoutByID(workoutID)
+	workout, err := wh.workoutStore.GetWorkoutByID(r.Context(), workoutID)
 	if err != nil {
-		fmt.Println(err)
-		http.Error(w, "failed to get workout", http.StatusNotFound)
+		logging.FromContext(r.Context()).Error("getWorkoutByID", "error", err)
+		problem.Write(w, r, problem.Internal(err, "failed to get workout"))
+		return
+	}
+	if workout == nil {
+		problem.Write(w, r, problem.NotFound("workout not found"))
 		return
 	}
 
+	w.Header().Set("ETag", workoutETag(workout.Version))
+	if ifNoneMatchHits(r, workout.Version) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	workout.ConvertWeights(unit)
+
 	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workout": workout})
 }
 
 func (wh *WorkoutHandler) HandleCreateWorkout(w http.ResponseWriter, r *http.Request) {
-	var workout store.Workout
-	err := json.NewDecoder(r.Body).Decode(&workout)
+	// calories_burned is decoded separately to tell an explicit 0 from
+	// an omitted value
+	var req struct {
+		store.Workout
+		CaloriesBurned *int `json:"calories_burned"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
-		wh.logger.Printf("ERROR: decodingCreateWorkout: %v", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "invalid request sent"})
+		problem.Write(w, r, problem.BadRequest("invalid request sent"))
 		return
 	}
+	workout := req.Workout
+	workout.CaloriesEstimated = req.CaloriesBurned == nil
+	if req.CaloriesBurned != nil {
+		workout.CaloriesBurned = *req.CaloriesBurned
+	}
 
 	currentUser := middleware.GetUser(r)
 	if currentUser == nil || currentUser == store.AnonymousUser {
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "you must be logged in"})
+		problem.Write(w, r, problem.BadRequest("you must be logged in"))
 		return
 	}
 
 	workout.UserID = int(currentUser.ID)
+	applyPreferredUnit(&workout, currentUser)
+
+	err = wh.validateWorkout(&workout)
+	if err != nil {
+		problem.Write(w, r, problem.Unprocessable(err))
+		return
+	}
 
-	createdWorkout, err := wh.workoutStore.CreateWorkout(&workout)
+	estimateCalories(&workout, currentUser)
+
+	createdWorkout, err := wh.workoutStore.CreateWorkout(r.Context(), &workout)
 	if err != nil {
-		wh.logger.Printf("ERROR: createWorkout: %v", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to create workout"})
+		logging.FromContext(r.Context()).Error("createWorkout", "error", err)
+		problem.Write(w, r, problem.Internal(err, "failed to create workout"))
 		return
 	}
 
-	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"workout": createdWorkout})
+	events := wh.goalEvents(r.Context(), createdWorkout)
+
+	unit, err := readWeightUnit(r)
+	if err != nil {
+		unit = units.Kilograms
+	}
+	createdWorkout.ConvertWeights(unit)
+
+	w.Header().Set("ETag", workoutETag(createdWorkout.Version))
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"workout": createdWorkout, "goal_events": events})
 }
 
 func (wh *WorkoutHandler) HandleUpdateWorkout(w http.ResponseWriter, r *http.Request) {
 	workoutID, err := utils.ReadIDParam(r)
 	if err != nil {
-		wh.logger.Printf("ERROR: readIDParam: %v", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "invalid workout update id"})
+		problem.Write(w, r, problem.BadRequest("invalid workout update id"))
 		return
 	}
 
-	existingWorkout, err := wh.workoutStore.GetWorkoutByID(workoutID)
+	existingWorkout, err := wh.workoutStore.GetWorkoutByID(r.Context(), workoutID)
 	if err != nil {
-		wh.logger.Printf("ERROR: getWorkoutByID: %v", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		logging.FromContext(r.Context()).Error("getWorkoutByID", "error", err)
+		problem.Write(w, r, problem.Internal(err, "internal server error"))
 		return
 	}
 
 	if existingWorkout == nil {
-		wh.logger.Printf("ERROR: getWorkoutByID: %v", err)
-		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout not found"})
+		logging.FromContext(r.Context()).Error("getWorkoutByID", "error", err)
+		problem.Write(w, r, problem.NotFound("workout not found"))
 		return
 	}
 
 	// Read the entire request body
 	var requestBody map[string]interface{}
 	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
-		wh.logger.Printf("ERROR: decodingUpdateWorkout: %v", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request sent"})
+		logging.FromContext(r.Context()).Error("decodingUpdateWorkout", "error", err)
+		problem.Write(w, r, problem.BadRequest("invalid request sent"))
 		return
 	}
 
 	currentUser := middleware.GetUser(r)
 	if currentUser == nil || currentUser == store.AnonymousUser {
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "you must be logged in to update a workout"})
+		problem.Write(w, r, problem.BadRequest("you must be logged in to update a workout"))
 		return
 	}
 
-	workoutOwner, err := wh.workoutStore.GetWorkoutOwner(workoutID)
+	workoutOwner, err := wh.workoutStore.GetWorkoutOwner(r.Context(), workoutID)
 	if err != nil {
-		wh.logger.Printf("ERROR: getWorkoutOwner: %v", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		logging.FromContext(r.Context()).Error("getWorkoutOwner", "error", err)
+		problem.Write(w, r, problem.Internal(err, "internal server error"))
 		return
 	}
 
 	if workoutOwner != int(currentUser.ID) {
-		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "you can only update your own workouts"})
+		problem.Write(w, r, problem.Forbidden("you can only update your own workouts"))
 		return
 	}
 
-	// Log the raw request for debugging
-	jsonBody, _ := json.Marshal(requestBody)
-	wh.logger.Printf("Received update request: %s", string(jsonBody))
+	if !wh.checkIfMatch(w, r, existingWorkout.Version) {
+		return
+	}
+	existingWorkout.Version = expectedVersion(r, existingWorkout.Version)
 
 	if title, ok := requestBody["title"].(string); ok {
 		existingWorkout.Title = title
@@ -135,8 +447,38 @@ func (wh *WorkoutHandler) HandleUpdateWorkout(w http.ResponseWriter, r *http.Req
 		existingWorkout.DurationMinutes = int(duration)
 	}
 
+	// without a new value an estimate is recomputed, the entries or
+	// duration may have changed
 	if calories, ok := requestBody["calories_burned"].(float64); ok {
 		existingWorkout.CaloriesBurned = int(calories)
+		existingWorkout.CaloriesEstimated = false
+	}
+
+	if startedAt, ok := requestBody["started_at"].(string); ok {
+		t, err := time.Parse(time.RFC3339, startedAt)
+		if err != nil {
+			problem.Write(w, r, problem.BadRequest("started_at must be an RFC 3339 timestamp"))
+			return
+		}
+		existingWorkout.StartedAt = t
+	}
+
+	if endedAt, ok := requestBody["ended_at"]; ok {
+		switch v := endedAt.(type) {
+		case nil:
+			existingWorkout.EndedAt = nil
+		case string:
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				problem.Write(w, r, problem.BadRequest("ended_at must be an RFC 3339 timestamp"))
+				return
+			}
+			existingWorkout.EndedAt = &t
+		}
+	}
+
+	if timezone, ok := requestBody["timezone"].(string); ok {
+		existingWorkout.Timezone = timezone
 	}
 
 	// Only update entries if provided in the request body
@@ -148,10 +490,19 @@ func (wh *WorkoutHandler) HandleUpdateWorkout(w http.ResponseWriter, r *http.Req
 			if entryMap, ok := entryData.(map[string]interface{}); ok {
 				entry := store.WorkoutEntry{}
 
+				// entries sent back with their ID are updated in place
+				if id, ok := entryMap["id"].(float64); ok {
+					entry.ID = int(id)
+				}
+
 				if name, ok := entryMap["exercise_name"].(string); ok {
 					entry.ExerciseName = name
 				}
 
+				if measurementType, ok := entryMap["measurement_type"].(string); ok {
+					entry.MeasurementType = measurementType
+				}
+
 				if sets, ok := entryMap["sets"].(float64); ok {
 					entry.Sets = int(sets)
 				}
@@ -170,29 +521,108 @@ func (wh *WorkoutHandler) HandleUpdateWorkout(w http.ResponseWriter, r *http.Req
 					entry.Weight = &weight
 				}
 
+				if unit, ok := entryMap["weight_unit"].(string); ok {
+					entry.WeightUnit = unit
+				}
+
+				if distance, ok := entryMap["distance"].(float64); ok {
+					entry.Distance = &distance
+				}
+
+				if unit, ok := entryMap["distance_unit"].(string); ok {
+					entry.DistanceUnit = &unit
+				}
+
+				if hr, ok := entryMap["avg_heart_rate"].(float64); ok {
+					hrInt := int(hr)
+					entry.AvgHeartRate = &hrInt
+				}
+
+				if hr, ok := entryMap["max_heart_rate"].(float64); ok {
+					hrInt := int(hr)
+					entry.MaxHeartRate = &hrInt
+				}
+
+				if elevation, ok := entryMap["elevation_gain_meters"].(float64); ok {
+					entry.ElevationGainMeters = &elevation
+				}
+
+				if cadence, ok := entryMap["cadence"].(float64); ok {
+					cadenceInt := int(cadence)
+					entry.Cadence = &cadenceInt
+				}
+
+				if rpe, ok := entryMap["rpe"].(float64); ok {
+					entry.RPE = &rpe
+				}
+
 				if notes, ok := entryMap["notes"].(string); ok {
 					entry.Notes = &notes
 				}
 
+				if setDetails, ok := entryMap["set_details"].([]interface{}); ok {
+					raw, _ := json.Marshal(setDetails)
+					if err := json.Unmarshal(raw, &entry.SetDetails); err != nil {
+						problem.Write(w, r, problem.BadRequest("invalid set_details"))
+						return
+					}
+				}
+
 				if index, ok := entryMap["order_index"].(float64); ok {
 					entry.OrderIndex = int(index)
 				}
 
+				if groupIndex, ok := entryMap["group_index"].(float64); ok {
+					groupIndexInt := int(groupIndex)
+					entry.GroupIndex = &groupIndexInt
+				}
+
 				existingWorkout.Entries = append(existingWorkout.Entries, entry)
 			}
 		}
 	} else {
-		fmt.Println("No entries provided in update, keeping existing entries")
+		logging.FromContext(r.Context()).Debug("no entries provided in update, keeping existing entries", "workout_id", existingWorkout.ID)
+	}
+
+	if groups, ok := requestBody["groups"].([]interface{}); ok {
+		raw, _ := json.Marshal(groups)
+		existingWorkout.Groups = nil
+		if err := json.Unmarshal(raw, &existingWorkout.Groups); err != nil {
+			problem.Write(w, r, problem.BadRequest("invalid groups"))
+			return
+		}
 	}
 
-	err = wh.workoutStore.UpdateWorkout(existingWorkout)
+	applyPreferredUnit(existingWorkout, currentUser)
+	err = wh.validateWorkout(existingWorkout)
 	if err != nil {
-		wh.logger.Printf("ERROR: updateWorkout: %v", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to update the workout"})
+		problem.Write(w, r, problem.Unprocessable(err))
 		return
 	}
 
-	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workout": existingWorkout})
+	estimateCalories(existingWorkout, currentUser)
+
+	err = wh.workoutStore.UpdateWorkout(r.Context(), existingWorkout, currentUser.ID)
+	if errors.Is(err, store.ErrVersionConflict) {
+		problem.Write(w, r, problem.PreconditionFailed("workout has been modified since it was fetched"))
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("updateWorkout", "error", err)
+		problem.Write(w, r, problem.Internal(err, "failed to update the workout"))
+		return
+	}
+
+	events := wh.goalEvents(r.Context(), existingWorkout)
+
+	unit, err := readWeightUnit(r)
+	if err != nil {
+		unit = units.Kilograms
+	}
+	existingWorkout.ConvertWeights(unit)
+
+	w.Header().Set("ETag", workoutETag(existingWorkout.Version))
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workout": existingWorkout, "goal_events": events})
 }
 
 // HandleUpdateWorkoutByID handles updates to a workout by its ID
@@ -210,41 +640,141 @@ func (wh *WorkoutHandler) HandleDeleteWorkoutByID(w http.ResponseWriter, r *http
 
 	workoutID, err := strconv.ParseInt(paramsWorkoutID, 10, 64)
 	if err != nil {
-		wh.logger.Printf("ERROR: strconv.ParseInt: %v", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "invalid workout delete id"})
+		problem.Write(w, r, problem.BadRequest("invalid workout delete id"))
 		return
 	}
 
 	currentUser := middleware.GetUser(r)
 	if currentUser == nil || currentUser == store.AnonymousUser {
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "you must be logged in to delete a workout"})
+		problem.Write(w, r, problem.BadRequest("you must be logged in to delete a workout"))
 		return
 	}
 
-	workoutOwner, err := wh.workoutStore.GetWorkoutOwner(workoutID)
+	workoutOwner, err := wh.workoutStore.GetWorkoutOwner(r.Context(), workoutID)
 	if err != nil {
-		wh.logger.Printf("ERROR: getWorkoutOwner: %v", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		logging.FromContext(r.Context()).Error("getWorkoutOwner", "error", err)
+		problem.Write(w, r, problem.Internal(err, "internal server error"))
 		return
 	}
 
 	if workoutOwner != int(currentUser.ID) {
-		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "you can only delete your own workouts"})
+		problem.Write(w, r, problem.Forbidden("you can only delete your own workouts"))
+		return
+	}
+
+	version, err := wh.workoutStore.GetWorkoutVersion(r.Context(), workoutID)
+	if err == sql.ErrNoRows {
+		problem.Write(w, r, problem.NotFound("workout not found"))
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("getWorkoutVersion", "error", err)
+		problem.Write(w, r, problem.Internal(err, "internal server error"))
+		return
+	}
+
+	if !wh.checkIfMatch(w, r, version) {
 		return
 	}
 
-	err = wh.workoutStore.DeleteWorkout(workoutID)
+	err = wh.workoutStore.DeleteWorkout(r.Context(), workoutID, expectedVersion(r, version))
 	if err == sql.ErrNoRows {
-		wh.logger.Printf("ERROR: deleteWorkout: %v", err)
-		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout not found"})
+		logging.FromContext(r.Context()).Error("deleteWorkout", "error", err)
+		problem.Write(w, r, problem.NotFound("workout not found"))
+		return
+	}
+
+	if errors.Is(err, store.ErrVersionConflict) {
+		problem.Write(w, r, problem.PreconditionFailed("workout has been modified since it was fetched"))
 		return
 	}
 
 	if err != nil {
-		wh.logger.Printf("ERROR: deleteWorkout: %v", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to delete workout"})
+		logging.FromContext(r.Context()).Error("deleteWorkout", "error", err)
+		problem.Write(w, r, problem.Internal(err, "failed to delete workout"))
 		return
 	}
 
 	utils.WriteJSON(w, http.StatusNoContent, nil)
 }
+
+func (wh *WorkoutHandler) HandleListTrash(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+
+	unit, err := readWeightUnit(r)
+	if err != nil {
+		problem.Write(w, r, problem.BadRequest(err.Error()))
+		return
+	}
+
+	workouts, err := wh.workoutStore.ListTrashedWorkouts(r.Context(), currentUser.ID)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("listTrashedWorkouts", "error", err)
+		problem.Write(w, r, problem.Internal(err, "internal server error"))
+		return
+	}
+
+	for i := range workouts {
+		workouts[i].ConvertWeights(unit)
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workouts": workouts})
+}
+
+func (wh *WorkoutHandler) HandleRestoreWorkout(w http.ResponseWriter, r *http.Request) {
+	workoutID, err := utils.ReadIDParam(r)
+	if err != nil {
+		problem.Write(w, r, problem.BadRequest("invalid workout id"))
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+
+	workoutOwner, err := wh.workoutStore.GetWorkoutOwner(r.Context(), workoutID)
+	if err == sql.ErrNoRows {
+		problem.Write(w, r, problem.NotFound("workout not found"))
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("getWorkoutOwner", "error", err)
+		problem.Write(w, r, problem.Internal(err, "internal server error"))
+		return
+	}
+
+	if workoutOwner != int(currentUser.ID) {
+		problem.Write(w, r, problem.Forbidden("you can only restore your own workouts"))
+		return
+	}
+
+	err = wh.workoutStore.RestoreWorkout(r.Context(), workoutID)
+	if err == sql.ErrNoRows {
+		problem.Write(w, r, problem.NotFound("workout is not in the trash"))
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("restoreWorkout", "error", err)
+		problem.Write(w, r, problem.Internal(err, "failed to restore workout"))
+		return
+	}
+
+	workout, err := wh.workoutStore.GetWorkoutByID(r.Context(), workoutID)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("getWorkoutByID", "error", err)
+		problem.Write(w, r, problem.Internal(err, "internal server error"))
+		return
+	}
+	if workout == nil {
+		// purged or trashed again between the restore and this read
+		problem.Write(w, r, problem.NotFound("workout not found"))
+		return
+	}
+
+	unit, err := readWeightUnit(r)
+	if err != nil {
+		unit = units.Kilograms
+	}
+	workout.ConvertWeights(unit)
+
+	w.Header().Set("ETag", workoutETag(workout.Version))
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workout": workout})
+}
@@ -0,0 +1,170 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cykj40/beginner_go/internal/calories"
+	"github.com/cykj40/beginner_go/internal/middleware"
+	"github.com/cykj40/beginner_go/internal/store"
+	"github.com/cykj40/beginner_go/internal/validator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeWorkoutStore struct {
+	store.WorkoutStore
+	created *store.Workout
+}
+
+func (f *fakeWorkoutStore) CreateWorkout(ctx context.Context, workout *store.Workout) (*store.Workout, error) {
+	f.created = workout
+	return workout, nil
+}
+
+type fakeGoalStore struct {
+	store.GoalStore
+}
+
+func (f *fakeGoalStore) ListGoals(ctx context.Context, userID int64) ([]store.Goal, error) {
+	return nil, nil
+}
+
+func TestHandleCreateWorkoutCalories(t *testing.T) {
+	estimate := calories.Estimate(&store.Workout{DurationMinutes: 60}, 0)
+	require.Positive(t, estimate)
+
+	tests := []struct {
+		name          string
+		calories      string
+		wantCalories  int
+		wantEstimated bool
+	}{
+		{"omitted is estimated", "", estimate, true},
+		{"explicit zero is kept", `,"calories_burned":0`, 0, false},
+		{"explicit value is kept", `,"calories_burned":420`, 420, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workoutStore := &fakeWorkoutStore{}
+			wh := NewWorkoutHandler(workoutStore, &fakeGoalStore{}, false)
+
+			body := `{"title":"easy run","duration_minutes":60` + tt.calories + `}`
+			r := httptest.NewRequest(http.MethodPost, "/workouts", strings.NewReader(body))
+			r = middleware.SetUser(r, &store.User{ID: 7})
+			w := httptest.NewRecorder()
+			wh.HandleCreateWorkout(w, r)
+
+			require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+			require.NotNil(t, workoutStore.created)
+			assert.Equal(t, tt.wantCalories, workoutStore.created.CaloriesBurned)
+			assert.Equal(t, tt.wantEstimated, workoutStore.created.CaloriesEstimated)
+		})
+	}
+}
+
+func TestValidateWorkoutEntryKinds(t *testing.T) {
+	km, meters, yards := "km", "m", "yd"
+
+	tests := []struct {
+		name      string
+		entry     store.WorkoutEntry
+		wantField string
+	}{
+		{"reps", store.WorkoutEntry{Sets: 3, Reps: intPtr(10)}, ""},
+		{"duration", store.WorkoutEntry{Sets: 3, DurationSeconds: intPtr(60)}, ""},
+		{"distance", store.WorkoutEntry{Distance: floatPtr(5), DistanceUnit: &km, DurationSeconds: intPtr(1500)}, ""},
+		{"distance defaults to km", store.WorkoutEntry{Distance: floatPtr(5)}, ""},
+		{"reps and duration", store.WorkoutEntry{Sets: 3, Reps: intPtr(10), DurationSeconds: intPtr(60)}, "duration_seconds"},
+		{"reps entry with a distance", store.WorkoutEntry{Sets: 3, Reps: intPtr(10), Distance: floatPtr(20), DistanceUnit: &meters}, ""},
+		{"distance type with reps", store.WorkoutEntry{MeasurementType: store.MeasurementDistance, Reps: intPtr(10), Distance: floatPtr(5)}, "measurement_type"},
+		{"distance type without distance", store.WorkoutEntry{MeasurementType: store.MeasurementDistance, DurationSeconds: intPtr(60)}, "measurement_type"},
+		{"duration type with reps", store.WorkoutEntry{MeasurementType: store.MeasurementDuration, Reps: intPtr(10)}, "measurement_type"},
+		{"unknown distance unit", store.WorkoutEntry{Distance: floatPtr(5), DistanceUnit: &yards}, "measurement_type"},
+		{"distance unit without distance", store.WorkoutEntry{DurationSeconds: intPtr(60), DistanceUnit: &km}, "distance_unit"},
+		{"negative distance", store.WorkoutEntry{Distance: floatPtr(-1)}, "distance"},
+		{"nothing measured", store.WorkoutEntry{Sets: 3}, "measurement_type"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.entry.ExerciseName = "run"
+			v := validator.New()
+			validateWorkoutEntry(v, &tt.entry)
+
+			if tt.wantField == "" {
+				assert.True(t, v.Valid(), v.Error())
+				return
+			}
+			assert.Contains(t, v.Errors, tt.wantField)
+		})
+	}
+}
+
+func TestHandleCreateWorkoutRejectsDistanceUnitWithoutDistance(t *testing.T) {
+	wh := NewWorkoutHandler(&fakeWorkoutStore{}, &fakeGoalStore{}, false)
+
+	body := `{"title":"intervals","entries":[{"exercise_name":"run","duration_seconds":600,"distance_unit":"km"}]}`
+	r := httptest.NewRequest(http.MethodPost, "/workouts", strings.NewReader(body))
+	r = middleware.SetUser(r, &store.User{ID: 7})
+	w := httptest.NewRecorder()
+	wh.HandleCreateWorkout(w, r)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), "entries[0].distance_unit")
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func floatPtr(f float64) *float64 {
+	return &f
+}
+
+func TestValidateWorkout(t *testing.T) {
+	start := time.Date(2026, 3, 1, 7, 0, 0, 0, time.UTC)
+	end := start.Add(45 * time.Minute)
+	before := start.Add(-time.Minute)
+
+	tests := []struct {
+		name      string
+		workout   store.Workout
+		wantField string
+	}{
+		{"valid", store.Workout{Title: "legs", StartedAt: start, EndedAt: &end, DurationMinutes: 45}, ""},
+		{"duration within tolerance", store.Workout{Title: "legs", StartedAt: start, EndedAt: &end, DurationMinutes: 46}, ""},
+		{"blank title", store.Workout{Title: " "}, "title"},
+		{"negative duration", store.Workout{Title: "legs", DurationMinutes: -5}, "duration_minutes"},
+		{"negative calories", store.Workout{Title: "legs", CaloriesBurned: -1}, "calories_burned"},
+		{"unknown timezone", store.Workout{Title: "legs", Timezone: "Mars/Olympus"}, "timezone"},
+		{"ended without started", store.Workout{Title: "legs", EndedAt: &end}, "started_at"},
+		{"ended before started", store.Workout{Title: "legs", StartedAt: start, EndedAt: &before}, "ended_at"},
+		{"duration disagrees with interval", store.Workout{Title: "legs", StartedAt: start, EndedAt: &end, DurationMinutes: 60}, "duration_minutes"},
+		{"negative sets", store.Workout{Title: "legs", Entries: []store.WorkoutEntry{{ExerciseName: "squat", Sets: -1, Reps: intPtr(5)}}}, "entries[0].sets"},
+		{"negative reps", store.Workout{Title: "legs", Entries: []store.WorkoutEntry{{ExerciseName: "squat", Sets: 3, Reps: intPtr(-5)}}}, "entries[0].reps"},
+		{"negative weight", store.Workout{Title: "legs", Entries: []store.WorkoutEntry{{ExerciseName: "squat", Sets: 3, Reps: intPtr(5), Weight: floatPtr(-20)}}}, "entries[0].weight"},
+		{"unknown weight unit", store.Workout{Title: "legs", Entries: []store.WorkoutEntry{{ExerciseName: "squat", Sets: 3, Reps: intPtr(5), Weight: floatPtr(100), WeightUnit: "st"}}}, "entries[0].weight_unit"},
+		{"missing exercise name", store.Workout{Title: "legs", Entries: []store.WorkoutEntry{{Sets: 3, Reps: intPtr(5)}}}, "entries[0].exercise_name"},
+	}
+
+	wh := NewWorkoutHandler(nil, nil, false)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := wh.validateWorkout(&tt.workout)
+			if tt.wantField == "" {
+				assert.NoError(t, err)
+				return
+			}
+
+			var verr *validator.Validator
+			require.ErrorAs(t, err, &verr)
+			assert.Contains(t, verr.Errors, tt.wantField)
+		})
+	}
+}
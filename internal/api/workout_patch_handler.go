@@ -0,0 +1,200 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/cykj40/beginner_go/internal/jsonpatch"
+	"github.com/cykj40/beginner_go/internal/logging"
+	"github.com/cykj40/beginner_go/internal/middleware"
+	"github.com/cykj40/beginner_go/internal/problem"
+	"github.com/cykj40/beginner_go/internal/store"
+	"github.com/cykj40/beginner_go/internal/utils"
+)
+
+// resolveEntryPointer rewrites an /entries/id=<entryID>/... pointer to the
+// entry's current array index, so JSON Patch operations can address entries
+// by ID. Other pointers are returned unchanged.
+func resolveEntryPointer(doc interface{}, pointer string) (string, error) {
+	tokens, err := jsonpatch.ParsePointer(pointer)
+	if err != nil || len(tokens) < 2 || tokens[0] != "entries" || !strings.HasPrefix(tokens[1], "id=") {
+		return pointer, err
+	}
+
+	entryID, err := strconv.Atoi(strings.TrimPrefix(tokens[1], "id="))
+	if err != nil {
+		return "", fmt.Errorf("invalid entry id in %q", pointer)
+	}
+
+	root, _ := doc.(map[string]interface{})
+	entries, _ := root["entries"].([]interface{})
+	for i, entry := range entries {
+		fields, _ := entry.(map[string]interface{})
+		if id, ok := fields["id"].(float64); ok && int(id) == entryID {
+			tokens[1] = strconv.Itoa(i)
+			return jsonpatch.FormatPointer(tokens), nil
+		}
+	}
+	return "", fmt.Errorf("entry %d does not exist", entryID)
+}
+
+// HandlePatchWorkout applies an RFC 7396 merge patch or an RFC 6902 JSON
+// Patch to the workout as GET returns it, in the caller's weight unit, and
+// saves the result after full validation. JSON Patch paths may address an
+// entry by ID as /entries/id=<entryID>.
+func (wh *WorkoutHandler) HandlePatchWorkout(w http.ResponseWriter, r *http.Request) {
+	workoutID, ok := wh.readOwnedWorkoutID(w, r)
+	if !ok {
+		return
+	}
+
+	contentType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (contentType != jsonpatch.MergePatchContentType && contentType != jsonpatch.JSONPatchContentType) {
+		w.Header().Set("Accept-Patch", jsonpatch.MergePatchContentType+", "+jsonpatch.JSONPatchContentType)
+		problem.Write(w, r, problem.UnsupportedMediaType("content type must be "+jsonpatch.MergePatchContentType+" or "+jsonpatch.JSONPatchContentType))
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		problem.Write(w, r, problem.BadRequest("invalid request sent"))
+		return
+	}
+
+	unit, err := readWeightUnit(r)
+	if err != nil {
+		problem.Write(w, r, problem.BadRequest(err.Error()))
+		return
+	}
+
+	existing, err := wh.workoutStore.GetWorkoutByID(r.Context(), workoutID)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("getWorkoutByID", "error", err)
+		problem.Write(w, r, problem.Internal(err, "internal server error"))
+		return
+	}
+	if existing == nil {
+		problem.Write(w, r, problem.NotFound("workout not found"))
+		return
+	}
+
+	if !wh.checkIfMatch(w, r, existing.Version) {
+		return
+	}
+
+	existing.ConvertWeights(unit)
+	for i := range existing.Groups {
+		existing.Groups[i].Entries = nil
+	}
+
+	raw, err := json.Marshal(existing)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("marshalWorkout", "error", err)
+		problem.Write(w, r, problem.Internal(err, "internal server error"))
+		return
+	}
+	var doc interface{}
+	err = json.Unmarshal(raw, &doc)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("unmarshalWorkout", "error", err)
+		problem.Write(w, r, problem.Internal(err, "internal server error"))
+		return
+	}
+
+	if contentType == jsonpatch.MergePatchContentType {
+		var patch interface{}
+		err = json.Unmarshal(body, &patch)
+		if _, isObject := patch.(map[string]interface{}); err != nil || !isObject {
+			problem.Write(w, r, problem.BadRequest("a merge patch must be a JSON object"))
+			return
+		}
+		doc = jsonpatch.MergePatch(doc, patch)
+	} else {
+		ops, err := jsonpatch.DecodeOperations(body)
+		if err != nil {
+			problem.Write(w, r, problem.BadRequest(err.Error()))
+			return
+		}
+
+		for i, op := range ops {
+			op.Path, err = resolveEntryPointer(doc, op.Path)
+			if err == nil && op.From != "" {
+				op.From, err = resolveEntryPointer(doc, op.From)
+			}
+			if err == nil {
+				doc, err = jsonpatch.ApplyOperation(doc, op)
+			}
+			if errors.Is(err, jsonpatch.ErrTestFailed) {
+				problem.Write(w, r, problem.Conflict(fmt.Sprintf("operation %d: %v", i, err)))
+				return
+			}
+			if err != nil {
+				problem.Write(w, r, problem.Invalid(fmt.Sprintf("operation %d: %v", i, err)))
+				return
+			}
+		}
+	}
+
+	raw, err = json.Marshal(doc)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("marshalPatchedWorkout", "error", err)
+		problem.Write(w, r, problem.Internal(err, "internal server error"))
+		return
+	}
+
+	var patched store.Workout
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(&patched)
+	if err != nil {
+		problem.Write(w, r, problem.Invalid("patched workout is invalid: "+err.Error()))
+		return
+	}
+
+	// identity and bookkeeping fields are not patchable
+	patched.ID, patched.UserID = existing.ID, existing.UserID
+	patched.Version = expectedVersion(r, existing.Version)
+	patched.DeletedAt = nil
+	for i := range patched.Groups {
+		patched.Groups[i].Entries = nil
+	}
+
+	applyPreferredUnit(&patched, middleware.GetUser(r))
+	err = wh.validateWorkout(&patched)
+	if err != nil {
+		problem.Write(w, r, problem.Unprocessable(err))
+		return
+	}
+
+	// an estimate left untouched by the patch is recomputed for the new
+	// entries, while a changed value, 0 included, is the user's own
+	currentUser := middleware.GetUser(r)
+	if patched.CaloriesBurned != existing.CaloriesBurned {
+		patched.CaloriesEstimated = false
+	}
+	estimateCalories(&patched, currentUser)
+
+	err = wh.workoutStore.UpdateWorkout(r.Context(), &patched, currentUser.ID)
+	if errors.Is(err, store.ErrVersionConflict) {
+		problem.Write(w, r, problem.PreconditionFailed("workout has been modified since it was fetched"))
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("updateWorkout", "error", err)
+		problem.Write(w, r, problem.Internal(err, "failed to update the workout"))
+		return
+	}
+
+	events := wh.goalEvents(r.Context(), &patched)
+	patched.ConvertWeights(unit)
+
+	w.Header().Set("ETag", workoutETag(patched.Version))
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workout": patched, "goal_events": events})
+}
@@ -0,0 +1,253 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/cykj40/beginner_go/internal/logging"
+	"github.com/cykj40/beginner_go/internal/middleware"
+	"github.com/cykj40/beginner_go/internal/problem"
+	"github.com/cykj40/beginner_go/internal/store"
+	"github.com/cykj40/beginner_go/internal/units"
+	"github.com/cykj40/beginner_go/internal/utils"
+	"github.com/go-chi/chi/v5"
+)
+
+// readOwnedWorkoutID reads the workout ID from the URL and checks the
+// current user owns it and it is not in the trash, writing the error
+// response itself when not
+func (wh *WorkoutHandler) readOwnedWorkoutID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	workoutID, err := utils.ReadIDParam(r)
+	if err != nil {
+		problem.Write(w, r, problem.BadRequest("invalid workout id"))
+		return 0, false
+	}
+
+	workoutOwner, err := wh.workoutStore.GetWorkoutOwner(r.Context(), workoutID)
+	if err == sql.ErrNoRows {
+		problem.Write(w, r, problem.NotFound("workout not found"))
+		return 0, false
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("getWorkoutOwner", "error", err)
+		problem.Write(w, r, problem.Internal(err, "internal server error"))
+		return 0, false
+	}
+
+	if workoutOwner != int(middleware.GetUser(r).ID) {
+		problem.Write(w, r, problem.Forbidden("you can only access your own workouts"))
+		return 0, false
+	}
+
+	// GetWorkoutOwner also sees trashed workouts, whose history should
+	// stay hidden until they are restored
+	_, err = wh.workoutStore.GetWorkoutVersion(r.Context(), workoutID)
+	if err == sql.ErrNoRows {
+		problem.Write(w, r, problem.NotFound("workout not found"))
+		return 0, false
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("getWorkoutVersion", "error", err)
+		problem.Write(w, r, problem.Internal(err, "internal server error"))
+		return 0, false
+	}
+
+	return workoutID, true
+}
+
+func readRevisionParam(value string) (int, bool) {
+	revision, err := strconv.Atoi(value)
+	return revision, err == nil && revision > 0
+}
+
+func (wh *WorkoutHandler) HandleListWorkoutRevisions(w http.ResponseWriter, r *http.Request) {
+	workoutID, ok := wh.readOwnedWorkoutID(w, r)
+	if !ok {
+		return
+	}
+
+	revisions, err := wh.workoutStore.ListWorkoutRevisions(r.Context(), workoutID)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("listWorkoutRevisions", "error", err)
+		problem.Write(w, r, problem.Internal(err, "internal server error"))
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"revisions": revisions})
+}
+
+func (wh *WorkoutHandler) HandleGetWorkoutRevision(w http.ResponseWriter, r *http.Request) {
+	workoutID, ok := wh.readOwnedWorkoutID(w, r)
+	if !ok {
+		return
+	}
+
+	revision, ok := readRevisionParam(chi.URLParam(r, "rev"))
+	if !ok {
+		problem.Write(w, r, problem.BadRequest("invalid revision"))
+		return
+	}
+
+	unit, err := readWeightUnit(r)
+	if err != nil {
+		problem.Write(w, r, problem.BadRequest(err.Error()))
+		return
+	}
+
+	rev, err := wh.workoutStore.GetWorkoutRevision(r.Context(), workoutID, revision)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("getWorkoutRevision", "error", err)
+		problem.Write(w, r, problem.Internal(err, "internal server error"))
+		return
+	}
+	if rev == nil {
+		problem.Write(w, r, problem.NotFound("revision not found"))
+		return
+	}
+
+	rev.Workout.ConvertWeights(unit)
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"revision": rev})
+}
+
+// HandleDiffWorkoutRevisions compares ?from= against ?to=. to defaults to
+// the latest revision and from to the one before it.
+func (wh *WorkoutHandler) HandleDiffWorkoutRevisions(w http.ResponseWriter, r *http.Request) {
+	workoutID, ok := wh.readOwnedWorkoutID(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	to := 0
+	if value := query.Get("to"); value != "" {
+		if to, ok = readRevisionParam(value); !ok {
+			problem.Write(w, r, problem.BadRequest("invalid to revision"))
+			return
+		}
+	}
+
+	toRev, err := wh.workoutStore.GetWorkoutRevision(r.Context(), workoutID, to)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("getWorkoutRevision", "error", err)
+		problem.Write(w, r, problem.Internal(err, "internal server error"))
+		return
+	}
+	if toRev == nil {
+		problem.Write(w, r, problem.NotFound("revision not found"))
+		return
+	}
+
+	from := toRev.Revision - 1
+	if value := query.Get("from"); value != "" {
+		if from, ok = readRevisionParam(value); !ok {
+			problem.Write(w, r, problem.BadRequest("invalid from revision"))
+			return
+		}
+	}
+	if from < 1 {
+		problem.Write(w, r, problem.BadRequest("revision 1 has nothing to compare against, pass from explicitly"))
+		return
+	}
+
+	fromRev, err := wh.workoutStore.GetWorkoutRevision(r.Context(), workoutID, from)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("getWorkoutRevision", "error", err)
+		problem.Write(w, r, problem.Internal(err, "internal server error"))
+		return
+	}
+	if fromRev == nil {
+		problem.Write(w, r, problem.NotFound("revision not found"))
+		return
+	}
+
+	diff, err := store.DiffWorkouts(fromRev.Workout, toRev.Workout)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("diffWorkouts", "error", err)
+		problem.Write(w, r, problem.Internal(err, "internal server error"))
+		return
+	}
+	diff.From, diff.To = fromRev.Revision, toRev.Revision
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"diff": diff})
+}
+
+// HandleRestoreWorkoutRevision saves the snapshot as the current workout.
+// The restore itself becomes the newest revision, so it can be undone.
+func (wh *WorkoutHandler) HandleRestoreWorkoutRevision(w http.ResponseWriter, r *http.Request) {
+	workoutID, ok := wh.readOwnedWorkoutID(w, r)
+	if !ok {
+		return
+	}
+
+	revision, ok := readRevisionParam(chi.URLParam(r, "rev"))
+	if !ok {
+		problem.Write(w, r, problem.BadRequest("invalid revision"))
+		return
+	}
+
+	current, err := wh.workoutStore.GetWorkoutByID(r.Context(), workoutID)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("getWorkoutByID", "error", err)
+		problem.Write(w, r, problem.Internal(err, "internal server error"))
+		return
+	}
+	if current == nil {
+		problem.Write(w, r, problem.NotFound("workout not found"))
+		return
+	}
+
+	rev, err := wh.workoutStore.GetWorkoutRevision(r.Context(), workoutID, revision)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("getWorkoutRevision", "error", err)
+		problem.Write(w, r, problem.Internal(err, "internal server error"))
+		return
+	}
+	if rev == nil {
+		problem.Write(w, r, problem.NotFound("revision not found"))
+		return
+	}
+
+	if !wh.checkIfMatch(w, r, current.Version) {
+		return
+	}
+
+	restored := rev.Workout
+	restored.ID, restored.UserID = current.ID, current.UserID
+	restored.Version = expectedVersion(r, current.Version)
+	for i := range restored.Groups {
+		restored.Groups[i].Entries = nil
+	}
+
+	err = wh.validateWorkout(restored)
+	if err != nil {
+		perr := problem.Unprocessable(err)
+		perr.Detail = "revision no longer passes validation: " + perr.Detail
+		problem.Write(w, r, perr)
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	err = wh.workoutStore.UpdateWorkout(r.Context(), restored, currentUser.ID)
+	if errors.Is(err, store.ErrVersionConflict) {
+		problem.Write(w, r, problem.PreconditionFailed("workout has been modified since it was fetched"))
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("updateWorkout", "error", err)
+		problem.Write(w, r, problem.Internal(err, "failed to restore revision"))
+		return
+	}
+
+	events := wh.goalEvents(r.Context(), restored)
+
+	unit, err := readWeightUnit(r)
+	if err != nil {
+		unit = units.Kilograms
+	}
+	restored.ConvertWeights(unit)
+
+	w.Header().Set("ETag", workoutETag(restored.Version))
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workout": restored, "goal_events": events})
+}
@@ -0,0 +1,41 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cykj40/beginner_go/internal/middleware"
+	"github.com/cykj40/beginner_go/internal/store"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+type trashedWorkoutStore struct {
+	store.WorkoutStore
+	owner int
+}
+
+func (f *trashedWorkoutStore) GetWorkoutOwner(ctx context.Context, id int64) (int, error) {
+	return f.owner, nil
+}
+
+func (f *trashedWorkoutStore) GetWorkoutVersion(ctx context.Context, id int64) (int, error) {
+	return 0, sql.ErrNoRows
+}
+
+func TestRevisionsOfTrashedWorkoutAreHidden(t *testing.T) {
+	wh := NewWorkoutHandler(&trashedWorkoutStore{owner: 7}, nil, false)
+
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", "1")
+	r := httptest.NewRequest(http.MethodGet, "/workouts/1/revisions", nil)
+	r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+	r = middleware.SetUser(r, &store.User{ID: 7})
+	w := httptest.NewRecorder()
+
+	wh.HandleListWorkoutRevisions(w, r)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -1,64 +1,168 @@
 package app
 
 import (
+	"context"
 	"database/sql"
 	"embed"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
-	"os"
+	"sync/atomic"
+	"time"
 
 	"github.com/cykj40/beginner_go/internal/api"
+	"github.com/cykj40/beginner_go/internal/config"
+	"github.com/cykj40/beginner_go/internal/health"
+	"github.com/cykj40/beginner_go/internal/metrics"
 	"github.com/cykj40/beginner_go/internal/middleware"
 	"github.com/cykj40/beginner_go/internal/store"
+	"github.com/cykj40/beginner_go/internal/utils"
+	"github.com/cykj40/beginner_go/internal/worker"
 )
 
 //go:embed migrations/*.sql
 var migrations embed.FS
 
+const (
+	healthCheckTimeout = 2 * time.Second
+	poolSaturationWarn = 0.9
+)
+
 type Application struct {
-	Logger         *log.Logger
-	WorkoutHandler *api.WorkoutHandler
-	UserHandler    *api.UserHandler
-	TokenHandler   *api.TokenHandler
-	Middleware     middleware.UserMiddleware
-	DB             *sql.DB
+	Config             *config.Config
+	Logger             *slog.Logger
+	WorkoutHandler     *api.WorkoutHandler
+	UserHandler        *api.UserHandler
+	TokenHandler       *api.TokenHandler
+	CalendarHandler    *api.CalendarHandler
+	MeasurementHandler *api.MeasurementHandler
+	GoalHandler        *api.GoalHandler
+	Middleware         middleware.UserMiddleware
+	TrashPurger        *worker.TrashPurger
+	DB                 *sql.DB
+
+	ready           atomic.Bool
+	latestMigration int64
 }
 
-func NewApplication() (*Application, error) {
-	pgDB, err := store.Open()
+func NewApplication(cfg *config.Config, logger *slog.Logger) (*Application, error) {
+	pgDB, err := store.Open(cfg.Database)
 	if err != nil {
 		return nil, err
 	}
 
+	logger.Info("connected to database")
+
 	err = store.MigrateFS(pgDB, migrations, "migrations")
 	if err != nil {
 		return nil, fmt.Errorf("migration failed: %v", err)
 	}
 
-	logger := log.New(os.Stdout, "", log.Ldate|log.Ltime)
+	latestMigration, err := store.LatestMigrationVersion(migrations, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("reading migrations: %v", err)
+	}
+
+	store.SetQueryTimeout(cfg.Database.QueryTimeout)
+	store.SetBcryptCost(cfg.Auth.BcryptCost)
+
+	if cfg.Metrics.Enabled {
+		store.SetQueryObserver(metrics.ObserveStoreOperation)
+		err = metrics.RegisterDB(pgDB)
+		if err != nil {
+			return nil, fmt.Errorf("registering database metrics: %v", err)
+		}
+	}
 
 	workoutStore := store.NewPostgresWorkoutStore(pgDB)
 	userStore := store.NewPostgresUserStore(pgDB)
 	tokenStore := store.NewPostgresTokenStore(pgDB)
+	measurementStore := store.NewPostgresMeasurementStore(pgDB)
+	goalStore := store.NewPostgresGoalStore(pgDB)
 
-	workoutHandler := api.NewWorkoutHandler(workoutStore, logger)
-	userHandler := api.NewUserHandler(userStore, logger)
-	tokenHandler := api.NewTokenHandler(tokenStore, userStore, logger)
+	workoutHandler := api.NewWorkoutHandler(workoutStore, goalStore, cfg.Server.RequireIfMatch)
+	userHandler := api.NewUserHandler(userStore)
+	tokenHandler := api.NewTokenHandler(tokenStore, userStore, cfg.Auth.TokenTTL)
+	calendarHandler := api.NewCalendarHandler(workoutStore, userStore, tokenStore, cfg.Auth.CalendarTokenTTL)
+	measurementHandler := api.NewMeasurementHandler(measurementStore, userStore)
+	goalHandler := api.NewGoalHandler(goalStore)
+	trashPurger := worker.NewTrashPurger(workoutStore, cfg.Trash.Retention, cfg.Trash.PurgeInterval, logger)
 	middlewareHandler := middleware.UserMiddleware{UserStore: userStore}
 
 	app := &Application{
-		Logger:         logger,
-		WorkoutHandler: workoutHandler,
-		UserHandler:    userHandler,
-		TokenHandler:   tokenHandler,
-		Middleware:     middlewareHandler,
-		DB:             pgDB,
+		Config:             cfg,
+		Logger:             logger,
+		WorkoutHandler:     workoutHandler,
+		UserHandler:        userHandler,
+		TokenHandler:       tokenHandler,
+		CalendarHandler:    calendarHandler,
+		MeasurementHandler: measurementHandler,
+		GoalHandler:        goalHandler,
+		Middleware:         middlewareHandler,
+		TrashPurger:        trashPurger,
+		DB:                 pgDB,
+		latestMigration:    latestMigration,
 	}
 
 	return app, nil
 }
 
+// SetReady marks whether the application should receive traffic. It is
+// cleared at the start of shutdown, before requests are drained.
+func (a *Application) SetReady(ready bool) {
+	a.ready.Store(ready)
+}
+
+func (a *Application) Ready() bool {
+	return a.ready.Load()
+}
+
+// Close releases the database pool. It must run after the server and
+// workers have stopped, since both still use it.
+func (a *Application) Close() error {
+	return a.DB.Close()
+}
+
+// HealthCheck is the liveness probe: the process is up and serving
 func (a *Application) HealthCheck(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprintf(w, "Status is available\n")
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"status": health.StatusOK})
+}
+
+// ReadinessCheck reports whether the application can serve traffic,
+// failing with 503 while shutting down or when a critical dependency is
+// unhealthy
+func (a *Application) ReadinessCheck(w http.ResponseWriter, r *http.Request) {
+	report := health.Run(r.Context(), healthCheckTimeout, a.readinessChecks())
+	utils.WriteJSON(w, report.HTTPStatus(), utils.Envelope{"status": report.Status, "checks": report.Checks})
+}
+
+func (a *Application) readinessChecks() []health.Check {
+	return []health.Check{
+		{Name: "accepting_traffic", Critical: true, Run: func(ctx context.Context) health.Result {
+			if !a.Ready() {
+				return health.Result{Status: health.StatusFail, Message: "shutting down"}
+			}
+			return health.Result{Status: health.StatusOK}
+		}},
+		{Name: "database", Critical: true, Run: func(ctx context.Context) health.Result {
+			err := a.DB.PingContext(ctx)
+			if err != nil {
+				return health.Result{Status: health.StatusFail, Message: err.Error()}
+			}
+			return health.Result{Status: health.StatusOK}
+		}},
+		{Name: "migrations", Critical: true, Run: func(ctx context.Context) health.Result {
+			current, err := store.MigrationVersion(ctx, a.DB)
+			if err != nil {
+				return health.Result{Status: health.StatusFail, Message: err.Error()}
+			}
+			return health.Migrations(current, a.latestMigration)
+		}},
+		{Name: "connection_pool", Run: func(ctx context.Context) health.Result {
+			return health.Pool(a.DB.Stats(), poolSaturationWarn)
+		}},
+		{Name: "trash_purger", Run: func(ctx context.Context) health.Result {
+			return health.Heartbeat(a.TrashPurger.LastSuccess(), time.Now(), 2*a.TrashPurger.Interval())
+		}},
+	}
 }
@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE workouts
+ADD COLUMN started_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+ADD COLUMN ended_at TIMESTAMP WITH TIME ZONE,
+ADD COLUMN timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+ADD CONSTRAINT valid_workout_interval CHECK (ended_at IS NULL OR ended_at >= started_at);
+
+UPDATE workouts SET started_at = created_at WHERE created_at IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_workouts_user_started_at ON workouts (user_id, started_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_workouts_user_started_at;
+ALTER TABLE workouts
+DROP CONSTRAINT IF EXISTS valid_workout_interval,
+DROP COLUMN timezone,
+DROP COLUMN ended_at,
+DROP COLUMN started_at;
+-- +goose StatementEnd
@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS workout_activities (
+    workout_id BIGINT PRIMARY KEY REFERENCES workouts(id) ON DELETE CASCADE,
+    format VARCHAR(8) NOT NULL,
+    filename VARCHAR(255),
+    raw_data BYTEA NOT NULL,
+    sport VARCHAR(50),
+    distance_meters DOUBLE PRECISION,
+    elevation_gain_meters DOUBLE PRECISION,
+    avg_heart_rate INTEGER,
+    max_heart_rate INTEGER,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS workout_activities;
+-- +goose StatementEnd
@@ -0,0 +1,55 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE workout_entries
+ALTER COLUMN reps DROP NOT NULL,
+ADD COLUMN measurement_type VARCHAR(20) NOT NULL DEFAULT 'reps',
+ADD COLUMN distance DECIMAL(10, 3),
+ADD COLUMN distance_unit VARCHAR(2),
+ADD COLUMN avg_heart_rate INTEGER,
+ADD COLUMN max_heart_rate INTEGER,
+ADD COLUMN elevation_gain_meters DECIMAL(8, 2),
+ADD COLUMN cadence INTEGER,
+ADD COLUMN rpe DECIMAL(3, 1);
+
+UPDATE workout_entries SET measurement_type = 'duration' WHERE reps IS NULL;
+
+ALTER TABLE workout_entries DROP CONSTRAINT valid_workout_entry;
+
+ALTER TABLE workout_entries
+ADD CONSTRAINT valid_workout_entry CHECK (
+    (measurement_type = 'reps' AND reps IS NOT NULL AND duration_seconds IS NULL) OR
+    (measurement_type = 'duration' AND duration_seconds IS NOT NULL AND reps IS NULL) OR
+    (measurement_type = 'distance' AND distance IS NOT NULL AND distance_unit IS NOT NULL AND reps IS NULL)
+),
+ADD CONSTRAINT valid_distance_unit CHECK (distance_unit IS NULL OR distance_unit IN ('m', 'km', 'mi')),
+ADD CONSTRAINT valid_heart_rate CHECK (
+    (avg_heart_rate IS NULL OR avg_heart_rate BETWEEN 20 AND 250) AND
+    (max_heart_rate IS NULL OR max_heart_rate BETWEEN 20 AND 250)
+),
+ADD CONSTRAINT valid_rpe CHECK (rpe IS NULL OR rpe BETWEEN 1 AND 10);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE workout_entries
+DROP CONSTRAINT valid_rpe,
+DROP CONSTRAINT valid_heart_rate,
+DROP CONSTRAINT valid_distance_unit,
+DROP CONSTRAINT valid_workout_entry;
+
+DELETE FROM workout_entries WHERE measurement_type = 'distance' AND duration_seconds IS NULL;
+
+ALTER TABLE workout_entries
+DROP COLUMN rpe,
+DROP COLUMN cadence,
+DROP COLUMN elevation_gain_meters,
+DROP COLUMN max_heart_rate,
+DROP COLUMN avg_heart_rate,
+DROP COLUMN distance_unit,
+DROP COLUMN distance,
+DROP COLUMN measurement_type,
+ADD CONSTRAINT valid_workout_entry CHECK (
+    (reps IS NOT NULL OR duration_seconds IS NOT NULL) AND
+    (reps IS NULL OR duration_seconds IS NULL)
+);
+-- +goose StatementEnd
@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS workout_sets (
+    id BIGSERIAL PRIMARY KEY,
+    workout_entry_id BIGINT NOT NULL REFERENCES workout_entries(id) ON DELETE CASCADE,
+    set_index INTEGER NOT NULL,
+    set_type VARCHAR(20) NOT NULL DEFAULT 'working',
+    reps INTEGER,
+    weight DECIMAL(6, 2),
+    duration_seconds INTEGER,
+    rpe DECIMAL(3, 1),
+    completed BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT unique_set_index UNIQUE (workout_entry_id, set_index),
+    CONSTRAINT valid_set_type CHECK (set_type IN ('warm_up', 'working', 'drop', 'failure')),
+    CONSTRAINT valid_set_rpe CHECK (rpe IS NULL OR rpe BETWEEN 1 AND 10)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS workout_sets;
+-- +goose StatementEnd
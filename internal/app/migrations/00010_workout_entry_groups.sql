@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS workout_entry_groups (
+    id BIGSERIAL PRIMARY KEY,
+    workout_id BIGINT NOT NULL REFERENCES workouts(id) ON DELETE CASCADE,
+    group_type VARCHAR(20) NOT NULL,
+    name VARCHAR(255),
+    rounds INTEGER NOT NULL DEFAULT 1,
+    rest_seconds INTEGER,
+    round_rest_seconds INTEGER,
+    interval_seconds INTEGER,
+    order_index INTEGER NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT valid_group_type CHECK (group_type IN ('superset', 'circuit', 'emom', 'amrap')),
+    CONSTRAINT valid_group_rounds CHECK (rounds >= 1)
+);
+
+ALTER TABLE workout_entries
+ADD COLUMN group_id BIGINT REFERENCES workout_entry_groups(id) ON DELETE SET NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE workout_entries DROP COLUMN group_id;
+DROP TABLE IF EXISTS workout_entry_groups;
+-- +goose StatementEnd
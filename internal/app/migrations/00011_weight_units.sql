@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users
+ADD COLUMN preferred_unit VARCHAR(2) NOT NULL DEFAULT 'kg',
+ADD CONSTRAINT valid_preferred_unit CHECK (preferred_unit IN ('kg', 'lb'));
+
+-- weights are stored in kilograms; existing values are assumed to be kg already
+ALTER TABLE workout_entries ALTER COLUMN weight TYPE NUMERIC(10, 4);
+ALTER TABLE workout_sets ALTER COLUMN weight TYPE NUMERIC(10, 4);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE workout_sets ALTER COLUMN weight TYPE DECIMAL(6, 2);
+ALTER TABLE workout_entries ALTER COLUMN weight TYPE DECIMAL(5, 2);
+ALTER TABLE users
+DROP CONSTRAINT valid_preferred_unit,
+DROP COLUMN preferred_unit;
+-- +goose StatementEnd
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users
+ADD COLUMN body_weight_kg NUMERIC(6, 2),
+ADD CONSTRAINT valid_body_weight CHECK (body_weight_kg IS NULL OR body_weight_kg > 0);
+
+ALTER TABLE workouts
+ADD COLUMN calories_estimated BOOLEAN NOT NULL DEFAULT FALSE;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE workouts DROP COLUMN calories_estimated;
+ALTER TABLE users
+DROP CONSTRAINT valid_body_weight,
+DROP COLUMN body_weight_kg;
+-- +goose StatementEnd
@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS measurements (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    measurement_type VARCHAR(50) NOT NULL,
+    value NUMERIC(10, 3) NOT NULL,
+    unit VARCHAR(10) NOT NULL,
+    measured_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    notes TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT valid_measurement_value CHECK (value >= 0)
+);
+
+CREATE INDEX IF NOT EXISTS idx_measurements_user_type_measured_at ON measurements (user_id, measurement_type, measured_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS measurements;
+-- +goose StatementEnd
@@ -0,0 +1,39 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS goals (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    title VARCHAR(255) NOT NULL,
+    goal_type VARCHAR(20) NOT NULL,
+    target NUMERIC(10, 2) NOT NULL,
+    period VARCHAR(10),
+    exercise_name VARCHAR(255),
+    deadline TIMESTAMP WITH TIME ZONE,
+    timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    achieved_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT valid_goal_type CHECK (goal_type IN ('workouts', 'minutes', 'max_weight')),
+    CONSTRAINT valid_goal_period CHECK (period IS NULL OR period IN ('daily', 'weekly', 'monthly')),
+    CONSTRAINT valid_goal_target CHECK (target > 0)
+);
+
+CREATE INDEX IF NOT EXISTS idx_goals_user_id ON goals (user_id);
+
+CREATE TABLE IF NOT EXISTS goal_events (
+    id BIGSERIAL PRIMARY KEY,
+    goal_id BIGINT NOT NULL REFERENCES goals(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    workout_id BIGINT REFERENCES workouts(id) ON DELETE SET NULL,
+    period_start TIMESTAMP WITH TIME ZONE NOT NULL,
+    value NUMERIC(10, 2) NOT NULL,
+    achieved_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT unique_goal_period UNIQUE (goal_id, period_start)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS goal_events;
+DROP TABLE IF EXISTS goals;
+-- +goose StatementEnd
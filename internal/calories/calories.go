@@ -0,0 +1,85 @@
+package calories
+
+import (
+	"math"
+
+	"github.com/cykj40/beginner_go/internal/exercises"
+	"github.com/cykj40/beginner_go/internal/store"
+)
+
+const (
+	// used when the user has not recorded their body weight
+	DefaultBodyWeightKg = 70.0
+
+	secondsPerRep  = 3.0
+	restPerSet     = 60.0
+	kmSecondsGuess = 360.0 // 10 km/h when a distance entry has no duration
+	restMET        = 1.5
+)
+
+// Estimate computes the calories burned in a workout with the MET formula
+// kcal = MET x body weight (kg) x hours. Each entry's time comes from its
+// duration, or from its sets and reps when it has none; rest between sets
+// and any remaining workout time are counted at a light-activity MET.
+func Estimate(workout *store.Workout, bodyWeightKg float64) int {
+	if bodyWeightKg <= 0 {
+		bodyWeightKg = DefaultBodyWeightKg
+	}
+
+	var metSeconds, seconds float64
+	for _, entry := range workout.Entries {
+		rounds := 1.0
+		if entry.GroupIndex != nil && *entry.GroupIndex < len(workout.Groups) {
+			rounds = float64(max(workout.Groups[*entry.GroupIndex].Rounds, 1))
+		}
+
+		active, rest := entrySeconds(entry)
+		met := exercises.MET(entry.ExerciseName, entry.MeasurementType)
+		metSeconds += rounds * (met*active + restMET*rest)
+		seconds += rounds * (active + rest)
+	}
+
+	if total := float64(workout.DurationMinutes * 60); total > seconds {
+		metSeconds += restMET * (total - seconds)
+	}
+
+	return int(math.Round(metSeconds / 3600 * bodyWeightKg))
+}
+
+// entrySeconds estimates the time spent working and resting in an entry
+func entrySeconds(entry store.WorkoutEntry) (active, rest float64) {
+	if len(entry.SetDetails) > 0 {
+		for _, set := range entry.SetDetails {
+			switch {
+			case set.DurationSeconds != nil:
+				active += float64(*set.DurationSeconds)
+			case set.Reps != nil:
+				active += float64(*set.Reps) * secondsPerRep
+			}
+		}
+		return active, float64(len(entry.SetDetails)-1) * restPerSet
+	}
+
+	sets := float64(max(entry.Sets, 1))
+	switch {
+	case entry.MeasurementType == store.MeasurementDistance && entry.DurationSeconds != nil:
+		// distance entries record the total time, not time per set
+		return float64(*entry.DurationSeconds), 0
+	case entry.MeasurementType == store.MeasurementDistance && entry.Distance != nil:
+		km := *entry.Distance
+		if entry.DistanceUnit != nil {
+			switch *entry.DistanceUnit {
+			case "m":
+				km /= 1000
+			case "mi":
+				km *= 1.609344
+			}
+		}
+		return km * kmSecondsGuess, 0
+	case entry.DurationSeconds != nil:
+		active = sets * float64(*entry.DurationSeconds)
+	case entry.Reps != nil:
+		active = sets * float64(*entry.Reps) * secondsPerRep
+	}
+	return active, (sets - 1) * restPerSet
+}
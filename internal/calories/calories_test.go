@@ -0,0 +1,52 @@
+package calories
+
+import (
+	"testing"
+
+	"github.com/cykj40/beginner_go/internal/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEstimate(t *testing.T) {
+	reps, seconds, runSeconds := 10, 60, 1800
+	distance, km := 5.0, "km"
+
+	tests := []struct {
+		name    string
+		workout store.Workout
+		weight  float64
+		want    int
+	}{
+		{
+			name: "strength entry uses sets and reps",
+			workout: store.Workout{Entries: []store.WorkoutEntry{
+				// 3 x 10 x 3s = 90s at 6.0 MET, 2 x 60s rest at 1.5 MET
+				{ExerciseName: "Bench Presses", MeasurementType: store.MeasurementReps, Sets: 3, Reps: &reps},
+			}},
+			weight: 80,
+			want:   16,
+		},
+		{
+			name: "distance entry uses its total duration",
+			workout: store.Workout{Entries: []store.WorkoutEntry{
+				{ExerciseName: "run", MeasurementType: store.MeasurementDistance, Sets: 1, Distance: &distance, DistanceUnit: &km, DurationSeconds: &runSeconds},
+			}},
+			weight: 70,
+			want:   343,
+		},
+		{
+			name: "remaining workout time counts as light activity",
+			workout: store.Workout{DurationMinutes: 10, Entries: []store.WorkoutEntry{
+				{ExerciseName: "plank", MeasurementType: store.MeasurementDuration, Sets: 1, DurationSeconds: &seconds},
+			}},
+			weight: 0,
+			want:   19,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Estimate(&tt.workout, tt.weight))
+		})
+	}
+}
@@ -0,0 +1,486 @@
+// Package config loads the server configuration from defaults, an
+// optional YAML file, environment variables and command line flags, in
+// increasing order of precedence.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
+)
+
+const redacted = "REDACTED"
+
+type Config struct {
+	Server   Server   `yaml:"server"`
+	Database Database `yaml:"database"`
+	Auth     Auth     `yaml:"auth"`
+	CORS     CORS     `yaml:"cors"`
+	Log      Log      `yaml:"log"`
+	Trash    Trash    `yaml:"trash"`
+	Metrics  Metrics  `yaml:"metrics"`
+	Tracing  Tracing  `yaml:"tracing"`
+}
+
+type Server struct {
+	Port         int           `yaml:"port"`
+	ReadTimeout  time.Duration `yaml:"read_timeout"`
+	WriteTimeout time.Duration `yaml:"write_timeout"`
+	IdleTimeout  time.Duration `yaml:"idle_timeout"`
+	DrainTimeout time.Duration `yaml:"drain_timeout"`
+	// ReadinessGrace is how long /readyz reports 503 before the listener
+	// closes, so load balancers stop routing to the instance first
+	ReadinessGrace time.Duration `yaml:"readiness_grace"`
+	// RequireIfMatch rejects workout writes without an If-Match header
+	// with 428 instead of letting them overwrite blindly
+	RequireIfMatch bool `yaml:"require_if_match"`
+}
+
+// Database is either a full DSN or the individual connection settings;
+// DSN wins when both are given
+type Database struct {
+	DSN             string        `yaml:"dsn"`
+	Host            string        `yaml:"host"`
+	Port            int           `yaml:"port"`
+	User            string        `yaml:"user"`
+	Password        string        `yaml:"password"`
+	Name            string        `yaml:"name"`
+	SSLMode         string        `yaml:"sslmode"`
+	SSLRootCert     string        `yaml:"sslrootcert"`
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+	QueryTimeout    time.Duration `yaml:"query_timeout"`
+}
+
+type Auth struct {
+	TokenTTL         time.Duration `yaml:"token_ttl"`
+	CalendarTokenTTL time.Duration `yaml:"calendar_token_ttl"`
+	BcryptCost       int           `yaml:"bcrypt_cost"`
+}
+
+// CORS is disabled while AllowedOrigins is empty
+type CORS struct {
+	AllowedOrigins   []string      `yaml:"allowed_origins"`
+	AllowedMethods   []string      `yaml:"allowed_methods"`
+	AllowedHeaders   []string      `yaml:"allowed_headers"`
+	AllowCredentials bool          `yaml:"allow_credentials"`
+	MaxAge           time.Duration `yaml:"max_age"`
+}
+
+type Log struct {
+	Level  string `yaml:"level"`
+	Format string `yaml:"format"`
+}
+
+type Trash struct {
+	Retention     time.Duration `yaml:"retention"`
+	PurgeInterval time.Duration `yaml:"purge_interval"`
+}
+
+// Metrics are off by default since /metrics is unauthenticated. Once
+// enabled they are served on the API port unless AdminPort is set, which
+// keeps them off the public listener.
+type Metrics struct {
+	Enabled   bool   `yaml:"enabled"`
+	Path      string `yaml:"path"`
+	AdminPort int    `yaml:"admin_port"`
+}
+
+// Tracing is off while Exporter is "none". The otlp exporter sends spans
+// over OTLP/HTTP to Endpoint; stdout and file write them as JSON for local
+// development.
+type Tracing struct {
+	Exporter    string  `yaml:"exporter"`
+	Endpoint    string  `yaml:"endpoint"`
+	Insecure    bool    `yaml:"insecure"`
+	File        string  `yaml:"file"`
+	SampleRatio float64 `yaml:"sample_ratio"`
+	ServiceName string  `yaml:"service_name"`
+}
+
+var tracingExporters = []string{"none", "otlp", "stdout", "file"}
+
+func Default() *Config {
+	return &Config{
+		Server: Server{
+			Port:         8080,
+			ReadTimeout:  10 * time.Second,
+			WriteTimeout: 30 * time.Second,
+			IdleTimeout:  time.Minute,
+			DrainTimeout: 30 * time.Second,
+			// a little longer than a typical readiness probe period
+			ReadinessGrace: 5 * time.Second,
+		},
+		Database: Database{
+			Host:         "localhost",
+			Port:         5433,
+			User:         "postgres",
+			Name:         "postgres",
+			SSLMode:      "prefer",
+			MaxOpenConns: 25,
+			MaxIdleConns: 25,
+		},
+		Auth: Auth{
+			TokenTTL: 24 * time.Hour,
+			// calendar feed URLs are subscribed to once and polled forever, so
+			// they outlive login tokens by a wide margin and are rotated
+			// explicitly instead
+			CalendarTokenTTL: 5 * 365 * 24 * time.Hour,
+			BcryptCost:       12,
+		},
+		CORS: CORS{
+			AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+			AllowedHeaders: []string{"Authorization", "Content-Type", "If-Match", "If-None-Match"},
+			MaxAge:         10 * time.Minute,
+		},
+		Log: Log{
+			Level:  "info",
+			Format: "text",
+		},
+		Trash: Trash{
+			Retention:     30 * 24 * time.Hour,
+			PurgeInterval: time.Hour,
+		},
+		Metrics: Metrics{
+			Path: "/metrics",
+		},
+		Tracing: Tracing{
+			Exporter:    "none",
+			Endpoint:    "localhost:4318",
+			SampleRatio: 1,
+			ServiceName: "beginner_go",
+		},
+	}
+}
+
+// option is a setting that can come from the environment or a flag
+type option struct {
+	flag  string
+	env   string
+	usage string
+	set   func(c *Config, value string) error
+}
+
+func options() []option {
+	return []option{
+		{"port", "PORT", "port to start the server on", intVar(func(c *Config) *int { return &c.Server.Port })},
+		{"read-timeout", "SERVER_READ_TIMEOUT", "maximum time to read a request", durationVar(func(c *Config) *time.Duration { return &c.Server.ReadTimeout })},
+		{"write-timeout", "SERVER_WRITE_TIMEOUT", "maximum time to write a response", durationVar(func(c *Config) *time.Duration { return &c.Server.WriteTimeout })},
+		{"idle-timeout", "SERVER_IDLE_TIMEOUT", "how long idle keep-alive connections stay open", durationVar(func(c *Config) *time.Duration { return &c.Server.IdleTimeout })},
+		{"drain-timeout", "SERVER_DRAIN_TIMEOUT", "how long to wait for in-flight requests on shutdown", durationVar(func(c *Config) *time.Duration { return &c.Server.DrainTimeout })},
+		{"readiness-grace", "SERVER_READINESS_GRACE", "how long /readyz fails before the listener closes on shutdown", durationVar(func(c *Config) *time.Duration { return &c.Server.ReadinessGrace })},
+		{"require-if-match", "REQUIRE_IF_MATCH", "reject workout writes that do not send If-Match", boolVar(func(c *Config) *bool { return &c.Server.RequireIfMatch })},
+
+		{"db-dsn", "DB_DSN", "database connection string, overriding the other db settings", stringVar(func(c *Config) *string { return &c.Database.DSN })},
+		{"db-host", "DB_HOST", "database host", stringVar(func(c *Config) *string { return &c.Database.Host })},
+		{"db-port", "DB_PORT", "database port", intVar(func(c *Config) *int { return &c.Database.Port })},
+		{"db-user", "DB_USER", "database user", stringVar(func(c *Config) *string { return &c.Database.User })},
+		{"db-password", "DB_PASSWORD", "database password", stringVar(func(c *Config) *string { return &c.Database.Password })},
+		{"db-name", "DB_NAME", "database name", stringVar(func(c *Config) *string { return &c.Database.Name })},
+		{"db-sslmode", "DB_SSLMODE", "database TLS mode", stringVar(func(c *Config) *string { return &c.Database.SSLMode })},
+		{"db-sslrootcert", "DB_SSLROOTCERT", "CA certificate used to verify the database server", stringVar(func(c *Config) *string { return &c.Database.SSLRootCert })},
+		{"db-max-open-conns", "DB_MAX_OPEN_CONNS", "maximum open database connections", intVar(func(c *Config) *int { return &c.Database.MaxOpenConns })},
+		{"db-max-idle-conns", "DB_MAX_IDLE_CONNS", "maximum idle database connections", intVar(func(c *Config) *int { return &c.Database.MaxIdleConns })},
+		{"db-conn-max-lifetime", "DB_CONN_MAX_LIFETIME", "maximum age of a database connection, 0 for no limit", durationVar(func(c *Config) *time.Duration { return &c.Database.ConnMaxLifetime })},
+		{"db-query-timeout", "DB_QUERY_TIMEOUT", "deadline for each store call, 0 for none", durationVar(func(c *Config) *time.Duration { return &c.Database.QueryTimeout })},
+
+		{"token-ttl", "AUTH_TOKEN_TTL", "lifetime of login tokens", durationVar(func(c *Config) *time.Duration { return &c.Auth.TokenTTL })},
+		{"calendar-token-ttl", "CALENDAR_TOKEN_TTL", "lifetime of calendar feed tokens", durationVar(func(c *Config) *time.Duration { return &c.Auth.CalendarTokenTTL })},
+		{"bcrypt-cost", "BCRYPT_COST", "bcrypt cost for password hashes", intVar(func(c *Config) *int { return &c.Auth.BcryptCost })},
+
+		{"cors-allowed-origins", "CORS_ALLOWED_ORIGINS", "comma separated origins allowed to call the API", listVar(func(c *Config) *[]string { return &c.CORS.AllowedOrigins })},
+		{"cors-allowed-methods", "CORS_ALLOWED_METHODS", "comma separated methods allowed cross-origin", listVar(func(c *Config) *[]string { return &c.CORS.AllowedMethods })},
+		{"cors-allowed-headers", "CORS_ALLOWED_HEADERS", "comma separated request headers allowed cross-origin", listVar(func(c *Config) *[]string { return &c.CORS.AllowedHeaders })},
+		{"cors-allow-credentials", "CORS_ALLOW_CREDENTIALS", "allow cross-origin requests with credentials", boolVar(func(c *Config) *bool { return &c.CORS.AllowCredentials })},
+		{"cors-max-age", "CORS_MAX_AGE", "how long browsers may cache a preflight response", durationVar(func(c *Config) *time.Duration { return &c.CORS.MaxAge })},
+
+		{"log-level", "LOG_LEVEL", "debug, info, warn or error", stringVar(func(c *Config) *string { return &c.Log.Level })},
+		{"log-format", "LOG_FORMAT", "text or json", stringVar(func(c *Config) *string { return &c.Log.Format })},
+
+		{"trash-retention", "TRASH_RETENTION", "how long deleted workouts stay in the trash", durationVar(func(c *Config) *time.Duration { return &c.Trash.Retention })},
+		{"trash-purge-interval", "TRASH_PURGE_INTERVAL", "how often the trash is purged", durationVar(func(c *Config) *time.Duration { return &c.Trash.PurgeInterval })},
+
+		{"metrics-enabled", "METRICS_ENABLED", "expose Prometheus metrics", boolVar(func(c *Config) *bool { return &c.Metrics.Enabled })},
+		{"metrics-path", "METRICS_PATH", "path metrics are served on", stringVar(func(c *Config) *string { return &c.Metrics.Path })},
+		{"metrics-admin-port", "METRICS_ADMIN_PORT", "separate port for metrics, 0 to serve them on the API port", intVar(func(c *Config) *int { return &c.Metrics.AdminPort })},
+
+		{"tracing-exporter", "TRACING_EXPORTER", "none, otlp, stdout or file", stringVar(func(c *Config) *string { return &c.Tracing.Exporter })},
+		{"tracing-endpoint", "TRACING_ENDPOINT", "OTLP/HTTP collector address as host:port", stringVar(func(c *Config) *string { return &c.Tracing.Endpoint })},
+		{"tracing-insecure", "TRACING_INSECURE", "send spans to the collector without TLS", boolVar(func(c *Config) *bool { return &c.Tracing.Insecure })},
+		{"tracing-file", "TRACING_FILE", "file the file exporter appends spans to", stringVar(func(c *Config) *string { return &c.Tracing.File })},
+		{"tracing-sample-ratio", "TRACING_SAMPLE_RATIO", "fraction of new traces to sample, from 0 to 1", floatVar(func(c *Config) *float64 { return &c.Tracing.SampleRatio })},
+		{"tracing-service-name", "TRACING_SERVICE_NAME", "service name spans are reported under", stringVar(func(c *Config) *string { return &c.Tracing.ServiceName })},
+	}
+}
+
+func stringVar(field func(*Config) *string) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		*field(c) = value
+		return nil
+	}
+}
+
+func intVar(field func(*Config) *int) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		var n int
+		_, err := fmt.Sscan(value, &n)
+		if err != nil {
+			return fmt.Errorf("expected an integer, got %q", value)
+		}
+		*field(c) = n
+		return nil
+	}
+}
+
+func floatVar(field func(*Config) *float64) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		var f float64
+		_, err := fmt.Sscan(value, &f)
+		if err != nil {
+			return fmt.Errorf("expected a number, got %q", value)
+		}
+		*field(c) = f
+		return nil
+	}
+}
+
+func boolVar(field func(*Config) *bool) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		switch strings.ToLower(value) {
+		case "true", "1", "yes":
+			*field(c) = true
+		case "false", "0", "no":
+			*field(c) = false
+		default:
+			return fmt.Errorf("expected true or false, got %q", value)
+		}
+		return nil
+	}
+}
+
+func durationVar(field func(*Config) *time.Duration) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("expected a duration such as 30s, got %q", value)
+		}
+		*field(c) = d
+		return nil
+	}
+}
+
+func listVar(field func(*Config) *[]string) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		var list []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		*field(c) = list
+		return nil
+	}
+}
+
+// Load builds the configuration from args (without the program name) and
+// getenv. The YAML file named by -config or CONFIG_FILE is read first,
+// then environment variables, then flags, and the result is validated.
+func Load(args []string, getenv func(string) string) (*Config, error) {
+	cfg := Default()
+	opts := options()
+
+	fs := flag.NewFlagSet("config", flag.ContinueOnError)
+	configFile := fs.String("config", getenv("CONFIG_FILE"), "path to a YAML config file")
+	flagValues := map[string]string{}
+	for _, opt := range opts {
+		fs.Func(opt.flag, opt.usage+" (env "+opt.env+")", func(value string) error {
+			flagValues[opt.flag] = value
+			return nil
+		})
+	}
+	err := fs.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	if *configFile != "" {
+		data, err := os.ReadFile(*configFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading config file: %w", err)
+		}
+		err = yaml.Unmarshal(data, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("parsing config file %s: %w", *configFile, err)
+		}
+	}
+
+	for _, opt := range opts {
+		if value := getenv(opt.env); value != "" {
+			err := opt.set(cfg, value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", opt.env, err)
+			}
+		}
+	}
+
+	for _, opt := range opts {
+		if value, ok := flagValues[opt.flag]; ok {
+			err := opt.set(cfg, value)
+			if err != nil {
+				return nil, fmt.Errorf("-%s: %w", opt.flag, err)
+			}
+		}
+	}
+
+	err = cfg.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	return cfg, nil
+}
+
+var sslModes = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+
+// Validate reports every problem with the configuration at once
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Server.Port > 0 && c.Server.Port <= 65535, "server.port must be between 1 and 65535")
+	check(c.Server.ReadTimeout > 0, "server.read_timeout must be positive")
+	check(c.Server.WriteTimeout > 0, "server.write_timeout must be positive")
+	check(c.Server.IdleTimeout > 0, "server.idle_timeout must be positive")
+	check(c.Server.DrainTimeout >= 0, "server.drain_timeout cannot be negative")
+	check(c.Server.ReadinessGrace >= 0, "server.readiness_grace cannot be negative")
+
+	if c.Database.DSN == "" {
+		check(c.Database.Host != "", "database.host is required unless database.dsn is set")
+		check(c.Database.Port > 0 && c.Database.Port <= 65535, "database.port must be between 1 and 65535")
+		check(c.Database.User != "", "database.user is required unless database.dsn is set")
+		check(c.Database.Name != "", "database.name is required unless database.dsn is set")
+		check(contains(sslModes, c.Database.SSLMode), "database.sslmode must be one of %s", strings.Join(sslModes, ", "))
+	}
+	check(c.Database.MaxOpenConns >= 1, "database.max_open_conns must be at least 1")
+	check(c.Database.MaxIdleConns >= 0 && c.Database.MaxIdleConns <= c.Database.MaxOpenConns, "database.max_idle_conns must be between 0 and max_open_conns")
+	check(c.Database.ConnMaxLifetime >= 0, "database.conn_max_lifetime cannot be negative")
+	check(c.Database.QueryTimeout >= 0, "database.query_timeout cannot be negative")
+
+	check(c.Auth.TokenTTL > 0, "auth.token_ttl must be positive")
+	check(c.Auth.CalendarTokenTTL > 0, "auth.calendar_token_ttl must be positive")
+	check(c.Auth.BcryptCost >= bcrypt.MinCost && c.Auth.BcryptCost <= bcrypt.MaxCost, "auth.bcrypt_cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+
+	check(!(c.CORS.AllowCredentials && contains(c.CORS.AllowedOrigins, "*")), "cors.allow_credentials cannot be combined with the * origin")
+	check(c.CORS.MaxAge >= 0, "cors.max_age cannot be negative")
+
+	check(contains([]string{"debug", "info", "warn", "error"}, c.Log.Level), "log.level must be debug, info, warn or error")
+	check(contains([]string{"text", "json"}, c.Log.Format), "log.format must be text or json")
+
+	check(c.Trash.Retention > 0, "trash.retention must be positive")
+	check(c.Trash.PurgeInterval > 0, "trash.purge_interval must be positive")
+
+	if c.Metrics.Enabled {
+		check(strings.HasPrefix(c.Metrics.Path, "/"), "metrics.path must start with /")
+		check(c.Metrics.AdminPort >= 0 && c.Metrics.AdminPort <= 65535, "metrics.admin_port must be between 0 and 65535")
+		check(c.Metrics.AdminPort != c.Server.Port, "metrics.admin_port cannot be the same as server.port")
+	}
+
+	check(contains(tracingExporters, c.Tracing.Exporter), "tracing.exporter must be one of %s", strings.Join(tracingExporters, ", "))
+	check(c.Tracing.Exporter != "otlp" || c.Tracing.Endpoint != "", "tracing.endpoint is required for the otlp exporter")
+	check(c.Tracing.Exporter != "file" || c.Tracing.File != "", "tracing.file is required for the file exporter")
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sample_ratio must be between 0 and 1")
+	check(c.Tracing.ServiceName != "", "tracing.service_name is required")
+
+	return errors.Join(errs...)
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// ConnString returns the DSN when one is set, and otherwise builds a
+// keyword/value connection string from the individual settings
+func (d Database) ConnString() string {
+	if d.DSN != "" {
+		return d.DSN
+	}
+
+	parts := []string{
+		"host=" + quoteValue(d.Host),
+		fmt.Sprintf("port=%d", d.Port),
+		"user=" + quoteValue(d.User),
+		"dbname=" + quoteValue(d.Name),
+		"sslmode=" + quoteValue(d.SSLMode),
+	}
+	if d.Password != "" {
+		parts = append(parts, "password="+quoteValue(d.Password))
+	}
+	if d.SSLRootCert != "" {
+		parts = append(parts, "sslrootcert="+quoteValue(d.SSLRootCert))
+	}
+	return strings.Join(parts, " ")
+}
+
+// quoteValue quotes a connection string value when it is empty or holds
+// spaces, quotes or backslashes
+func quoteValue(value string) string {
+	if value != "" && !strings.ContainsAny(value, ` '\`) {
+		return value
+	}
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `'`, `\'`)
+	return "'" + value + "'"
+}
+
+var dsnPasswordRX = regexp.MustCompile(`password=('(?:[^'\\]|\\.)*'|\S*)`)
+
+// Redacted returns a copy that is safe to print, with the password masked
+// both as a setting and inside the DSN
+func (c Config) Redacted() Config {
+	if c.Database.Password != "" {
+		c.Database.Password = redacted
+	}
+	if c.Database.DSN != "" {
+		c.Database.DSN = redactDSN(c.Database.DSN)
+	}
+	return c
+}
+
+func redactDSN(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.Scheme != "" {
+		if u.User != nil {
+			if _, ok := u.User.Password(); ok {
+				u.User = url.UserPassword(u.User.Username(), redacted)
+			}
+		}
+		// libpq also takes the password as a query parameter
+		if query := u.Query(); query.Has("password") {
+			query.Set("password", redacted)
+			u.RawQuery = query.Encode()
+		}
+		return u.String()
+	}
+	return dsnPasswordRX.ReplaceAllString(dsn, "password="+redacted)
+}
+
+// Print writes the configuration as YAML with secrets redacted
+func (c Config) Print() ([]byte, error) {
+	return yaml.Marshal(c.Redacted())
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func env(values map[string]string) func(string) string {
+	return func(key string) string { return values[key] }
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(file, []byte(`
+server:
+  port: 9000
+  drain_timeout: 5s
+database:
+  host: db.internal
+  password: from-file
+cors:
+  allowed_origins: [https://app.example.com]
+`), 0o600)
+	require.NoError(t, err)
+
+	cfg, err := Load(
+		[]string{"-config", file, "-port", "9100"},
+		env(map[string]string{"PORT": "9050", "DB_PASSWORD": "from-env", "TRASH_RETENTION": "48h"}),
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t, 9100, cfg.Server.Port)
+	assert.Equal(t, 5*time.Second, cfg.Server.DrainTimeout)
+	assert.Equal(t, "db.internal", cfg.Database.Host)
+	assert.Equal(t, "from-env", cfg.Database.Password)
+	assert.Equal(t, 48*time.Hour, cfg.Trash.Retention)
+	assert.Equal(t, []string{"https://app.example.com"}, cfg.CORS.AllowedOrigins)
+	assert.Equal(t, 12, cfg.Auth.BcryptCost)
+}
+
+func TestLoadInvalid(t *testing.T) {
+	_, err := Load([]string{"-port", "0", "-bcrypt-cost", "2"}, env(map[string]string{"LOG_FORMAT": "xml"}))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "server.port")
+	assert.Contains(t, err.Error(), "auth.bcrypt_cost")
+	assert.Contains(t, err.Error(), "log.format")
+
+	_, err = Load([]string{"-metrics-enabled", "true", "-metrics-admin-port", "8080"}, env(nil))
+	assert.ErrorContains(t, err, "metrics.admin_port")
+
+	_, err = Load([]string{"-tracing-exporter", "file", "-tracing-sample-ratio", "2"}, env(nil))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "tracing.file")
+	assert.Contains(t, err.Error(), "tracing.sample_ratio")
+
+	_, err = Load(nil, env(map[string]string{"DB_QUERY_TIMEOUT": "soon"}))
+	assert.ErrorContains(t, err, "DB_QUERY_TIMEOUT")
+}
+
+func TestConnString(t *testing.T) {
+	cfg := Default().Database
+	cfg.Password = "it's secret"
+	assert.Equal(t, `host=localhost port=5433 user=postgres dbname=postgres sslmode=prefer password='it\'s secret'`, cfg.ConnString())
+
+	cfg.DSN = "postgres://app@db/app"
+	assert.Equal(t, "postgres://app@db/app", cfg.ConnString())
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := *Default()
+	cfg.Database.Password = "hunter2"
+	cfg.Database.DSN = "host=db password='hunter 2' sslmode=require"
+
+	out, err := cfg.Print()
+	require.NoError(t, err)
+	assert.NotContains(t, string(out), "hunter")
+	assert.Contains(t, string(out), "password=REDACTED sslmode=require")
+	assert.Contains(t, string(out), "drain_timeout: 30s")
+
+	cfg.Database.DSN = "postgres://app:hunter2@db:5432/app"
+	assert.Equal(t, "postgres://app:REDACTED@db:5432/app", cfg.Redacted().Database.DSN)
+	assert.True(t, strings.HasPrefix(cfg.Database.DSN, "postgres://app:hunter2"), "original is left untouched")
+}
+
+func TestRedactDSN(t *testing.T) {
+	tests := []struct {
+		name string
+		dsn  string
+		want string
+	}{
+		{"key value", "host=db password=hunter2 sslmode=require", "host=db password=REDACTED sslmode=require"},
+		{"key value quoted", "host=db password='hunter 2'", "host=db password=REDACTED"},
+		{"url userinfo", "postgres://app:hunter2@db:5432/app", "postgres://app:REDACTED@db:5432/app"},
+		{"url query", "postgres://app@db/app?password=hunter2&sslmode=require", "postgres://app@db/app?password=REDACTED&sslmode=require"},
+		{"url userinfo and query", "postgres://app:hunter2@db/app?password=hunter3", "postgres://app:REDACTED@db/app?password=REDACTED"},
+		{"url without password", "postgres://app@db/app?sslmode=require", "postgres://app@db/app?sslmode=require"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, redactDSN(tt.dsn))
+		})
+	}
+}
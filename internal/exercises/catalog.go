@@ -0,0 +1,168 @@
+package exercises
+
+import (
+	"strings"
+)
+
+// Exercise is a catalog entry. MET values are taken from the Compendium of
+// Physical Activities and describe a typical effort, not a specific athlete.
+type Exercise struct {
+	Name     string  `json:"name"`
+	Category string  `json:"category"`
+	MET      float64 `json:"met"`
+}
+
+const (
+	CategoryStrength    = "strength"
+	CategoryBodyweight  = "bodyweight"
+	CategoryCardio      = "cardio"
+	CategoryFlexibility = "flexibility"
+)
+
+var catalog = []Exercise{
+	{"bench press", CategoryStrength, 6.0},
+	{"squat", CategoryStrength, 6.0},
+	{"deadlift", CategoryStrength, 6.0},
+	{"overhead press", CategoryStrength, 6.0},
+	{"shoulder press", CategoryStrength, 5.0},
+	{"barbell row", CategoryStrength, 6.0},
+	{"clean", CategoryStrength, 6.0},
+	{"snatch", CategoryStrength, 6.0},
+	{"leg press", CategoryStrength, 5.0},
+	{"lat pulldown", CategoryStrength, 3.5},
+	{"cable row", CategoryStrength, 3.5},
+	{"bicep curl", CategoryStrength, 3.5},
+	{"curl", CategoryStrength, 3.5},
+	{"tricep extension", CategoryStrength, 3.5},
+	{"lateral raise", CategoryStrength, 3.5},
+	{"leg curl", CategoryStrength, 3.5},
+	{"leg extension", CategoryStrength, 3.5},
+	{"calf raise", CategoryStrength, 3.5},
+	{"lunge", CategoryStrength, 5.0},
+	{"hip thrust", CategoryStrength, 5.0},
+	{"kettlebell swing", CategoryStrength, 9.8},
+	{"pull up", CategoryBodyweight, 8.0},
+	{"chin up", CategoryBodyweight, 8.0},
+	{"dip", CategoryBodyweight, 8.0},
+	{"burpee", CategoryBodyweight, 8.0},
+	{"mountain climber", CategoryBodyweight, 8.0},
+	{"box jump", CategoryBodyweight, 8.0},
+	{"push up", CategoryBodyweight, 3.8},
+	{"sit up", CategoryBodyweight, 3.8},
+	{"crunch", CategoryBodyweight, 3.8},
+	{"crab walk", CategoryBodyweight, 4.0},
+	{"plank", CategoryBodyweight, 3.0},
+	{"wall sit", CategoryBodyweight, 3.0},
+	{"running", CategoryCardio, 9.8},
+	{"jogging", CategoryCardio, 7.0},
+	{"walking", CategoryCardio, 3.5},
+	{"hiking", CategoryCardio, 6.0},
+	{"cycling", CategoryCardio, 7.5},
+	{"swimming", CategoryCardio, 6.0},
+	{"rowing", CategoryCardio, 7.0},
+	{"jump rope", CategoryCardio, 12.3},
+	{"elliptical", CategoryCardio, 5.0},
+	{"stair climber", CategoryCardio, 9.0},
+	{"yoga", CategoryFlexibility, 2.5},
+	{"stretching", CategoryFlexibility, 2.3},
+}
+
+var aliases = map[string]string{
+	"run":        "running",
+	"jog":        "jogging",
+	"walk":       "walking",
+	"hike":       "hiking",
+	"bike":       "cycling",
+	"biking":     "cycling",
+	"ride":       "cycling",
+	"swim":       "swimming",
+	"row":        "rowing",
+	"pushup":     "push up",
+	"pullup":     "pull up",
+	"chinup":     "chin up",
+	"situp":      "sit up",
+	"ohp":        "overhead press",
+	"military":   "overhead press",
+	"skipping":   "jump rope",
+	"rdl":        "deadlift",
+	"back squat": "squat",
+}
+
+// fallback METs for exercises that are not in the catalog, by how the
+// entry is measured
+var measurementMETs = map[string]float64{
+	"reps":     5.0,
+	"duration": 4.0,
+	"distance": 7.0,
+}
+
+const defaultMET = 5.0
+
+func All() []Exercise {
+	return append([]Exercise{}, catalog...)
+}
+
+// Lookup finds the catalog entry for a free-text exercise name. Names are
+// matched case-insensitively, through a few common aliases, and otherwise
+// by the longest catalog name they contain ("incline bench press" matches
+// "bench press").
+func Lookup(name string) (Exercise, bool) {
+	normalized := normalize(name)
+	if alias, ok := aliases[normalized]; ok {
+		normalized = alias
+	}
+
+	var best Exercise
+	found := false
+	for _, exercise := range catalog {
+		if normalized == exercise.Name {
+			return exercise, true
+		}
+		if strings.Contains(normalized, exercise.Name) && len(exercise.Name) > len(best.Name) {
+			best = exercise
+			found = true
+		}
+	}
+	if found {
+		return best, true
+	}
+
+	for _, field := range strings.Fields(normalized) {
+		alias, ok := aliases[field]
+		if !ok {
+			continue
+		}
+		for _, exercise := range catalog {
+			if exercise.Name == alias {
+				return exercise, true
+			}
+		}
+	}
+
+	return Exercise{}, false
+}
+
+// MET returns the MET for an exercise, falling back to a value based on the
+// measurement type for exercises the catalog does not know
+func MET(name, measurementType string) float64 {
+	if exercise, ok := Lookup(name); ok {
+		return exercise.MET
+	}
+	if met, ok := measurementMETs[measurementType]; ok {
+		return met
+	}
+	return defaultMET
+}
+
+func normalize(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	name = strings.NewReplacer("-", " ", "_", " ").Replace(name)
+	fields := strings.Fields(name)
+	for i, field := range fields {
+		// "squats", "lunges" and "burpees" should match their singular form
+		if len(field) > 3 && strings.HasSuffix(field, "s") && !strings.HasSuffix(field, "ss") {
+			fields[i] = strings.TrimSuffix(field, "s")
+		}
+	}
+	return strings.Join(fields, " ")
+}
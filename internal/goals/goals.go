@@ -0,0 +1,133 @@
+// Package goals holds the calendar arithmetic behind goal periods and
+// workout streaks. It knows nothing about storage; callers pass in times.
+package goals
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	PeriodDaily   = "daily"
+	PeriodWeekly  = "weekly"
+	PeriodMonthly = "monthly"
+)
+
+func ValidPeriod(period string) bool {
+	return period == PeriodDaily || period == PeriodWeekly || period == PeriodMonthly
+}
+
+// PeriodStart returns the start of the period containing t, in loc. Weeks
+// start on Monday.
+func PeriodStart(period string, t time.Time, loc *time.Location) (time.Time, error) {
+	t = t.In(loc)
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+
+	switch period {
+	case PeriodDaily:
+		return day, nil
+	case PeriodWeekly:
+		offset := (int(day.Weekday()) + 6) % 7
+		return day.AddDate(0, 0, -offset), nil
+	case PeriodMonthly:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc), nil
+	default:
+		return time.Time{}, fmt.Errorf("unknown period %q", period)
+	}
+}
+
+// PeriodBounds returns the half-open interval [start, end) of the period
+// containing t
+func PeriodBounds(period string, t time.Time, loc *time.Location) (time.Time, time.Time, error) {
+	start, err := PeriodStart(period, t, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return start, next(period, start), nil
+}
+
+func next(period string, start time.Time) time.Time {
+	switch period {
+	case PeriodDaily:
+		return start.AddDate(0, 0, 1)
+	case PeriodWeekly:
+		return start.AddDate(0, 0, 7)
+	default:
+		return start.AddDate(0, 1, 0)
+	}
+}
+
+type Streak struct {
+	Period  string     `json:"period"`
+	Current int        `json:"current"`
+	Longest int        `json:"longest"`
+	LastAt  *time.Time `json:"last_workout_at"`
+}
+
+// Streaks counts runs of consecutive periods with at least one workout.
+// The current streak stays alive through the period containing now, so a
+// daily streak is not broken until a full day passes without training.
+func Streaks(period string, times []time.Time, now time.Time, loc *time.Location) (Streak, error) {
+	streak := Streak{Period: period}
+
+	seen := map[time.Time]bool{}
+	for _, t := range times {
+		start, err := PeriodStart(period, t, loc)
+		if err != nil {
+			return streak, err
+		}
+		seen[start] = true
+		if streak.LastAt == nil || t.After(*streak.LastAt) {
+			last := t
+			streak.LastAt = &last
+		}
+	}
+
+	for start := range seen {
+		// only count runs from their first period
+		if seen[previous(period, start)] {
+			continue
+		}
+		length := 0
+		for p := start; seen[p]; p = next(period, p) {
+			length++
+		}
+		streak.Longest = max(streak.Longest, length)
+	}
+
+	current, err := PeriodStart(period, now, loc)
+	if err != nil {
+		return streak, err
+	}
+	if !seen[current] {
+		current = previous(period, current)
+	}
+	for p := current; seen[p]; p = previous(period, p) {
+		streak.Current++
+	}
+
+	return streak, nil
+}
+
+func previous(period string, start time.Time) time.Time {
+	switch period {
+	case PeriodDaily:
+		return start.AddDate(0, 0, -1)
+	case PeriodWeekly:
+		return start.AddDate(0, 0, -7)
+	default:
+		return start.AddDate(0, -1, 0)
+	}
+}
+
+// Percent reports progress towards target, capped at 100
+func Percent(value, target float64) float64 {
+	if target <= 0 {
+		return 100
+	}
+	pct := value / target * 100
+	if pct > 100 {
+		pct = 100
+	}
+	return float64(int(pct*10)) / 10
+}
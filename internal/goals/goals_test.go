@@ -0,0 +1,55 @@
+package goals
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPeriodBounds(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+
+	// Sunday evening in New York is already Monday in UTC
+	at := time.Date(2025, 3, 10, 2, 0, 0, 0, time.UTC)
+
+	start, end, err := PeriodBounds(PeriodWeekly, at, loc)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2025, 3, 3, 0, 0, 0, 0, loc), start)
+	assert.Equal(t, time.Date(2025, 3, 10, 0, 0, 0, 0, loc), end)
+
+	start, end, err = PeriodBounds(PeriodMonthly, at, loc)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2025, 3, 1, 0, 0, 0, 0, loc), start)
+	assert.Equal(t, time.Date(2025, 4, 1, 0, 0, 0, 0, loc), end)
+}
+
+func TestStreaks(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2025, 3, d, 18, 0, 0, 0, time.UTC) }
+	times := []time.Time{day(1), day(2), day(3), day(3), day(6), day(8), day(9)}
+
+	tests := []struct {
+		name    string
+		period  string
+		now     time.Time
+		current int
+		longest int
+	}{
+		{"daily ending today", PeriodDaily, day(9), 2, 3},
+		{"daily not trained yet today", PeriodDaily, day(10), 2, 3},
+		{"daily broken", PeriodDaily, day(11), 0, 3},
+		{"weekly", PeriodWeekly, day(12), 2, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			streak, err := Streaks(tt.period, times, tt.now, time.UTC)
+			require.NoError(t, err)
+			assert.Equal(t, tt.current, streak.Current)
+			assert.Equal(t, tt.longest, streak.Longest)
+			assert.Equal(t, day(9), *streak.LastAt)
+		})
+	}
+}
@@ -0,0 +1,140 @@
+// Package health runs the component checks behind the liveness and
+// readiness endpoints.
+package health
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type Status string
+
+const (
+	StatusOK   Status = "ok"
+	StatusWarn Status = "warn"
+	StatusFail Status = "fail"
+)
+
+type Result struct {
+	Status   Status         `json:"status"`
+	Critical bool           `json:"critical"`
+	Message  string         `json:"message,omitempty"`
+	Details  map[string]any `json:"details,omitempty"`
+}
+
+// Check is one component check. A failing critical check makes the whole
+// report fail; a failing non-critical one only degrades it to a warning.
+type Check struct {
+	Name     string
+	Critical bool
+	Run      func(ctx context.Context) Result
+}
+
+type Report struct {
+	Status Status            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+// HTTPStatus is 503 when a critical check failed and 200 otherwise
+func (r Report) HTTPStatus() int {
+	if r.Status == StatusFail {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusOK
+}
+
+// Run runs every check concurrently, each bounded by timeout
+func Run(ctx context.Context, timeout time.Duration, checks []Check) Report {
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = runCheck(ctx, timeout, check)
+		}()
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]Result, len(checks))}
+	for i, check := range checks {
+		result := results[i]
+		report.Checks[check.Name] = result
+
+		switch {
+		case result.Status == StatusFail && check.Critical:
+			report.Status = StatusFail
+		case result.Status != StatusOK && report.Status == StatusOK:
+			report.Status = StatusWarn
+		}
+	}
+	return report
+}
+
+func runCheck(ctx context.Context, timeout time.Duration, check Check) Result {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	done := make(chan Result, 1)
+	go func() {
+		done <- check.Run(ctx)
+	}()
+
+	var result Result
+	select {
+	case result = <-done:
+	case <-ctx.Done():
+		result = Result{Status: StatusFail, Message: fmt.Sprintf("timed out after %s", timeout)}
+	}
+	result.Critical = check.Critical
+	return result
+}
+
+// Pool warns once the share of open connections in use reaches threshold.
+// A pool without a connection limit cannot saturate.
+func Pool(stats sql.DBStats, threshold float64) Result {
+	details := map[string]any{
+		"open":             stats.OpenConnections,
+		"in_use":           stats.InUse,
+		"idle":             stats.Idle,
+		"max_open":         stats.MaxOpenConnections,
+		"wait_count":       stats.WaitCount,
+		"wait_duration_ms": stats.WaitDuration.Milliseconds(),
+	}
+	if stats.MaxOpenConnections <= 0 {
+		return Result{Status: StatusOK, Details: details}
+	}
+
+	saturation := float64(stats.InUse) / float64(stats.MaxOpenConnections)
+	details["saturation"] = saturation
+	if saturation >= threshold {
+		return Result{Status: StatusWarn, Message: fmt.Sprintf("%d of %d connections in use", stats.InUse, stats.MaxOpenConnections), Details: details}
+	}
+	return Result{Status: StatusOK, Details: details}
+}
+
+// Heartbeat fails when a worker has not completed a run within maxAge
+func Heartbeat(last, now time.Time, maxAge time.Duration) Result {
+	if last.IsZero() {
+		return Result{Status: StatusFail, Message: "worker has not run yet"}
+	}
+	age := now.Sub(last)
+	details := map[string]any{"last_run": last.UTC().Format(time.RFC3339), "age_seconds": int64(age.Seconds())}
+	if age > maxAge {
+		return Result{Status: StatusFail, Message: fmt.Sprintf("last run %s ago", age.Round(time.Second)), Details: details}
+	}
+	return Result{Status: StatusOK, Details: details}
+}
+
+// Migrations fails unless the database is at the latest embedded version
+func Migrations(current, latest int64) Result {
+	details := map[string]any{"current": current, "latest": latest}
+	if current != latest {
+		return Result{Status: StatusFail, Message: fmt.Sprintf("database is at version %d, expected %d", current, latest), Details: details}
+	}
+	return Result{Status: StatusOK, Details: details}
+}
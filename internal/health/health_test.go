@@ -0,0 +1,69 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func check(name string, critical bool, status Status) Check {
+	return Check{Name: name, Critical: critical, Run: func(ctx context.Context) Result {
+		return Result{Status: status}
+	}}
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name   string
+		checks []Check
+		want   Status
+		code   int
+	}{
+		{"all ok", []Check{check("database", true, StatusOK), check("pool", false, StatusOK)}, StatusOK, http.StatusOK},
+		{"non-critical failure", []Check{check("database", true, StatusOK), check("worker", false, StatusFail)}, StatusWarn, http.StatusOK},
+		{"critical failure", []Check{check("database", true, StatusFail), check("pool", false, StatusWarn)}, StatusFail, http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := Run(context.Background(), time.Second, tt.checks)
+			assert.Equal(t, tt.want, report.Status)
+			assert.Equal(t, tt.code, report.HTTPStatus())
+			assert.Len(t, report.Checks, len(tt.checks))
+		})
+	}
+}
+
+func TestRunTimeout(t *testing.T) {
+	slow := Check{Name: "database", Critical: true, Run: func(ctx context.Context) Result {
+		<-ctx.Done()
+		time.Sleep(10 * time.Millisecond)
+		return Result{Status: StatusOK}
+	}}
+
+	report := Run(context.Background(), 10*time.Millisecond, []Check{slow})
+	assert.Equal(t, StatusFail, report.Status)
+	assert.True(t, report.Checks["database"].Critical)
+}
+
+func TestPool(t *testing.T) {
+	assert.Equal(t, StatusOK, Pool(sql.DBStats{InUse: 50}, 0.9).Status)
+	assert.Equal(t, StatusOK, Pool(sql.DBStats{MaxOpenConnections: 10, InUse: 5}, 0.9).Status)
+	assert.Equal(t, StatusWarn, Pool(sql.DBStats{MaxOpenConnections: 10, InUse: 9}, 0.9).Status)
+}
+
+func TestHeartbeat(t *testing.T) {
+	now := time.Date(2025, 3, 31, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, StatusFail, Heartbeat(time.Time{}, now, time.Hour).Status)
+	assert.Equal(t, StatusOK, Heartbeat(now.Add(-time.Hour), now, 2*time.Hour).Status)
+	assert.Equal(t, StatusFail, Heartbeat(now.Add(-3*time.Hour), now, 2*time.Hour).Status)
+}
+
+func TestMigrations(t *testing.T) {
+	assert.Equal(t, StatusOK, Migrations(17, 17).Status)
+	assert.Equal(t, StatusFail, Migrations(16, 17).Status)
+}
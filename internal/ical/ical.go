@@ -0,0 +1,107 @@
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	StatusConfirmed = "CONFIRMED"
+	StatusTentative = "TENTATIVE"
+
+	timestampFormat = "20060102T150405Z"
+	maxLineOctets   = 75
+)
+
+type Calendar struct {
+	ProductID string
+	Name      string
+	Events    []Event
+}
+
+type Event struct {
+	UID         string
+	Summary     string
+	Description string
+	Start       time.Time
+	End         time.Time
+	Status      string
+	Stamp       time.Time
+}
+
+// Write renders the calendar as an RFC 5545 iCalendar stream
+func Write(w io.Writer, cal Calendar) error {
+	bw := bufio.NewWriter(w)
+
+	writeLine(bw, "BEGIN:VCALENDAR")
+	writeLine(bw, "VERSION:2.0")
+	writeLine(bw, "PRODID:"+escapeText(cal.ProductID))
+	writeLine(bw, "CALSCALE:GREGORIAN")
+	writeLine(bw, "METHOD:PUBLISH")
+	if cal.Name != "" {
+		writeLine(bw, "X-WR-CALNAME:"+escapeText(cal.Name))
+	}
+
+	for _, event := range cal.Events {
+		stamp := event.Stamp
+		if stamp.IsZero() {
+			stamp = time.Now()
+		}
+
+		writeLine(bw, "BEGIN:VEVENT")
+		writeLine(bw, "UID:"+escapeText(event.UID))
+		writeLine(bw, "DTSTAMP:"+formatTime(stamp))
+		writeLine(bw, "DTSTART:"+formatTime(event.Start))
+		writeLine(bw, "DTEND:"+formatTime(event.End))
+		writeLine(bw, "SUMMARY:"+escapeText(event.Summary))
+		if event.Description != "" {
+			writeLine(bw, "DESCRIPTION:"+escapeText(event.Description))
+		}
+		if event.Status != "" {
+			writeLine(bw, "STATUS:"+event.Status)
+		}
+		writeLine(bw, "END:VEVENT")
+	}
+
+	writeLine(bw, "END:VCALENDAR")
+	return bw.Flush()
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(timestampFormat)
+}
+
+func escapeText(s string) string {
+	replacer := strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+	)
+	return replacer.Replace(s)
+}
+
+// writeLine folds content lines longer than 75 octets as required by
+// RFC 5545 section 3.1, never splitting a multi-byte character
+func writeLine(w *bufio.Writer, line string) {
+	limit := maxLineOctets
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !isRuneStart(line[cut]) {
+			cut--
+		}
+		fmt.Fprintf(w, "%s\r\n ", line[:cut])
+		line = line[cut:]
+		// continuation lines start with a space, which counts towards the limit
+		limit = maxLineOctets - 1
+	}
+	fmt.Fprintf(w, "%s\r\n", line)
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
@@ -0,0 +1,67 @@
+package ical
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrite(t *testing.T) {
+	start := time.Date(2025, 3, 1, 9, 30, 0, 0, time.FixedZone("EST", -5*60*60))
+	cal := Calendar{
+		ProductID: "-//beginner_go//workouts//EN",
+		Name:      "Workouts",
+		Events: []Event{
+			{
+				UID:         "workout-1@beginner_go",
+				Summary:     "Push day, heavy",
+				Description: "bench press: 3 x 10\nsquat; 5 x 5",
+				Start:       start,
+				End:         start.Add(time.Hour),
+				Status:      StatusConfirmed,
+				Stamp:       start,
+			},
+		},
+	}
+
+	var sb strings.Builder
+	require.NoError(t, Write(&sb, cal))
+	out := sb.String()
+
+	assert.True(t, strings.HasPrefix(out, "BEGIN:VCALENDAR\r\n"))
+	assert.True(t, strings.HasSuffix(out, "END:VCALENDAR\r\n"))
+	assert.Contains(t, out, "DTSTART:20250301T143000Z\r\n")
+	assert.Contains(t, out, "DTEND:20250301T153000Z\r\n")
+	assert.Contains(t, out, `SUMMARY:Push day\, heavy`)
+	assert.Contains(t, out, `DESCRIPTION:bench press: 3 x 10\nsquat\; 5 x 5`)
+	assert.Contains(t, out, "STATUS:CONFIRMED\r\n")
+}
+
+func TestWriteFoldsLongLines(t *testing.T) {
+	start := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	cal := Calendar{
+		ProductID: "-//test//EN",
+		Events: []Event{
+			{
+				UID:         "long",
+				Summary:     "long",
+				Description: strings.Repeat("é", 100),
+				Start:       start,
+				End:         start,
+			},
+		},
+	}
+
+	var sb strings.Builder
+	require.NoError(t, Write(&sb, cal))
+
+	for _, line := range strings.Split(strings.TrimSuffix(sb.String(), "\r\n"), "\r\n") {
+		assert.LessOrEqual(t, len(line), 75)
+		assert.True(t, strings.ToValidUTF8(line, "?") == line, "line split inside a rune: %q", line)
+	}
+	unfolded := strings.ReplaceAll(sb.String(), "\r\n ", "")
+	assert.Contains(t, unfolded, "DESCRIPTION:"+strings.Repeat("é", 100)+"\r\n")
+}
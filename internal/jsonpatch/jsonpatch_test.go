@@ -0,0 +1,84 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func decode(t *testing.T, s string) interface{} {
+	t.Helper()
+	var v interface{}
+	require.NoError(t, json.Unmarshal([]byte(s), &v))
+	return v
+}
+
+func TestMergePatch(t *testing.T) {
+	// examples from RFC 7396 appendix A
+	tests := []struct{ target, patch, want string }{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+	}
+
+	for _, tt := range tests {
+		got := MergePatch(decode(t, tt.target), decode(t, tt.patch))
+		assert.Equal(t, decode(t, tt.want), got, "%s + %s", tt.target, tt.patch)
+	}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		doc     string
+		patch   string
+		want    string
+		wantErr bool
+	}{
+		{"add member", `{"a":1}`, `[{"op":"add","path":"/b","value":2}]`, `{"a":1,"b":2}`, false},
+		{"insert into array", `{"a":[1,3]}`, `[{"op":"add","path":"/a/1","value":2}]`, `{"a":[1,2,3]}`, false},
+		{"append to array", `{"a":[1]}`, `[{"op":"add","path":"/a/-","value":2}]`, `{"a":[1,2]}`, false},
+		{"remove from array", `{"a":[1,2,3]}`, `[{"op":"remove","path":"/a/0"}]`, `{"a":[2,3]}`, false},
+		{"replace", `{"a":{"b":1}}`, `[{"op":"replace","path":"/a/b","value":null}]`, `{"a":{"b":null}}`, false},
+		{"move", `{"a":[1,2,3]}`, `[{"op":"move","from":"/a/0","path":"/a/2"}]`, `{"a":[2,3,1]}`, false},
+		{"copy", `{"a":{"b":1}}`, `[{"op":"copy","from":"/a","path":"/c"}]`, `{"a":{"b":1},"c":{"b":1}}`, false},
+		{"escaped pointer", `{"a/b":1}`, `[{"op":"replace","path":"/a~1b","value":2}]`, `{"a/b":2}`, false},
+		{"nested arrays", `[[1],[2]]`, `[{"op":"add","path":"/1/0","value":0}]`, `[[1],[0,2]]`, false},
+		{"test passes", `{"a":1}`, `[{"op":"test","path":"/a","value":1},{"op":"remove","path":"/a"}]`, `{}`, false},
+		{"test fails", `{"a":1}`, `[{"op":"test","path":"/a","value":2}]`, ``, true},
+		{"missing path", `{"a":1}`, `[{"op":"remove","path":"/b"}]`, ``, true},
+		{"index out of range", `{"a":[1]}`, `[{"op":"replace","path":"/a/1","value":2}]`, ``, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ops, err := DecodeOperations([]byte(tt.patch))
+			require.NoError(t, err)
+
+			got, err := Apply(decode(t, tt.doc), ops)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, decode(t, tt.want), got)
+		})
+	}
+}
+
+func TestDecodeOperationsRejectsIncompleteOps(t *testing.T) {
+	_, err := DecodeOperations([]byte(`[{"op":"add","path":"/a"}]`))
+	assert.Error(t, err)
+
+	_, err = DecodeOperations([]byte(`[{"op":"frobnicate","path":"/a"}]`))
+	assert.Error(t, err)
+
+	_, err = DecodeOperations([]byte(`{"op":"add"}`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,48 @@
+// Package logging builds the application's structured logger and carries
+// a request-scoped logger through contexts, so that everything logged
+// while serving a request shares its correlation ID.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+
+	"github.com/cykj40/beginner_go/internal/config"
+)
+
+type contextKey struct{}
+
+// New returns a JSON or text logger writing to w at the configured level
+func New(cfg config.Log, w io.Writer) *slog.Logger {
+	var level slog.Level
+	switch cfg.Level {
+	case "debug":
+		level = slog.LevelDebug
+	case "warn":
+		level = slog.LevelWarn
+	case "error":
+		level = slog.LevelError
+	default:
+		level = slog.LevelInfo
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	if cfg.Format == "json" {
+		return slog.New(slog.NewJSONHandler(w, opts))
+	}
+	return slog.New(slog.NewTextHandler(w, opts))
+}
+
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the logger stored in ctx, falling back to the
+// default logger outside of a request
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
@@ -0,0 +1,37 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/cykj40/beginner_go/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(config.Log{Level: "warn", Format: "json"}, &buf)
+
+	logger.Info("dropped")
+	logger.Warn("kept", "workout_id", 7)
+
+	var record map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, "kept", record["msg"])
+	assert.Equal(t, float64(7), record["workout_id"])
+}
+
+func TestFromContext(t *testing.T) {
+	assert.Equal(t, slog.Default(), FromContext(context.Background()))
+
+	var buf bytes.Buffer
+	logger := New(config.Log{Level: "info", Format: "text"}, &buf).With("request_id", "abc")
+	ctx := WithLogger(context.Background(), logger)
+
+	FromContext(ctx).Info("updating workout")
+	assert.Contains(t, buf.String(), "request_id=abc")
+}
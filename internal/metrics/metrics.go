@@ -0,0 +1,107 @@
+// Package metrics holds the Prometheus collectors the server exposes on
+// /metrics and the middleware that feeds the HTTP ones.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// unmatchedRoute labels requests no route matched, so probing random paths
+// cannot create unbounded series
+const unmatchedRoute = "unmatched"
+
+// Registry is separate from the client library's default registry so only
+// collectors registered here are exposed
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests served, by method, route pattern and status.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Time to serve HTTP requests, by method, route pattern and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	storeDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "store_operation_duration_seconds",
+		Help:    "Time spent in store calls, by operation.",
+		Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"operation"})
+
+	authAttempts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_attempts_total",
+		Help: "Authentication attempts, by method (password or token) and result.",
+	}, []string{"method", "result"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests,
+		httpDuration,
+		storeDuration,
+		authAttempts,
+	)
+}
+
+// RegisterDB exposes the connection pool statistics of db
+func RegisterDB(db *sql.DB) error {
+	return Registry.Register(collectors.NewDBStatsCollector(db, "postgres"))
+}
+
+// Handler serves the registry in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// Middleware counts and times every request under its chi route pattern
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := chimiddleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		route := unmatchedRoute
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+
+		labels := prometheus.Labels{"method": r.Method, "route": route, "status": strconv.Itoa(status)}
+		httpRequests.With(labels).Inc()
+		httpDuration.With(labels).Observe(time.Since(start).Seconds())
+	})
+}
+
+// ObserveStoreOperation records how long a store call took
+func ObserveStoreOperation(operation string, d time.Duration) {
+	storeDuration.WithLabelValues(operation).Observe(d.Seconds())
+}
+
+// AuthAttempt counts one authentication attempt. method is "password" for
+// logins and "token" for bearer tokens on API requests.
+func AuthAttempt(method string, ok bool) {
+	result := "failure"
+	if ok {
+		result = "success"
+	}
+	authAttempts.WithLabelValues(method, result).Inc()
+}
@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddlewareLabelsByRoutePattern(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(Middleware)
+	r.Get("/workouts/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	for _, path := range []string{"/workouts/1", "/workouts/2", "/nowhere"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(httpRequests.WithLabelValues("GET", "/workouts/{id}", "404")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(httpRequests.WithLabelValues("GET", unmatchedRoute, "404")))
+}
+
+func TestAuthAttempt(t *testing.T) {
+	AuthAttempt("password", true)
+	AuthAttempt("password", false)
+	AuthAttempt("password", false)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(authAttempts.WithLabelValues("password", "success")))
+	assert.Equal(t, 2.0, testutil.ToFloat64(authAttempts.WithLabelValues("password", "failure")))
+}
+
+func TestHandler(t *testing.T) {
+	ObserveStoreOperation("GetWorkoutByID", 0)
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	body := rec.Body.String()
+	assert.Contains(t, body, `store_operation_duration_seconds_count{operation="GetWorkoutByID"} 1`)
+	assert.Contains(t, body, "go_goroutines")
+}
@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/cykj40/beginner_go/internal/logging"
+	"github.com/go-chi/chi/v5"
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// an incoming request ID is reused only when it is safe to log and echo
+var requestIDRX = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+type accessEntryKey struct{}
+
+// accessEntry collects what inner handlers learn about a request for the
+// access log, such as the authenticated user
+type accessEntry struct {
+	userID int64
+}
+
+// RequestID reuses the client's X-Request-ID or generates one, echoes it
+// on the response and stores a logger tagged with it, and with the trace
+// ID when the request is traced, in the context
+func RequestID(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(RequestIDHeader)
+			if !requestIDRX.MatchString(id) {
+				id = newRequestID()
+			}
+			w.Header().Set(RequestIDHeader, id)
+
+			reqLogger := logger.With("request_id", id)
+			if sc := trace.SpanContextFromContext(r.Context()); sc.IsValid() {
+				reqLogger = reqLogger.With("trace_id", sc.TraceID().String())
+			}
+			ctx := logging.WithLogger(r.Context(), reqLogger)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// AccessLog logs one line per request once it has been served
+func AccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		entry := &accessEntry{}
+		ww := chimiddleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r.WithContext(context.WithValue(r.Context(), accessEntryKey{}, entry)))
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		route := r.URL.Path
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+
+		attrs := []any{
+			"method", r.Method,
+			"route", route,
+			"status", status,
+			"bytes", ww.BytesWritten(),
+			"latency_ms", float64(time.Since(start).Microseconds()) / 1000,
+		}
+		if entry.userID != 0 {
+			attrs = append(attrs, "user_id", entry.userID)
+		}
+
+		level := slog.LevelInfo
+		if status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		logging.FromContext(r.Context()).Log(r.Context(), level, "request", attrs...)
+	})
+}
+
+// setLogUser records the authenticated user for the access log and tags
+// the request's logger with them
+func setLogUser(r *http.Request, userID int64) *http.Request {
+	if entry, ok := r.Context().Value(accessEntryKey{}).(*accessEntry); ok {
+		entry.userID = userID
+	}
+	logger := logging.FromContext(r.Context()).With("user_id", userID)
+	return r.WithContext(logging.WithLogger(r.Context(), logger))
+}
@@ -5,9 +5,13 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/cykj40/beginner_go/internal/logging"
+	"github.com/cykj40/beginner_go/internal/metrics"
+	"github.com/cykj40/beginner_go/internal/problem"
 	"github.com/cykj40/beginner_go/internal/store"
 	"github.com/cykj40/beginner_go/internal/store/tokens"
-	"github.com/cykj40/beginner_go/internal/utils"
+	"github.com/cykj40/beginner_go/internal/tracing"
+	"go.opentelemetry.io/otel/codes"
 )
 
 type UserMiddleware struct {
@@ -44,21 +48,33 @@ func (um *UserMiddleware) Authenticate(next http.Handler) http.Handler {
 
 		headerParts := strings.Split(authHeader, " ")
 		if len(headerParts) != 2 || headerParts[0] != "Bearer" {
-			utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid suhtorization header"})
+			metrics.AuthAttempt("token", false)
+			problem.Write(w, r, problem.Unauthorized("invalid authorization header"))
 			return
 		}
 
 		token := headerParts[1]
-		user, err := um.UserStore.GetUserToken(tokens.ScopeAuth, token)
+		ctx, span := tracing.Tracer().Start(r.Context(), "auth.token_lookup")
+		user, err := um.UserStore.GetUserToken(ctx, tokens.ScopeAuth, token)
 		if err != nil {
-			utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid token"})
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "token lookup failed")
+		}
+		span.End()
+		if err != nil {
+			logging.FromContext(r.Context()).Error("getUserToken", "error", err)
+			metrics.AuthAttempt("token", false)
+			problem.Write(w, r, problem.Internal(err, "internal server error"))
 			return
 		}
 		if user == nil {
-			utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "token expired or invalid"})
+			metrics.AuthAttempt("token", false)
+			problem.Write(w, r, problem.Unauthorized("token expired or invalid"))
 			return
 		}
+		metrics.AuthAttempt("token", true)
 
+		r = setLogUser(r, user.ID)
 		r = SetUser(r, user)
 		next.ServeHTTP(w, r)
 		return
@@ -71,7 +87,7 @@ func (um *UserMiddleware) RequireUser(next http.HandlerFunc) http.HandlerFunc {
 		user := GetUser(r)
 
 		if user.IsAnonymous() {
-			utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "you must be authenticated to access this resource"})
+			problem.Write(w, r, problem.Unauthorized("you must be authenticated to access this resource"))
 			return
 		}
 
@@ -0,0 +1,257 @@
+// Package problem writes every API error as an RFC 7807 problem details
+// document with a stable, machine-readable code.
+package problem
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/cykj40/beginner_go/internal/store"
+	"github.com/cykj40/beginner_go/internal/validator"
+	"github.com/jackc/pgconn"
+)
+
+const ContentType = "application/problem+json"
+
+// Codes are part of the API contract; clients switch on them, so existing
+// values must never change meaning
+const (
+	CodeBadRequest           = "bad_request"
+	CodeValidation           = "validation_failed"
+	CodeUnauthorized         = "unauthorized"
+	CodeForbidden            = "forbidden"
+	CodeNotFound             = "not_found"
+	CodeMethodNotAllowed     = "method_not_allowed"
+	CodeConflict             = "conflict"
+	CodePreconditionFailed   = "precondition_failed"
+	CodePreconditionRequired = "precondition_required"
+	CodePayloadTooLarge      = "payload_too_large"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodeClientClosedRequest  = "client_closed_request"
+	CodeInternal             = "internal_error"
+	CodeUnavailable          = "service_unavailable"
+)
+
+// StatusClientClosedRequest is the non-standard status for a request the
+// client abandoned before the response was ready
+const StatusClientClosedRequest = 499
+
+// PostgreSQL error codes mapped to client errors
+const (
+	pgNotNullViolation    = "23502"
+	pgForeignKeyViolation = "23503"
+	pgUniqueViolation     = "23505"
+	pgCheckViolation      = "23514"
+)
+
+// Error is an API error. Err is the underlying cause; it is never sent to
+// the client but is used to refine internal errors that come from the
+// database.
+type Error struct {
+	Status int
+	Code   string
+	Detail string
+	Errors map[string][]string
+	Err    error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %s: %v", e.Code, e.Detail, e.Err)
+	}
+	return e.Code + ": " + e.Detail
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func New(status int, code, detail string) *Error {
+	return &Error{Status: status, Code: code, Detail: detail}
+}
+
+func BadRequest(detail string) *Error {
+	return New(http.StatusBadRequest, CodeBadRequest, detail)
+}
+
+func Unauthorized(detail string) *Error {
+	return New(http.StatusUnauthorized, CodeUnauthorized, detail)
+}
+
+func Forbidden(detail string) *Error {
+	return New(http.StatusForbidden, CodeForbidden, detail)
+}
+
+func NotFound(detail string) *Error {
+	return New(http.StatusNotFound, CodeNotFound, detail)
+}
+
+func Conflict(detail string) *Error {
+	return New(http.StatusConflict, CodeConflict, detail)
+}
+
+func PreconditionFailed(detail string) *Error {
+	return New(http.StatusPreconditionFailed, CodePreconditionFailed, detail)
+}
+
+func PreconditionRequired(detail string) *Error {
+	return New(http.StatusPreconditionRequired, CodePreconditionRequired, detail)
+}
+
+func PayloadTooLarge(detail string) *Error {
+	return New(http.StatusRequestEntityTooLarge, CodePayloadTooLarge, detail)
+}
+
+func UnsupportedMediaType(detail string) *Error {
+	return New(http.StatusUnsupportedMediaType, CodeUnsupportedMediaType, detail)
+}
+
+// Invalid reports a request that was well formed but cannot be applied
+func Invalid(detail string) *Error {
+	return New(http.StatusUnprocessableEntity, CodeValidation, detail)
+}
+
+// Unprocessable reports a request that was well formed but invalid,
+// listing each field's messages when err came from a validator
+func Unprocessable(err error) *Error {
+	var verr *validator.Validator
+	if errors.As(err, &verr) {
+		return &Error{Status: http.StatusUnprocessableEntity, Code: CodeValidation, Detail: "validation failed", Errors: verr.Errors}
+	}
+	return &Error{Status: http.StatusUnprocessableEntity, Code: CodeValidation, Detail: err.Error()}
+}
+
+// Internal wraps an unexpected failure. Write turns it into a client error
+// when err is a database error the client caused, such as a duplicate key.
+func Internal(err error, detail string) *Error {
+	return &Error{Status: http.StatusInternalServerError, Code: CodeInternal, Detail: detail, Err: err}
+}
+
+// From converts any error into an API error
+func From(err error) *Error {
+	var perr *Error
+	if errors.As(err, &perr) {
+		if perr.Status == http.StatusInternalServerError && perr.Err != nil {
+			if mapped := fromStore(perr.Err); mapped != nil {
+				return mapped
+			}
+		}
+		return perr
+	}
+	var verr *validator.Validator
+	if errors.As(err, &verr) {
+		return Unprocessable(verr)
+	}
+	if mapped := fromStore(err); mapped != nil {
+		return mapped
+	}
+	return Internal(err, "internal server error")
+}
+
+// fromStore maps database errors the client is responsible for, returning
+// nil for everything else
+func fromStore(err error) *Error {
+	if errors.Is(err, store.ErrCanceled) {
+		return &Error{Status: StatusClientClosedRequest, Code: CodeClientClosedRequest, Detail: "request canceled by the client", Err: err}
+	}
+	if errors.Is(err, store.ErrTimeout) {
+		return &Error{Status: http.StatusServiceUnavailable, Code: CodeUnavailable, Detail: "the database did not respond in time, try again later", Err: err}
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return &Error{Status: http.StatusNotFound, Code: CodeNotFound, Detail: "resource not found", Err: err}
+	}
+
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return nil
+	}
+	switch pgErr.Code {
+	case pgUniqueViolation:
+		field := constraintField(pgErr.ConstraintName, pgErr.TableName)
+		return &Error{Status: http.StatusConflict, Code: CodeConflict, Detail: field + " already exists", Errors: map[string][]string{field: {field + " already exists"}}, Err: err}
+	case pgCheckViolation:
+		return &Error{Status: http.StatusUnprocessableEntity, Code: CodeValidation, Detail: "value violates constraint " + pgErr.ConstraintName, Err: err}
+	case pgNotNullViolation:
+		return &Error{Status: http.StatusUnprocessableEntity, Code: CodeValidation, Detail: pgErr.ColumnName + " is required", Errors: map[string][]string{pgErr.ColumnName: {pgErr.ColumnName + " is required"}}, Err: err}
+	case pgForeignKeyViolation:
+		return &Error{Status: http.StatusUnprocessableEntity, Code: CodeValidation, Detail: "referenced resource does not exist", Err: err}
+	}
+	return nil
+}
+
+// constraintField turns a unique constraint such as users_email_key into
+// the field it covers
+func constraintField(constraint, table string) string {
+	field := strings.TrimSuffix(constraint, "_key")
+	field = strings.TrimPrefix(field, table+"_")
+	if field == "" {
+		return "value"
+	}
+	return field
+}
+
+// contextError classifies the cause of an internal error, keeping the
+// message the handler chose
+func contextError(ctx context.Context, err error) error {
+	var perr *Error
+	if errors.As(err, &perr) {
+		if perr.Err == nil {
+			return err
+		}
+		classified := *perr
+		classified.Err = store.ContextError(ctx, perr.Err)
+		return &classified
+	}
+	return store.ContextError(ctx, err)
+}
+
+type document struct {
+	Type     string              `json:"type"`
+	Title    string              `json:"title"`
+	Status   int                 `json:"status"`
+	Detail   string              `json:"detail"`
+	Instance string              `json:"instance,omitempty"`
+	Code     string              `json:"code"`
+	Errors   map[string][]string `json:"errors,omitempty"`
+}
+
+// Write sends err as a problem details document. Store errors caused by
+// the request's context ending are reported as such.
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+	if r != nil {
+		err = contextError(r.Context(), err)
+	}
+	perr := From(err)
+
+	title := http.StatusText(perr.Status)
+	if perr.Status == StatusClientClosedRequest {
+		title = "Client Closed Request"
+	}
+
+	doc := document{
+		Type:   "/problems/" + strings.ReplaceAll(perr.Code, "_", "-"),
+		Title:  title,
+		Status: perr.Status,
+		Detail: perr.Detail,
+		Code:   perr.Code,
+		Errors: perr.Errors,
+	}
+	if r != nil {
+		doc.Instance = r.URL.Path
+	}
+
+	js, mErr := json.Marshal(doc)
+	if mErr != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(perr.Status)
+	w.Write(append(js, '\n'))
+}
@@ -0,0 +1,90 @@
+package problem
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cykj40/beginner_go/internal/store"
+	"github.com/cykj40/beginner_go/internal/validator"
+	"github.com/jackc/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFrom(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+
+	v := validator.New()
+	v.Add("title", "title is required")
+
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+		detail string
+	}{
+		{"api error", NotFound("workout not found"), http.StatusNotFound, CodeNotFound, "workout not found"},
+		{"no rows", fmt.Errorf("getting workout: %w", sql.ErrNoRows), http.StatusNotFound, CodeNotFound, "resource not found"},
+		{"unique violation", Internal(&pgconn.PgError{Code: "23505", TableName: "users", ConstraintName: "users_email_key"}, "failed to create user"), http.StatusConflict, CodeConflict, "email already exists"},
+		{"check violation", &pgconn.PgError{Code: "23514", ConstraintName: "valid_rpe"}, http.StatusUnprocessableEntity, CodeValidation, "value violates constraint valid_rpe"},
+		{"client gone", store.ContextError(canceled, fmt.Errorf("listing workouts: %w", context.Canceled)), StatusClientClosedRequest, CodeClientClosedRequest, "request canceled by the client"},
+		{"query timeout", store.ContextError(expired, &pgconn.PgError{Code: "57014"}), http.StatusServiceUnavailable, CodeUnavailable, "the database did not respond in time, try again later"},
+		{"validator", v, http.StatusUnprocessableEntity, CodeValidation, "validation failed"},
+		{"internal", Internal(fmt.Errorf("boom"), "failed to create user"), http.StatusInternalServerError, CodeInternal, "failed to create user"},
+		{"unknown", fmt.Errorf("boom"), http.StatusInternalServerError, CodeInternal, "internal server error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := From(tt.err)
+			assert.Equal(t, tt.status, got.Status)
+			assert.Equal(t, tt.code, got.Code)
+			assert.Equal(t, tt.detail, got.Detail)
+		})
+	}
+}
+
+func TestWrite(t *testing.T) {
+	v := validator.New()
+	v.Add("entries[0].sets", "sets cannot be negative")
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/workouts", nil)
+	Write(rec, req, Unprocessable(v))
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Equal(t, ContentType, rec.Header().Get("Content-Type"))
+
+	var doc map[string]any
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &doc))
+	assert.Equal(t, map[string]any{
+		"type":     "/problems/validation-failed",
+		"title":    "Unprocessable Entity",
+		"status":   float64(422),
+		"detail":   "validation failed",
+		"instance": "/workouts",
+		"code":     "validation_failed",
+		"errors":   map[string]any{"entries[0].sets": []any{"sets cannot be negative"}},
+	}, doc)
+}
+
+func TestWriteCanceledRequest(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/workouts", nil).WithContext(ctx)
+	Write(rec, req, Internal(ctx.Err(), "internal server error"))
+
+	assert.Equal(t, StatusClientClosedRequest, rec.Code)
+}
@@ -1,26 +1,100 @@
 package routes
 
 import (
+	"net/http"
+
 	"github.com/cykj40/beginner_go/internal/app"
+	"github.com/cykj40/beginner_go/internal/metrics"
+	"github.com/cykj40/beginner_go/internal/middleware"
+	"github.com/cykj40/beginner_go/internal/problem"
+	"github.com/cykj40/beginner_go/internal/tracing"
 	"github.com/go-chi/chi/v5"
 )
 
 func SetupRoutes(app *app.Application) *chi.Mux {
 	r := chi.NewRouter()
+	if app.Config.Tracing.Exporter != "none" {
+		r.Use(tracing.Middleware)
+	}
+	r.Use(middleware.RequestID(app.Logger))
+	r.Use(middleware.AccessLog)
+	if app.Config.Metrics.Enabled {
+		r.Use(metrics.Middleware)
+	}
+	r.Use(middleware.CORS(app.Config.CORS))
+	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		problem.Write(w, r, problem.NotFound("no route matches "+r.URL.Path))
+	})
+	r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		problem.Write(w, r, problem.New(http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, r.Method+" is not allowed on "+r.URL.Path))
+	})
 
 	r.Group(func(r chi.Router) {
 		r.Use(app.Middleware.Authenticate)
 
+		r.Get("/workouts", app.Middleware.RequireUser(app.WorkoutHandler.HandleListWorkouts))
+		r.Get("/workouts/export.csv", app.Middleware.RequireUser(app.WorkoutHandler.HandleExportWorkouts))
+		r.Post("/workouts/import", app.Middleware.RequireUser(app.WorkoutHandler.HandleImportWorkouts))
+		r.Post("/workouts/import/activity", app.Middleware.RequireUser(app.WorkoutHandler.HandleImportActivity))
+		r.Get("/workouts/{id}/activity", app.Middleware.RequireUser(app.WorkoutHandler.HandleGetWorkoutActivity))
+		r.Get("/workouts/trash", app.Middleware.RequireUser(app.WorkoutHandler.HandleListTrash))
+		r.Post("/workouts/{id}/restore", app.Middleware.RequireUser(app.WorkoutHandler.HandleRestoreWorkout))
+		r.Get("/workouts/{id}/revisions", app.Middleware.RequireUser(app.WorkoutHandler.HandleListWorkoutRevisions))
+		r.Get("/workouts/{id}/revisions/diff", app.Middleware.RequireUser(app.WorkoutHandler.HandleDiffWorkoutRevisions))
+		r.Get("/workouts/{id}/revisions/{rev}", app.Middleware.RequireUser(app.WorkoutHandler.HandleGetWorkoutRevision))
+		r.Post("/workouts/{id}/revisions/{rev}/restore", app.Middleware.RequireUser(app.WorkoutHandler.HandleRestoreWorkoutRevision))
+		r.Post("/workouts/{id}/entries", app.Middleware.RequireUser(app.WorkoutHandler.HandleCreateWorkoutEntry))
+		r.Post("/workouts/{id}/entries/reorder", app.Middleware.RequireUser(app.WorkoutHandler.HandleReorderWorkoutEntries))
+		r.Patch("/workouts/{id}/entries/{entryID}", app.Middleware.RequireUser(app.WorkoutHandler.HandlePatchWorkoutEntry))
+		r.Delete("/workouts/{id}/entries/{entryID}", app.Middleware.RequireUser(app.WorkoutHandler.HandleDeleteWorkoutEntry))
 		r.Get("/workouts/{id}", app.Middleware.RequireUser(app.WorkoutHandler.HandleGetWorkoutByID))
 		r.Post("/workouts", app.Middleware.RequireUser(app.WorkoutHandler.HandleCreateWorkout))
 		r.Put("/workouts/{id}", app.Middleware.RequireUser(app.WorkoutHandler.HandleUpdateWorkoutByID))
+		r.Patch("/workouts/{id}", app.Middleware.RequireUser(app.WorkoutHandler.HandlePatchWorkout))
 		r.Delete("/workouts/{id}", app.Middleware.RequireUser(app.WorkoutHandler.HandleDeleteWorkoutByID))
 
+		r.Patch("/users/me", app.Middleware.RequireUser(app.UserHandler.HandleUpdateCurrentUser))
+
+		r.Get("/measurements", app.Middleware.RequireUser(app.MeasurementHandler.HandleListMeasurements))
+		r.Get("/measurements/series", app.Middleware.RequireUser(app.MeasurementHandler.HandleGetMeasurementSeries))
+		r.Get("/measurements/{id}", app.Middleware.RequireUser(app.MeasurementHandler.HandleGetMeasurement))
+		r.Post("/measurements", app.Middleware.RequireUser(app.MeasurementHandler.HandleCreateMeasurement))
+		r.Put("/measurements/{id}", app.Middleware.RequireUser(app.MeasurementHandler.HandleUpdateMeasurement))
+		r.Delete("/measurements/{id}", app.Middleware.RequireUser(app.MeasurementHandler.HandleDeleteMeasurement))
+
+		r.Get("/goals", app.Middleware.RequireUser(app.GoalHandler.HandleListGoals))
+		r.Get("/goals/{id}", app.Middleware.RequireUser(app.GoalHandler.HandleGetGoal))
+		r.Get("/goals/{id}/events", app.Middleware.RequireUser(app.GoalHandler.HandleListGoalEvents))
+		r.Post("/goals", app.Middleware.RequireUser(app.GoalHandler.HandleCreateGoal))
+		r.Put("/goals/{id}", app.Middleware.RequireUser(app.GoalHandler.HandleUpdateGoal))
+		r.Delete("/goals/{id}", app.Middleware.RequireUser(app.GoalHandler.HandleDeleteGoal))
+		r.Get("/streaks", app.Middleware.RequireUser(app.GoalHandler.HandleGetStreaks))
+
+		r.Post("/calendar/token", app.Middleware.RequireUser(app.CalendarHandler.HandleRotateCalendarToken))
+
 	})
 
 	r.Get("/health", app.HealthCheck)
+	r.Get("/healthz", app.HealthCheck)
+	r.Get("/readyz", app.ReadinessCheck)
+	if app.Config.Metrics.Enabled && app.Config.Metrics.AdminPort == 0 {
+		r.Method(http.MethodGet, app.Config.Metrics.Path, metrics.Handler())
+	}
 	r.Post("/users", app.UserHandler.HandleRegisterUser)
 	r.Post("/tokens/authentication", app.TokenHandler.HandleCreateToken)
+	r.Get("/calendar/{token}.ics", app.CalendarHandler.HandleGetCalendarFeed)
+
+	return r
+}
+
+// SetupAdminRoutes serves metrics on their own listener when
+// metrics.admin_port is set, and returns nil otherwise
+func SetupAdminRoutes(app *app.Application) *chi.Mux {
+	if !app.Config.Metrics.Enabled || app.Config.Metrics.AdminPort == 0 {
+		return nil
+	}
 
+	r := chi.NewRouter()
+	r.Method(http.MethodGet, app.Config.Metrics.Path, metrics.Handler())
 	return r
 }
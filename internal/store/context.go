@@ -0,0 +1,90 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cykj40/beginner_go/internal/tracing"
+	"github.com/jackc/pgconn"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	// ErrCanceled means the caller gave up on the query, usually because
+	// the client disconnected
+	ErrCanceled = errors.New("query canceled")
+	// ErrTimeout means the query ran past its deadline
+	ErrTimeout = errors.New("query timed out")
+)
+
+// pgQueryCanceled is the error Postgres reports for a query stopped by a
+// cancel request
+const pgQueryCanceled = "57014"
+
+var (
+	queryTimeout  time.Duration
+	queryObserver func(operation string, d time.Duration)
+)
+
+// SetQueryTimeout bounds every store call to d on top of the caller's own
+// deadline. Zero leaves calls bounded only by their context.
+func SetQueryTimeout(d time.Duration) {
+	queryTimeout = d
+}
+
+// SetQueryObserver has fn called with the name and duration of every store
+// call once it returns
+func SetQueryObserver(fn func(operation string, d time.Duration)) {
+	queryObserver = fn
+}
+
+// startQuery begins the store call named operation, applying the query
+// timeout and starting a span that the individual SQL statements are
+// traced under. The returned func must be deferred; it ends the span,
+// releases the context and reports the call to the observer.
+func startQuery(ctx context.Context, operation string) (context.Context, func()) {
+	start := time.Now()
+	ctx, span := tracing.Tracer().Start(ctx, "store."+operation,
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(semconv.DBSystemPostgreSQL, semconv.DBOperationName(operation)),
+	)
+	var cancel context.CancelFunc
+	if queryTimeout <= 0 {
+		ctx, cancel = context.WithCancel(ctx)
+	} else {
+		ctx, cancel = context.WithTimeout(ctx, queryTimeout)
+	}
+
+	return ctx, func() {
+		span.End()
+		cancel()
+		if queryObserver != nil {
+			queryObserver(operation, time.Since(start))
+		}
+	}
+}
+
+// ContextError reports err as ErrCanceled or ErrTimeout when it came from
+// a canceled or expired context, and returns it unchanged otherwise. ctx
+// is the caller's context, which tells a client that went away apart from
+// a query that took too long.
+func ContextError(ctx context.Context, err error) error {
+	if err == nil || errors.Is(err, ErrCanceled) || errors.Is(err, ErrTimeout) {
+		return err
+	}
+
+	var pgErr *pgconn.PgError
+	canceled := errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) ||
+		pgconn.Timeout(err) || (errors.As(err, &pgErr) && pgErr.Code == pgQueryCanceled)
+	if !canceled {
+		return err
+	}
+
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return fmt.Errorf("%w: %w", ErrCanceled, err)
+	}
+	return fmt.Errorf("%w: %w", ErrTimeout, err)
+}
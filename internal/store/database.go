@@ -1,47 +1,51 @@
 package store
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
 	"fmt"
 	"io/fs"
-	"os"
+	"path"
 
+	"github.com/XSAM/otelsql"
+	"github.com/cykj40/beginner_go/internal/config"
 	_ "github.com/jackc/pgx/v4/stdlib"
 	"github.com/pressly/goose/v3"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func Open() (*sql.DB, error) {
-	// Get database configuration from environment variables with defaults
-	dbHost := getEnv("DB_HOST", "localhost")
-	dbPort := getEnv("DB_PORT", "5433")
-	dbUser := getEnv("DB_USER", "postgres")
-	dbPassword := getEnv("DB_PASSWORD", "postgres")
-	dbName := getEnv("DB_NAME", "postgres")
-
-	connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		dbHost, dbPort, dbUser, dbPassword, dbName)
-
-	db, err := sql.Open("pgx", connStr)
+// Open connects to the database and sizes the pool from cfg. Every
+// statement is traced with its SQL text under the caller's span.
+func Open(cfg config.Database) (*sql.DB, error) {
+	db, err := otelsql.Open("pgx", cfg.ConnString(),
+		otelsql.WithAttributes(semconv.DBSystemPostgreSQL),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{
+			OmitConnResetSession: true,
+			OmitRows:             true,
+			SpanFilter: func(ctx context.Context, method otelsql.Method, query string, args []driver.NamedValue) bool {
+				// migrations, pings and pool housekeeping run outside any
+				// request and would each start a trace of their own
+				return trace.SpanFromContext(ctx).SpanContext().IsValid()
+			},
+		}),
+	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %v", err)
 	}
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
 
 	// Test the connection
 	if err := db.Ping(); err != nil {
 		return nil, fmt.Errorf("failed to ping database: %v", err)
 	}
 
-	fmt.Println("Connected to Database...")
 	return db, nil
 }
 
-func getEnv(key, defaultValue string) string {
-	if value, exists := os.LookupEnv(key); exists {
-		return value
-	}
-	return defaultValue
-}
-
 func MigrateFS(db *sql.DB, migrationsFS fs.FS, dir string) error {
 	// First, drop the goose version table if it exists
 	_, err := db.Exec("DROP TABLE IF EXISTS goose_db_version")
@@ -54,6 +58,13 @@ func MigrateFS(db *sql.DB, migrationsFS fs.FS, dir string) error {
 		DROP TABLE IF EXISTS users CASCADE;
 		DROP TABLE IF EXISTS workouts CASCADE;
 		DROP TABLE IF EXISTS workout_entries CASCADE;
+		DROP TABLE IF EXISTS workout_activities CASCADE;
+		DROP TABLE IF EXISTS workout_sets CASCADE;
+		DROP TABLE IF EXISTS workout_entry_groups CASCADE;
+		DROP TABLE IF EXISTS measurements CASCADE;
+		DROP TABLE IF EXISTS goals CASCADE;
+		DROP TABLE IF EXISTS goal_events CASCADE;
+		DROP TABLE IF EXISTS workout_revisions CASCADE;
 	`)
 	if err != nil {
 		return fmt.Errorf("failed to drop existing tables: %w", err)
@@ -90,6 +101,13 @@ func Migrate(db *sql.DB, dir string) error {
 		DROP TABLE IF EXISTS users CASCADE;
 		DROP TABLE IF EXISTS workouts CASCADE;
 		DROP TABLE IF EXISTS workout_entries CASCADE;
+		DROP TABLE IF EXISTS workout_activities CASCADE;
+		DROP TABLE IF EXISTS workout_sets CASCADE;
+		DROP TABLE IF EXISTS workout_entry_groups CASCADE;
+		DROP TABLE IF EXISTS measurements CASCADE;
+		DROP TABLE IF EXISTS goals CASCADE;
+		DROP TABLE IF EXISTS goal_events CASCADE;
+		DROP TABLE IF EXISTS workout_revisions CASCADE;
 	`)
 	if err != nil {
 		return fmt.Errorf("failed to drop existing tables: %w", err)
@@ -106,3 +124,28 @@ func Migrate(db *sql.DB, dir string) error {
 	}
 	return nil
 }
+
+// MigrationVersion returns the latest migration applied to db
+func MigrationVersion(ctx context.Context, db *sql.DB) (int64, error) {
+	var version int64
+	err := db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version_id), 0) FROM goose_db_version WHERE is_applied`).Scan(&version)
+	return version, err
+}
+
+// LatestMigrationVersion returns the highest migration version in dir
+func LatestMigrationVersion(migrationsFS fs.FS, dir string) (int64, error) {
+	files, err := fs.Glob(migrationsFS, path.Join(dir, "*.sql"))
+	if err != nil {
+		return 0, err
+	}
+
+	var latest int64
+	for _, file := range files {
+		version, err := goose.NumericComponent(file)
+		if err != nil {
+			return 0, fmt.Errorf("migration %s: %w", file, err)
+		}
+		latest = max(latest, version)
+	}
+	return latest, nil
+}
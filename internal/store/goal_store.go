@@ -0,0 +1,373 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/cykj40/beginner_go/internal/goals"
+	"github.com/cykj40/beginner_go/internal/units"
+)
+
+const (
+	GoalWorkouts  = "workouts"
+	GoalMinutes   = "minutes"
+	GoalMaxWeight = "max_weight"
+)
+
+// Goal is either recurring, when Period is set ("4 workouts per week"), or
+// a one-off reached once before an optional deadline ("bench 100kg by
+// March"). max_weight targets are stored in kg.
+type Goal struct {
+	ID           int64         `json:"id"`
+	UserID       int64         `json:"user_id"`
+	Title        string        `json:"title"`
+	GoalType     string        `json:"goal_type"`
+	Target       float64       `json:"target"`
+	Unit         string        `json:"unit,omitempty"`
+	Period       *string       `json:"period"`
+	ExerciseName *string       `json:"exercise_name"`
+	Deadline     *time.Time    `json:"deadline"`
+	Timezone     string        `json:"timezone"`
+	AchievedAt   *time.Time    `json:"achieved_at"`
+	CreatedAt    time.Time     `json:"created_at"`
+	UpdatedAt    time.Time     `json:"updated_at"`
+	Progress     *GoalProgress `json:"progress,omitempty"`
+}
+
+type GoalProgress struct {
+	Value       float64   `json:"value"`
+	Target      float64   `json:"target"`
+	Percent     float64   `json:"percent"`
+	Achieved    bool      `json:"achieved"`
+	PeriodStart time.Time `json:"period_start"`
+	PeriodEnd   time.Time `json:"period_end"`
+}
+
+type GoalEvent struct {
+	ID          int64     `json:"id"`
+	GoalID      int64     `json:"goal_id"`
+	UserID      int64     `json:"user_id"`
+	WorkoutID   *int64    `json:"workout_id"`
+	PeriodStart time.Time `json:"period_start"`
+	Value       float64   `json:"value"`
+	AchievedAt  time.Time `json:"achieved_at"`
+}
+
+// Normalize checks the goal definition and converts a max_weight target to kg
+func (g *Goal) Normalize() error {
+	if g.Title == "" {
+		return errors.New("title is required")
+	}
+	if g.Target <= 0 {
+		return errors.New("target must be greater than 0")
+	}
+	if g.Timezone == "" {
+		g.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(g.Timezone); err != nil {
+		return errors.New("invalid timezone")
+	}
+	if g.Period != nil && !goals.ValidPeriod(*g.Period) {
+		return errors.New("period must be daily, weekly or monthly")
+	}
+
+	switch g.GoalType {
+	case GoalWorkouts, GoalMinutes:
+		if g.Period == nil && g.Deadline == nil {
+			return errors.New("a period or a deadline is required")
+		}
+		g.Unit = ""
+	case GoalMaxWeight:
+		if g.ExerciseName == nil || *g.ExerciseName == "" {
+			return errors.New("exercise_name is required for max_weight goals")
+		}
+		if g.Period != nil {
+			return errors.New("max_weight goals cannot have a period")
+		}
+		target, err := units.ToKilograms(g.Target, g.Unit)
+		if err != nil {
+			return err
+		}
+		g.Target, g.Unit = target, units.Kilograms
+	default:
+		return errors.New("goal_type must be workouts, minutes or max_weight")
+	}
+
+	return nil
+}
+
+// Window returns the interval progress is measured over for a workout
+// performed at t: the period containing t for recurring goals, or from the
+// goal's creation to its deadline for one-off goals
+func (g *Goal) Window(t time.Time) (time.Time, time.Time, error) {
+	loc, err := time.LoadLocation(g.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	if g.Period != nil {
+		return goals.PeriodBounds(*g.Period, t, loc)
+	}
+
+	end := time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC)
+	if g.Deadline != nil {
+		end = *g.Deadline
+	}
+	return g.CreatedAt, end, nil
+}
+
+// Convert expresses max_weight targets and progress in weightUnit
+func (g *Goal) Convert(weightUnit string) {
+	if g.GoalType != GoalMaxWeight {
+		return
+	}
+	g.Target = units.FromKilograms(g.Target, weightUnit)
+	g.Unit = weightUnit
+	if g.Progress != nil {
+		g.Progress.Value = units.FromKilograms(g.Progress.Value, weightUnit)
+		g.Progress.Target = g.Target
+	}
+}
+
+type PostgresGoalStore struct {
+	db *sql.DB
+}
+
+func NewPostgresGoalStore(db *sql.DB) *PostgresGoalStore {
+	return &PostgresGoalStore{db: db}
+}
+
+type GoalStore interface {
+	CreateGoal(ctx context.Context, goal *Goal) error
+	GetGoal(ctx context.Context, id int64) (*Goal, error)
+	ListGoals(ctx context.Context, userID int64) ([]Goal, error)
+	UpdateGoal(ctx context.Context, goal *Goal) error
+	DeleteGoal(ctx context.Context, id int64) error
+	GetGoalValue(ctx context.Context, goal *Goal, from, to time.Time) (float64, error)
+	RecordGoalEvent(ctx context.Context, event *GoalEvent) (bool, error)
+	MarkGoalAchieved(ctx context.Context, goalID int64, at time.Time) error
+	ListGoalEvents(ctx context.Context, goalID int64) ([]GoalEvent, error)
+	GetWorkoutTimes(ctx context.Context, userID int64) ([]time.Time, error)
+}
+
+const goalColumns = `id, user_id, title, goal_type, target, period, exercise_name, deadline, timezone, achieved_at, created_at, updated_at`
+
+func scanGoal(row interface{ Scan(...any) error }, g *Goal) error {
+	return row.Scan(
+		&g.ID,
+		&g.UserID,
+		&g.Title,
+		&g.GoalType,
+		&g.Target,
+		&g.Period,
+		&g.ExerciseName,
+		&g.Deadline,
+		&g.Timezone,
+		&g.AchievedAt,
+		&g.CreatedAt,
+		&g.UpdatedAt,
+	)
+}
+
+func (pg *PostgresGoalStore) CreateGoal(ctx context.Context, g *Goal) error {
+	ctx, cancel := startQuery(ctx, "CreateGoal")
+	defer cancel()
+
+	query := `
+	INSERT INTO goals (user_id, title, goal_type, target, period, exercise_name, deadline, timezone)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	RETURNING id, created_at, updated_at
+	`
+	return pg.db.QueryRowContext(ctx, query, g.UserID, g.Title, g.GoalType, g.Target, g.Period, g.ExerciseName, g.Deadline, g.Timezone).Scan(&g.ID, &g.CreatedAt, &g.UpdatedAt)
+}
+
+func (pg *PostgresGoalStore) GetGoal(ctx context.Context, id int64) (*Goal, error) {
+	ctx, cancel := startQuery(ctx, "GetGoal")
+	defer cancel()
+
+	g := &Goal{}
+	err := scanGoal(pg.db.QueryRowContext(ctx, `SELECT `+goalColumns+` FROM goals WHERE id = $1`, id), g)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+func (pg *PostgresGoalStore) ListGoals(ctx context.Context, userID int64) ([]Goal, error) {
+	ctx, cancel := startQuery(ctx, "ListGoals")
+	defer cancel()
+
+	rows, err := pg.db.QueryContext(ctx, `SELECT `+goalColumns+` FROM goals WHERE user_id = $1 ORDER BY created_at, id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Goal{}
+	for rows.Next() {
+		var g Goal
+		if err := scanGoal(rows, &g); err != nil {
+			return nil, err
+		}
+		list = append(list, g)
+	}
+	return list, rows.Err()
+}
+
+func (pg *PostgresGoalStore) UpdateGoal(ctx context.Context, g *Goal) error {
+	ctx, cancel := startQuery(ctx, "UpdateGoal")
+	defer cancel()
+
+	query := `
+	UPDATE goals
+	SET title = $1, goal_type = $2, target = $3, period = $4, exercise_name = $5, deadline = $6, timezone = $7, achieved_at = $8, updated_at = CURRENT_TIMESTAMP
+	WHERE id = $9
+	RETURNING updated_at
+	`
+	return pg.db.QueryRowContext(ctx, query, g.Title, g.GoalType, g.Target, g.Period, g.ExerciseName, g.Deadline, g.Timezone, g.AchievedAt, g.ID).Scan(&g.UpdatedAt)
+}
+
+func (pg *PostgresGoalStore) DeleteGoal(ctx context.Context, id int64) error {
+	ctx, cancel := startQuery(ctx, "DeleteGoal")
+	defer cancel()
+
+	result, err := pg.db.ExecContext(ctx, `DELETE FROM goals WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetGoalValue computes the goal's metric over the user's workouts started
+// in [from, to)
+func (pg *PostgresGoalStore) GetGoalValue(ctx context.Context, g *Goal, from, to time.Time) (float64, error) {
+	ctx, cancel := startQuery(ctx, "GetGoalValue")
+	defer cancel()
+
+	var query string
+	args := []interface{}{g.UserID, from, to}
+
+	switch g.GoalType {
+	case GoalWorkouts:
+		query = `
+		SELECT COUNT(*)::float8
+		FROM workouts
+		WHERE user_id = $1 AND deleted_at IS NULL AND started_at >= $2 AND started_at < $3
+		`
+	case GoalMinutes:
+		query = `
+		SELECT COALESCE(SUM(duration_minutes), 0)::float8
+		FROM workouts
+		WHERE user_id = $1 AND deleted_at IS NULL AND started_at >= $2 AND started_at < $3
+		`
+	case GoalMaxWeight:
+		query = `
+		SELECT COALESCE(MAX(we.weight), 0)::float8
+		FROM workout_entries we
+		JOIN workouts w ON w.id = we.workout_id
+		WHERE w.user_id = $1 AND w.deleted_at IS NULL AND w.started_at >= $2 AND w.started_at < $3
+		AND LOWER(we.exercise_name) = LOWER($4)
+		`
+		args = append(args, *g.ExerciseName)
+	default:
+		return 0, errors.New("unknown goal type")
+	}
+
+	var value float64
+	err := pg.db.QueryRowContext(ctx, query, args...).Scan(&value)
+	return value, err
+}
+
+// RecordGoalEvent stores an achievement once per goal and period. It
+// reports false when the period was already recorded.
+func (pg *PostgresGoalStore) RecordGoalEvent(ctx context.Context, e *GoalEvent) (bool, error) {
+	ctx, cancel := startQuery(ctx, "RecordGoalEvent")
+	defer cancel()
+
+	query := `
+	INSERT INTO goal_events (goal_id, user_id, workout_id, period_start, value)
+	VALUES ($1, $2, $3, $4, $5)
+	ON CONFLICT (goal_id, period_start) DO NOTHING
+	RETURNING id, achieved_at
+	`
+	err := pg.db.QueryRowContext(ctx, query, e.GoalID, e.UserID, e.WorkoutID, e.PeriodStart, e.Value).Scan(&e.ID, &e.AchievedAt)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (pg *PostgresGoalStore) MarkGoalAchieved(ctx context.Context, goalID int64, at time.Time) error {
+	ctx, cancel := startQuery(ctx, "MarkGoalAchieved")
+	defer cancel()
+
+	_, err := pg.db.ExecContext(ctx, `UPDATE goals SET achieved_at = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2 AND achieved_at IS NULL`, at, goalID)
+	return err
+}
+
+func (pg *PostgresGoalStore) ListGoalEvents(ctx context.Context, goalID int64) ([]GoalEvent, error) {
+	ctx, cancel := startQuery(ctx, "ListGoalEvents")
+	defer cancel()
+
+	query := `
+	SELECT id, goal_id, user_id, workout_id, period_start, value, achieved_at
+	FROM goal_events
+	WHERE goal_id = $1
+	ORDER BY period_start DESC
+	`
+	rows, err := pg.db.QueryContext(ctx, query, goalID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []GoalEvent{}
+	for rows.Next() {
+		var e GoalEvent
+		err = rows.Scan(&e.ID, &e.GoalID, &e.UserID, &e.WorkoutID, &e.PeriodStart, &e.Value, &e.AchievedAt)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// GetWorkoutTimes returns when each of the user's workouts started, for
+// streak calculation
+func (pg *PostgresGoalStore) GetWorkoutTimes(ctx context.Context, userID int64) ([]time.Time, error) {
+	ctx, cancel := startQuery(ctx, "GetWorkoutTimes")
+	defer cancel()
+
+	rows, err := pg.db.QueryContext(ctx, `SELECT started_at FROM workouts WHERE user_id = $1 AND deleted_at IS NULL ORDER BY started_at`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	times := []time.Time{}
+	for rows.Next() {
+		var t time.Time
+		if err := rows.Scan(&t); err != nil {
+			return nil, err
+		}
+		times = append(times, t)
+	}
+	return times, rows.Err()
+}
@@ -0,0 +1,397 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/cykj40/beginner_go/internal/units"
+)
+
+const (
+	MetricBodyweight = "bodyweight"
+	MetricBodyFat    = "body_fat"
+
+	BucketNone   = ""
+	BucketDaily  = "day"
+	BucketWeekly = "week"
+)
+
+// circumference metrics are stored in centimeters
+var circumferenceMetrics = map[string]bool{
+	"neck":    true,
+	"chest":   true,
+	"waist":   true,
+	"hips":    true,
+	"arm":     true,
+	"forearm": true,
+	"thigh":   true,
+	"calf":    true,
+}
+
+// Measurement is a single body measurement. Values are stored in a
+// canonical unit per type: kg for bodyweight, % for body fat and cm for
+// circumferences.
+type Measurement struct {
+	ID         int64     `json:"id"`
+	UserID     int64     `json:"user_id"`
+	Type       string    `json:"type"`
+	Value      float64   `json:"value"`
+	Unit       string    `json:"unit"`
+	MeasuredAt time.Time `json:"measured_at"`
+	Notes      *string   `json:"notes"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+func ValidMetric(metric string) bool {
+	return metric == MetricBodyweight || metric == MetricBodyFat || circumferenceMetrics[metric]
+}
+
+func canonicalUnit(metric string) string {
+	switch {
+	case metric == MetricBodyweight:
+		return units.Kilograms
+	case metric == MetricBodyFat:
+		return units.Percent
+	default:
+		return units.Centimeters
+	}
+}
+
+// Normalize checks the type and unit and converts the value to the
+// canonical unit for its type. An empty unit means the canonical one.
+func (m *Measurement) Normalize() error {
+	if !ValidMetric(m.Type) {
+		return fmt.Errorf("unknown measurement type %q", m.Type)
+	}
+	if m.Value < 0 {
+		return fmt.Errorf("value cannot be negative")
+	}
+
+	var err error
+	switch {
+	case m.Type == MetricBodyweight:
+		m.Value, err = units.ToKilograms(m.Value, m.Unit)
+	case m.Type == MetricBodyFat:
+		if m.Unit != "" && m.Unit != units.Percent {
+			err = fmt.Errorf("body_fat is measured in %%")
+		}
+		if m.Value > 100 {
+			err = fmt.Errorf("body_fat cannot be more than 100%%")
+		}
+	default:
+		m.Value, err = units.ToCentimeters(m.Value, m.Unit)
+	}
+	if err != nil {
+		return err
+	}
+
+	m.Unit = canonicalUnit(m.Type)
+	return nil
+}
+
+// Convert expresses the value in the unit system of weightUnit: lb pairs
+// with inches and kg with centimeters
+func (m *Measurement) Convert(weightUnit string) {
+	m.Value, m.Unit = convertMetric(m.Type, m.Value, weightUnit)
+}
+
+// DefaultUnit fills an empty unit with the one Convert shows for
+// weightUnit, so a bare value is read in the user's own unit system
+func (m *Measurement) DefaultUnit(weightUnit string) {
+	if m.Unit == "" {
+		_, m.Unit = convertMetric(m.Type, 0, weightUnit)
+	}
+}
+
+func convertMetric(metric string, value float64, weightUnit string) (float64, string) {
+	switch {
+	case metric == MetricBodyweight:
+		return units.FromKilograms(value, weightUnit), weightUnit
+	case metric == MetricBodyFat:
+		return math.Round(value*100) / 100, units.Percent
+	default:
+		lengthUnit := units.LengthUnitFor(weightUnit)
+		return units.FromCentimeters(value, lengthUnit), lengthUnit
+	}
+}
+
+type MeasurementFilter struct {
+	Type string
+	From *time.Time
+	To   *time.Time
+}
+
+type SeriesPoint struct {
+	At    time.Time `json:"at"`
+	Value float64   `json:"value"`
+	Count int       `json:"count"`
+	Trend *float64  `json:"trend,omitempty"`
+}
+
+// Convert expresses the point, and its trend, in the unit system of weightUnit
+func (p *SeriesPoint) Convert(metric, weightUnit string) {
+	p.Value, _ = convertMetric(metric, p.Value, weightUnit)
+	if p.Trend != nil {
+		trend, _ := convertMetric(metric, *p.Trend, weightUnit)
+		p.Trend = &trend
+	}
+}
+
+type SeriesQuery struct {
+	Type     string
+	Bucket   string
+	From     *time.Time
+	To       *time.Time
+	Location *time.Location
+}
+
+type PostgresMeasurementStore struct {
+	db *sql.DB
+}
+
+func NewPostgresMeasurementStore(db *sql.DB) *PostgresMeasurementStore {
+	return &PostgresMeasurementStore{db: db}
+}
+
+type MeasurementStore interface {
+	CreateMeasurement(ctx context.Context, m *Measurement) error
+	GetMeasurement(ctx context.Context, id int64) (*Measurement, error)
+	ListMeasurements(ctx context.Context, userID int64, filter MeasurementFilter) ([]Measurement, error)
+	UpdateMeasurement(ctx context.Context, m *Measurement) error
+	DeleteMeasurement(ctx context.Context, id int64) error
+	GetMeasurementSeries(ctx context.Context, userID int64, query SeriesQuery) ([]SeriesPoint, error)
+	GetLatestMeasurement(ctx context.Context, userID int64, metric string) (*Measurement, error)
+}
+
+func (pg *PostgresMeasurementStore) CreateMeasurement(ctx context.Context, m *Measurement) error {
+	ctx, cancel := startQuery(ctx, "CreateMeasurement")
+	defer cancel()
+
+	if m.MeasuredAt.IsZero() {
+		m.MeasuredAt = time.Now()
+	}
+
+	query := `
+	INSERT INTO measurements (user_id, measurement_type, value, unit, measured_at, notes)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING id, created_at, updated_at
+	`
+	return pg.db.QueryRowContext(ctx, query, m.UserID, m.Type, m.Value, m.Unit, m.MeasuredAt, m.Notes).Scan(&m.ID, &m.CreatedAt, &m.UpdatedAt)
+}
+
+func (pg *PostgresMeasurementStore) GetMeasurement(ctx context.Context, id int64) (*Measurement, error) {
+	ctx, cancel := startQuery(ctx, "GetMeasurement")
+	defer cancel()
+
+	m := &Measurement{}
+	query := `
+	SELECT id, user_id, measurement_type, value, unit, measured_at, notes, created_at, updated_at
+	FROM measurements
+	WHERE id = $1
+	`
+	err := pg.db.QueryRowContext(ctx, query, id).Scan(
+		&m.ID,
+		&m.UserID,
+		&m.Type,
+		&m.Value,
+		&m.Unit,
+		&m.MeasuredAt,
+		&m.Notes,
+		&m.CreatedAt,
+		&m.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (pg *PostgresMeasurementStore) GetLatestMeasurement(ctx context.Context, userID int64, metric string) (*Measurement, error) {
+	ctx, cancel := startQuery(ctx, "GetLatestMeasurement")
+	defer cancel()
+
+	var id int64
+	query := `
+	SELECT id
+	FROM measurements
+	WHERE user_id = $1 AND measurement_type = $2
+	ORDER BY measured_at DESC, id DESC
+	LIMIT 1
+	`
+	err := pg.db.QueryRowContext(ctx, query, userID, metric).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return pg.GetMeasurement(ctx, id)
+}
+
+func (pg *PostgresMeasurementStore) ListMeasurements(ctx context.Context, userID int64, filter MeasurementFilter) ([]Measurement, error) {
+	ctx, cancel := startQuery(ctx, "ListMeasurements")
+	defer cancel()
+
+	query := `
+	SELECT id, user_id, measurement_type, value, unit, measured_at, notes, created_at, updated_at
+	FROM measurements
+	WHERE user_id = $1
+	AND ($2 = '' OR measurement_type = $2)
+	AND ($3::timestamptz IS NULL OR measured_at >= $3)
+	AND ($4::timestamptz IS NULL OR measured_at < $4)
+	ORDER BY measured_at DESC, id DESC
+	`
+
+	rows, err := pg.db.QueryContext(ctx, query, userID, filter.Type, filter.From, filter.To)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	measurements := []Measurement{}
+	for rows.Next() {
+		var m Measurement
+		err = rows.Scan(
+			&m.ID,
+			&m.UserID,
+			&m.Type,
+			&m.Value,
+			&m.Unit,
+			&m.MeasuredAt,
+			&m.Notes,
+			&m.CreatedAt,
+			&m.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		measurements = append(measurements, m)
+	}
+
+	return measurements, rows.Err()
+}
+
+func (pg *PostgresMeasurementStore) UpdateMeasurement(ctx context.Context, m *Measurement) error {
+	ctx, cancel := startQuery(ctx, "UpdateMeasurement")
+	defer cancel()
+
+	query := `
+	UPDATE measurements
+	SET measurement_type = $1, value = $2, unit = $3, measured_at = $4, notes = $5, updated_at = CURRENT_TIMESTAMP
+	WHERE id = $6
+	RETURNING updated_at
+	`
+
+	err := pg.db.QueryRowContext(ctx, query, m.Type, m.Value, m.Unit, m.MeasuredAt, m.Notes, m.ID).Scan(&m.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (pg *PostgresMeasurementStore) DeleteMeasurement(ctx context.Context, id int64) error {
+	ctx, cancel := startQuery(ctx, "DeleteMeasurement")
+	defer cancel()
+
+	result, err := pg.db.ExecContext(ctx, `DELETE FROM measurements WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetMeasurementSeries returns the measurements of one type in time order,
+// averaged per day or week in the query's location when a bucket is set
+func (pg *PostgresMeasurementStore) GetMeasurementSeries(ctx context.Context, userID int64, q SeriesQuery) ([]SeriesPoint, error) {
+	ctx, cancel := startQuery(ctx, "GetMeasurementSeries")
+	defer cancel()
+
+	loc := q.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	var query string
+	var args []interface{}
+	switch q.Bucket {
+	case BucketNone:
+		query = `
+		SELECT measured_at AT TIME ZONE $5, value, 1
+		FROM measurements
+		WHERE user_id = $1 AND measurement_type = $2
+		AND ($3::timestamptz IS NULL OR measured_at >= $3)
+		AND ($4::timestamptz IS NULL OR measured_at < $4)
+		ORDER BY measured_at
+		`
+		args = []interface{}{userID, q.Type, q.From, q.To, loc.String()}
+	case BucketDaily, BucketWeekly:
+		query = `
+		SELECT date_trunc($6, measured_at AT TIME ZONE $5) AS bucket, AVG(value)::float8, COUNT(*)
+		FROM measurements
+		WHERE user_id = $1 AND measurement_type = $2
+		AND ($3::timestamptz IS NULL OR measured_at >= $3)
+		AND ($4::timestamptz IS NULL OR measured_at < $4)
+		GROUP BY bucket
+		ORDER BY bucket
+		`
+		args = []interface{}{userID, q.Type, q.From, q.To, loc.String(), q.Bucket}
+	default:
+		return nil, fmt.Errorf("invalid bucket %q", q.Bucket)
+	}
+
+	rows, err := pg.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	points := []SeriesPoint{}
+	for rows.Next() {
+		var p SeriesPoint
+		var local time.Time
+		err = rows.Scan(&local, &p.Value, &p.Count)
+		if err != nil {
+			return nil, err
+		}
+		// the database hands back a wall-clock time, pin it to the location
+		p.At = time.Date(local.Year(), local.Month(), local.Day(), local.Hour(), local.Minute(), local.Second(), local.Nanosecond(), loc)
+		points = append(points, p)
+	}
+
+	return points, rows.Err()
+}
+
+// MovingAverage sets each point's Trend to the mean of the trailing window
+// points, itself included. Points before the window fills get the mean of
+// what is available so the trend line starts with the data.
+func MovingAverage(points []SeriesPoint, window int) {
+	if window < 1 {
+		return
+	}
+
+	sum := 0.0
+	for i := range points {
+		sum += points[i].Value
+		if i >= window {
+			sum -= points[i-window].Value
+		}
+		n := min(i+1, window)
+		trend := math.Round(sum/float64(n)*1000) / 1000
+		points[i].Trend = &trend
+	}
+}
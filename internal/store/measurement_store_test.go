@@ -0,0 +1,61 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMovingAverage(t *testing.T) {
+	start := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	var points []SeriesPoint
+	for i, v := range []float64{80, 82, 81, 79, 78} {
+		points = append(points, SeriesPoint{At: start.AddDate(0, 0, i), Value: v, Count: 1})
+	}
+
+	MovingAverage(points, 3)
+
+	want := []float64{80, 81, 81, 80.667, 79.333}
+	for i, p := range points {
+		require.NotNil(t, p.Trend)
+		assert.Equal(t, want[i], *p.Trend, "point %d", i)
+	}
+}
+
+func TestMeasurementNormalize(t *testing.T) {
+	m := Measurement{Type: MetricBodyweight, Value: 176.37, Unit: "lb"}
+	require.NoError(t, m.Normalize())
+	assert.Equal(t, "kg", m.Unit)
+	assert.InDelta(t, 80.0, m.Value, 0.01)
+
+	m.Convert("lb")
+	assert.Equal(t, 176.37, m.Value)
+
+	waist := Measurement{Type: "waist", Value: 32, Unit: "in"}
+	require.NoError(t, waist.Normalize())
+	assert.Equal(t, 81.28, waist.Value)
+
+	assert.Error(t, (&Measurement{Type: MetricBodyFat, Value: 120}).Normalize())
+	assert.Error(t, (&Measurement{Type: "shoe_size", Value: 10}).Normalize())
+}
+
+func TestMeasurementDefaultUnit(t *testing.T) {
+	m := Measurement{Type: MetricBodyweight, Value: 176.37}
+	m.DefaultUnit("lb")
+	require.NoError(t, m.Normalize())
+	assert.InDelta(t, 80.0, m.Value, 0.01)
+
+	waist := Measurement{Type: "waist", Value: 32}
+	waist.DefaultUnit("lb")
+	assert.Equal(t, "in", waist.Unit)
+
+	explicit := Measurement{Type: MetricBodyweight, Value: 80, Unit: "kg"}
+	explicit.DefaultUnit("lb")
+	assert.Equal(t, "kg", explicit.Unit)
+
+	bodyFat := Measurement{Type: MetricBodyFat, Value: 18}
+	bodyFat.DefaultUnit("lb")
+	assert.Equal(t, "%", bodyFat.Unit)
+}
@@ -1,6 +1,7 @@
 package store
 
 import (
+	"context"
 	"database/sql"
 	"time"
 
@@ -18,36 +19,42 @@ func NewPostgresTokenStore(db *sql.DB) *PostgresTokenStore {
 }
 
 type TokenStore interface {
-	Insert(token *tokens.Token) error
-	CreateNewToken(userID int64, ttl time.Duration, scope string) (*tokens.Token, error)
-	DeleteAllTokensForUser(userID int64, scope string) error
+	Insert(ctx context.Context, token *tokens.Token) error
+	CreateNewToken(ctx context.Context, userID int64, ttl time.Duration, scope string) (*tokens.Token, error)
+	DeleteAllTokensForUser(ctx context.Context, userID int64, scope string) error
 }
 
-func (t *PostgresTokenStore) CreateNewToken(userID int64, ttl time.Duration, scope string) (*tokens.Token, error) {
+func (t *PostgresTokenStore) CreateNewToken(ctx context.Context, userID int64, ttl time.Duration, scope string) (*tokens.Token, error) {
 	token, err := tokens.GenerateToken(userID, ttl, scope)
 	if err != nil {
 		return nil, err
 	}
 
-	err = t.Insert(token)
+	err = t.Insert(ctx, token)
 	return token, err
 }
 
-func (t *PostgresTokenStore) Insert(token *tokens.Token) error {
+func (t *PostgresTokenStore) Insert(ctx context.Context, token *tokens.Token) error {
+	ctx, cancel := startQuery(ctx, "Insert")
+	defer cancel()
+
 	query := `
 	INSERT INTO tokens (hash, user_id, expiry, scope)
 	VALUES ($1, $2, $3, $4)
 	`
-	_, err := t.DB.Exec(query, token.Hash, token.UserID, token.Expiry, token.Scope)
+	_, err := t.DB.ExecContext(ctx, query, token.Hash, token.UserID, token.Expiry, token.Scope)
 	return err
 }
 
-func (t *PostgresTokenStore) DeleteAllTokensForUser(userID int64, scope string) error {
+func (t *PostgresTokenStore) DeleteAllTokensForUser(ctx context.Context, userID int64, scope string) error {
+	ctx, cancel := startQuery(ctx, "DeleteAllTokensForUser")
+	defer cancel()
+
 	query := `
 	DELETE FROM tokens
 	WHERE scope = $1 AND user_id = $2
    `
 
-	_, err := t.DB.Exec(query, scope, userID)
+	_, err := t.DB.ExecContext(ctx, query, scope, userID)
 	return err
 }
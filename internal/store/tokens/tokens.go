@@ -8,7 +8,8 @@ import (
 )
 
 const (
-	ScopeAuth = "authentication"
+	ScopeAuth     = "authentication"
+	ScopeCalendar = "calendar"
 )
 
 type Token struct {
@@ -1,23 +1,27 @@
 package store
 
 import (
+	"context"
 	"crypto/sha256"
 	"database/sql"
 	"errors"
 	"time"
 
+	"github.com/cykj40/beginner_go/internal/units"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type User struct {
-	ID           int64
-	Username     string
-	Email        string
-	Password     Password
-	PasswordHash []byte
-	Bio          string
-	CreatedAt    time.Time
-	UpdatedAt    time.Time
+	ID            int64     `json:"id"`
+	Username      string    `json:"username"`
+	Email         string    `json:"email"`
+	Password      Password  `json:"-"`
+	PasswordHash  []byte    `json:"-"`
+	Bio           string    `json:"bio"`
+	PreferredUnit string    `json:"preferred_unit"`
+	BodyWeightKg  *float64  `json:"body_weight_kg"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
 }
 
 var AnonymousUser = &User{}
@@ -26,13 +30,21 @@ func (u *User) IsAnonymous() bool {
 	return u == AnonymousUser
 }
 
+var bcryptCost = 12
+
+// SetBcryptCost sets the cost of password hashes created from now on.
+// Existing hashes keep the cost they were created with.
+func SetBcryptCost(cost int) {
+	bcryptCost = cost
+}
+
 type Password struct {
 	plainText *string
 	Hash      []byte
 }
 
 func (p *Password) Set(plaintextPassword string) error {
-	hash, err := bcrypt.GenerateFromPassword([]byte(plaintextPassword), 12)
+	hash, err := bcrypt.GenerateFromPassword([]byte(plaintextPassword), bcryptCost)
 	if err != nil {
 		return err
 	}
@@ -64,21 +76,28 @@ func NewPostgresUserStore(db *sql.DB) *PostgresUserStore {
 }
 
 type UserStore interface {
-	CreateUser(*User) error
-	GetUserByUsername(username string) (*User, error)
-	GetUserByEmail(email string) (*User, error)
-	UpdateUser(*User) error
-	GetUserToken(scope, tokenPlainText string) (*User, error)
+	CreateUser(ctx context.Context, user *User) error
+	GetUserByUsername(ctx context.Context, username string) (*User, error)
+	GetUserByEmail(ctx context.Context, email string) (*User, error)
+	UpdateUser(ctx context.Context, user *User) error
+	GetUserToken(ctx context.Context, scope, tokenPlainText string) (*User, error)
 }
 
-func (s *PostgresUserStore) CreateUser(user *User) error {
+func (s *PostgresUserStore) CreateUser(ctx context.Context, user *User) error {
+	ctx, cancel := startQuery(ctx, "CreateUser")
+	defer cancel()
+
 	query := `
-	INSERT INTO users (username, email, password_hash, bio)
-	VALUES ($1, $2, $3, $4)
+	INSERT INTO users (username, email, password_hash, bio, preferred_unit)
+	VALUES ($1, $2, $3, $4, $5)
 	RETURNING id, created_at, updated_at 
 	`
 
-	err := s.db.QueryRow(query, user.Username, user.Email, user.PasswordHash, user.Bio).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
+	if user.PreferredUnit == "" {
+		user.PreferredUnit = units.Kilograms
+	}
+
+	err := s.db.QueryRowContext(ctx, query, user.Username, user.Email, user.PasswordHash, user.Bio, user.PreferredUnit).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
 	if err != nil {
 		return err
 	}
@@ -86,20 +105,25 @@ func (s *PostgresUserStore) CreateUser(user *User) error {
 	return nil
 }
 
-func (s *PostgresUserStore) GetUserByUsername(username string) (*User, error) {
+func (s *PostgresUserStore) GetUserByUsername(ctx context.Context, username string) (*User, error) {
+	ctx, cancel := startQuery(ctx, "GetUserByUsername")
+	defer cancel()
+
 	query := `
-	SELECT id, username, email, password_hash, bio, created_at, updated_at
+	SELECT id, username, email, password_hash, bio, preferred_unit, body_weight_kg, created_at, updated_at
 	FROM users
 	WHERE username = $1
 	`
 
 	user := &User{}
-	err := s.db.QueryRow(query, username).Scan(
+	err := s.db.QueryRowContext(ctx, query, username).Scan(
 		&user.ID,
 		&user.Username,
 		&user.Email,
 		&user.PasswordHash,
 		&user.Bio,
+		&user.PreferredUnit,
+		&user.BodyWeightKg,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -116,20 +140,25 @@ func (s *PostgresUserStore) GetUserByUsername(username string) (*User, error) {
 	return user, nil
 }
 
-func (s *PostgresUserStore) GetUserByEmail(email string) (*User, error) {
+func (s *PostgresUserStore) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	ctx, cancel := startQuery(ctx, "GetUserByEmail")
+	defer cancel()
+
 	query := `
-	SELECT id, username, email, password_hash, bio, created_at, updated_at
+	SELECT id, username, email, password_hash, bio, preferred_unit, body_weight_kg, created_at, updated_at
 	FROM users
 	WHERE email = $1
 	`
 
 	user := &User{}
-	err := s.db.QueryRow(query, email).Scan(
+	err := s.db.QueryRowContext(ctx, query, email).Scan(
 		&user.ID,
 		&user.Username,
 		&user.Email,
 		&user.PasswordHash,
 		&user.Bio,
+		&user.PreferredUnit,
+		&user.BodyWeightKg,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -146,15 +175,18 @@ func (s *PostgresUserStore) GetUserByEmail(email string) (*User, error) {
 	return user, nil
 }
 
-func (s *PostgresUserStore) UpdateUser(user *User) error {
+func (s *PostgresUserStore) UpdateUser(ctx context.Context, user *User) error {
+	ctx, cancel := startQuery(ctx, "UpdateUser")
+	defer cancel()
+
 	query := `
 	UPDATE users
-	SET username = $1, email = $2, bio = $3, updated_at = CURRENT_TIMESTAMP
-	WHERE id = $4 
+	SET username = $1, email = $2, bio = $3, preferred_unit = $4, body_weight_kg = $5, updated_at = CURRENT_TIMESTAMP
+	WHERE id = $6 
 	RETURNING updated_at
 	`
 
-	result, err := s.db.Exec(query, user.Username, user.Email, user.Bio, user.ID)
+	result, err := s.db.ExecContext(ctx, query, user.Username, user.Email, user.Bio, user.PreferredUnit, user.BodyWeightKg, user.ID)
 	if err != nil {
 		return err
 	}
@@ -169,11 +201,14 @@ func (s *PostgresUserStore) UpdateUser(user *User) error {
 	return nil
 }
 
-func (s *PostgresUserStore) GetUserToken(scope, plaintextPassword string) (*User, error) {
+func (s *PostgresUserStore) GetUserToken(ctx context.Context, scope, plaintextPassword string) (*User, error) {
+	ctx, cancel := startQuery(ctx, "GetUserToken")
+	defer cancel()
+
 	tokenHash := sha256.Sum256([]byte(plaintextPassword))
 
 	query := `
-	SELECT u.id, u.username, u.email, u.password_hash, u.bio, u.created_at, u.updated_at
+	SELECT u.id, u.username, u.email, u.password_hash, u.bio, u.preferred_unit, u.body_weight_kg, u.created_at, u.updated_at
 	FROM users u
 	INNER JOIN tokens t ON u.id = t.user_id
 	WHERE t.hash = $1 AND t.scope = $2 AND t.expiry > $3
@@ -181,12 +216,14 @@ func (s *PostgresUserStore) GetUserToken(scope, plaintextPassword string) (*User
 
 	user := &User{}
 
-	err := s.db.QueryRow(query, tokenHash[:], scope, time.Now()).Scan(
+	err := s.db.QueryRowContext(ctx, query, tokenHash[:], scope, time.Now()).Scan(
 		&user.ID,
 		&user.Username,
 		&user.Email,
 		&user.PasswordHash,
 		&user.Bio,
+		&user.PreferredUnit,
+		&user.BodyWeightKg,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -0,0 +1,103 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// WorkoutActivity is the raw GPS/sensor recording a workout was imported
+// from, kept so the original file can be downloaded again
+type WorkoutActivity struct {
+	WorkoutID           int       `json:"workout_id"`
+	Format              string    `json:"format"`
+	Filename            string    `json:"filename"`
+	RawData             []byte    `json:"-"`
+	Sport               string    `json:"sport"`
+	DistanceMeters      *float64  `json:"distance_meters"`
+	ElevationGainMeters *float64  `json:"elevation_gain_meters"`
+	AvgHeartRate        *int      `json:"avg_heart_rate"`
+	MaxHeartRate        *int      `json:"max_heart_rate"`
+	CreatedAt           time.Time `json:"created_at"`
+}
+
+func (pg *PostgresWorkoutStore) CreateWorkoutWithActivity(ctx context.Context, workout *Workout, activity *WorkoutActivity) (*Workout, error) {
+	ctx, cancel := startQuery(ctx, "CreateWorkoutWithActivity")
+	defer cancel()
+
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	err = insertWorkout(ctx, tx, workout)
+	if err != nil {
+		return nil, err
+	}
+
+	activity.WorkoutID = workout.ID
+	query := `
+	INSERT INTO workout_activities (workout_id, format, filename, raw_data, sport, distance_meters, elevation_gain_meters, avg_heart_rate, max_heart_rate)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	RETURNING created_at
+	`
+	err = tx.QueryRowContext(ctx, query,
+		activity.WorkoutID,
+		activity.Format,
+		activity.Filename,
+		activity.RawData,
+		activity.Sport,
+		activity.DistanceMeters,
+		activity.ElevationGainMeters,
+		activity.AvgHeartRate,
+		activity.MaxHeartRate,
+	).Scan(&activity.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	workout.localizeTimes()
+	return workout, nil
+}
+
+func (pg *PostgresWorkoutStore) GetWorkoutActivity(ctx context.Context, workoutID int64) (*WorkoutActivity, error) {
+	ctx, cancel := startQuery(ctx, "GetWorkoutActivity")
+	defer cancel()
+
+	activity := &WorkoutActivity{}
+	var filename, sport sql.NullString
+	query := `
+	SELECT wa.workout_id, wa.format, wa.filename, wa.raw_data, wa.sport, wa.distance_meters, wa.elevation_gain_meters, wa.avg_heart_rate, wa.max_heart_rate, wa.created_at
+	FROM workout_activities wa
+	JOIN workouts w ON w.id = wa.workout_id
+	WHERE wa.workout_id = $1 AND w.deleted_at IS NULL
+	`
+	err := pg.db.QueryRowContext(ctx, query, workoutID).Scan(
+		&activity.WorkoutID,
+		&activity.Format,
+		&filename,
+		&activity.RawData,
+		&sport,
+		&activity.DistanceMeters,
+		&activity.ElevationGainMeters,
+		&activity.AvgHeartRate,
+		&activity.MaxHeartRate,
+		&activity.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	activity.Filename = filename.String
+	activity.Sport = sport.String
+	return activity, nil
+}
@@ -0,0 +1,173 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+const (
+	GroupTypeSuperset = "superset"
+	GroupTypeCircuit  = "circuit"
+	GroupTypeEMOM     = "emom"
+	GroupTypeAMRAP    = "amrap"
+)
+
+// EntryGroup ties several entries together, e.g. a superset or a 3 round
+// circuit. Entries join a group through WorkoutEntry.GroupIndex, the
+// group's position in Workout.Groups. Entries is only filled in on reads.
+type EntryGroup struct {
+	ID               int            `json:"id"`
+	GroupType        string         `json:"group_type"`
+	Name             *string        `json:"name"`
+	Rounds           int            `json:"rounds"`
+	RestSeconds      *int           `json:"rest_seconds"`
+	RoundRestSeconds *int           `json:"round_rest_seconds"`
+	IntervalSeconds  *int           `json:"interval_seconds"`
+	OrderIndex       int            `json:"order_index"`
+	Entries          []WorkoutEntry `json:"entries,omitempty"`
+}
+
+// ValidateGroups checks each group, that no two groups share an
+// order_index and that every entry points at a group that exists. An
+// order_index of 0 is filled in from the group's position on insert.
+func (w *Workout) ValidateGroups() error {
+	orderIndexes := make(map[int]bool, len(w.Groups))
+	for i := range w.Groups {
+		group := &w.Groups[i]
+		if group.Rounds == 0 {
+			group.Rounds = 1
+		}
+
+		switch group.GroupType {
+		case GroupTypeSuperset, GroupTypeCircuit:
+		case GroupTypeEMOM, GroupTypeAMRAP:
+			if group.IntervalSeconds == nil || *group.IntervalSeconds <= 0 {
+				return fmt.Errorf("groups[%d]: interval_seconds is required for %s groups", i, group.GroupType)
+			}
+		default:
+			return fmt.Errorf("groups[%d]: group_type must be one of %s, %s, %s or %s", i, GroupTypeSuperset, GroupTypeCircuit, GroupTypeEMOM, GroupTypeAMRAP)
+		}
+
+		if group.Rounds < 1 {
+			return fmt.Errorf("groups[%d]: rounds must be at least 1", i)
+		}
+		if (group.RestSeconds != nil && *group.RestSeconds < 0) || (group.RoundRestSeconds != nil && *group.RoundRestSeconds < 0) {
+			return fmt.Errorf("groups[%d]: rest cannot be negative", i)
+		}
+
+		if group.OrderIndex < 0 {
+			return fmt.Errorf("groups[%d]: order_index cannot be negative", i)
+		}
+		if group.OrderIndex > 0 {
+			if orderIndexes[group.OrderIndex] {
+				return fmt.Errorf("groups[%d]: order_index %d is used by another group", i, group.OrderIndex)
+			}
+			orderIndexes[group.OrderIndex] = true
+		}
+	}
+
+	for i, entry := range w.Entries {
+		if entry.GroupIndex != nil && (*entry.GroupIndex < 0 || *entry.GroupIndex >= len(w.Groups)) {
+			return fmt.Errorf("entries[%d]: group_index does not refer to a group", i)
+		}
+	}
+
+	return nil
+}
+
+// insertEntryGroups stores the workout's groups and returns their IDs in
+// the same order, for entries to reference
+func insertEntryGroups(ctx context.Context, tx *sql.Tx, workout *Workout) ([]int, error) {
+	ids := make([]int, len(workout.Groups))
+	for i := range workout.Groups {
+		group := &workout.Groups[i]
+		if group.Rounds == 0 {
+			group.Rounds = 1
+		}
+		if group.OrderIndex == 0 {
+			group.OrderIndex = i + 1
+		}
+
+		query := `
+		INSERT INTO workout_entry_groups (workout_id, group_type, name, rounds, rest_seconds, round_rest_seconds, interval_seconds, order_index)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id
+		`
+		err := tx.QueryRowContext(ctx, query,
+			workout.ID,
+			group.GroupType,
+			group.Name,
+			group.Rounds,
+			group.RestSeconds,
+			group.RoundRestSeconds,
+			group.IntervalSeconds,
+			group.OrderIndex,
+		).Scan(&group.ID)
+		if err != nil {
+			return nil, err
+		}
+		ids[i] = group.ID
+	}
+	return ids, nil
+}
+
+func (pg *PostgresWorkoutStore) getEntryGroups(ctx context.Context, workoutID int64) ([]EntryGroup, error) {
+	query := `
+	SELECT id, group_type, name, rounds, rest_seconds, round_rest_seconds, interval_seconds, order_index
+	FROM workout_entry_groups
+	WHERE workout_id = $1
+	ORDER BY order_index, id
+	`
+
+	rows, err := pg.db.QueryContext(ctx, query, workoutID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []EntryGroup
+	for rows.Next() {
+		var group EntryGroup
+		err = rows.Scan(
+			&group.ID,
+			&group.GroupType,
+			&group.Name,
+			&group.Rounds,
+			&group.RestSeconds,
+			&group.RoundRestSeconds,
+			&group.IntervalSeconds,
+			&group.OrderIndex,
+		)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+
+	return groups, rows.Err()
+}
+
+// nestEntries resolves each entry's group_id to its GroupIndex and copies
+// the entries into their groups for the nested response
+func nestEntries(workout *Workout, groupIDs map[int]int64) error {
+	positions := map[int64]int{}
+	for i, group := range workout.Groups {
+		positions[int64(group.ID)] = i
+	}
+
+	for i := range workout.Entries {
+		groupID, ok := groupIDs[workout.Entries[i].ID]
+		if !ok {
+			continue
+		}
+		pos, ok := positions[groupID]
+		if !ok {
+			return errors.New("workout entry references a group of another workout")
+		}
+		workout.Entries[i].GroupIndex = &pos
+		workout.Groups[pos].Entries = append(workout.Groups[pos].Entries, workout.Entries[i])
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateGroups(t *testing.T) {
+	tests := []struct {
+		name    string
+		workout Workout
+		wantErr string
+	}{
+		{
+			name: "superset and circuit",
+			workout: Workout{
+				Groups:  []EntryGroup{{GroupType: GroupTypeSuperset}, {GroupType: GroupTypeCircuit, Rounds: 3}},
+				Entries: []WorkoutEntry{{GroupIndex: IntPtr(0)}, {GroupIndex: IntPtr(1)}, {}},
+			},
+		},
+		{
+			name:    "emom with interval",
+			workout: Workout{Groups: []EntryGroup{{GroupType: GroupTypeEMOM, IntervalSeconds: IntPtr(60)}}},
+		},
+		{
+			name:    "explicit order",
+			workout: Workout{Groups: []EntryGroup{{GroupType: GroupTypeSuperset, OrderIndex: 2}, {GroupType: GroupTypeSuperset, OrderIndex: 1}}},
+		},
+		{
+			name:    "unknown type",
+			workout: Workout{Groups: []EntryGroup{{GroupType: "tabata"}}},
+			wantErr: "groups[0]: group_type must be one of",
+		},
+		{
+			name:    "amrap without interval",
+			workout: Workout{Groups: []EntryGroup{{GroupType: GroupTypeAMRAP}}},
+			wantErr: "groups[0]: interval_seconds is required",
+		},
+		{
+			name:    "negative rounds",
+			workout: Workout{Groups: []EntryGroup{{GroupType: GroupTypeCircuit, Rounds: -1}}},
+			wantErr: "groups[0]: rounds must be at least 1",
+		},
+		{
+			name:    "negative rest",
+			workout: Workout{Groups: []EntryGroup{{GroupType: GroupTypeCircuit, RoundRestSeconds: IntPtr(-30)}}},
+			wantErr: "groups[0]: rest cannot be negative",
+		},
+		{
+			name:    "negative order",
+			workout: Workout{Groups: []EntryGroup{{GroupType: GroupTypeSuperset, OrderIndex: -1}}},
+			wantErr: "groups[0]: order_index cannot be negative",
+		},
+		{
+			name:    "duplicate order",
+			workout: Workout{Groups: []EntryGroup{{GroupType: GroupTypeSuperset, OrderIndex: 1}, {GroupType: GroupTypeCircuit, OrderIndex: 1}}},
+			wantErr: "groups[1]: order_index 1 is used by another group",
+		},
+		{
+			name: "entry in a missing group",
+			workout: Workout{
+				Groups:  []EntryGroup{{GroupType: GroupTypeSuperset}},
+				Entries: []WorkoutEntry{{GroupIndex: IntPtr(0)}, {GroupIndex: IntPtr(1)}},
+			},
+			wantErr: "entries[1]: group_index does not refer to a group",
+		},
+		{
+			name:    "negative group index",
+			workout: Workout{Entries: []WorkoutEntry{{GroupIndex: IntPtr(-1)}}},
+			wantErr: "entries[0]: group_index does not refer to a group",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.workout.ValidateGroups()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,323 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// WorkoutRevision is an immutable snapshot of a workout and its entries,
+// taken every time the workout is saved. Revision 1 is the workout as
+// created.
+type WorkoutRevision struct {
+	ID        int64     `json:"id"`
+	WorkoutID int64     `json:"workout_id"`
+	Revision  int       `json:"revision"`
+	EditorID  *int64    `json:"editor_id"`
+	CreatedAt time.Time `json:"created_at"`
+	Workout   *Workout  `json:"workout,omitempty"`
+}
+
+// insertWorkoutRevision snapshots the workout as saved by tx. The workout
+// row is locked first so concurrent saves number their revisions one after
+// the other instead of both picking the same next number.
+func insertWorkoutRevision(ctx context.Context, tx *sql.Tx, workout *Workout, editorID int64) error {
+	snapshot, err := json.Marshal(workout)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `SELECT id FROM workouts WHERE id = $1 FOR UPDATE`, workout.ID)
+	if err != nil {
+		return err
+	}
+
+	query := `
+	INSERT INTO workout_revisions (workout_id, revision, editor_id, snapshot)
+	SELECT $1, COALESCE(MAX(revision), 0) + 1, $2, $3
+	FROM workout_revisions
+	WHERE workout_id = $1
+	`
+	_, err = tx.ExecContext(ctx, query, workout.ID, editorID, snapshot)
+	return err
+}
+
+// unrevisionedWorkout returns the workout as it stands when it predates
+// revision history and so has no revision 1 yet, and nil otherwise
+func (pg *PostgresWorkoutStore) unrevisionedWorkout(ctx context.Context, id int64) (*Workout, error) {
+	var exists bool
+	query := `SELECT EXISTS (SELECT 1 FROM workout_revisions WHERE workout_id = $1)`
+	err := pg.db.QueryRowContext(ctx, query, id).Scan(&exists)
+	if err != nil || exists {
+		return nil, err
+	}
+	return pg.GetWorkoutByID(ctx, id)
+}
+
+// insertFirstRevision records original as revision 1 unless a concurrent
+// save already did
+func insertFirstRevision(ctx context.Context, tx *sql.Tx, original *Workout) error {
+	snapshot, err := json.Marshal(original)
+	if err != nil {
+		return err
+	}
+
+	query := `
+	INSERT INTO workout_revisions (workout_id, revision, editor_id, snapshot)
+	SELECT $1, 1, $2, $3
+	WHERE NOT EXISTS (SELECT 1 FROM workout_revisions WHERE workout_id = $1)
+	`
+	_, err = tx.ExecContext(ctx, query, original.ID, original.UserID, snapshot)
+	return err
+}
+
+func (pg *PostgresWorkoutStore) ListWorkoutRevisions(ctx context.Context, workoutID int64) ([]WorkoutRevision, error) {
+	ctx, cancel := startQuery(ctx, "ListWorkoutRevisions")
+	defer cancel()
+
+	query := `
+	SELECT id, workout_id, revision, editor_id, created_at
+	FROM workout_revisions
+	WHERE workout_id = $1
+	ORDER BY revision DESC
+	`
+	rows, err := pg.db.QueryContext(ctx, query, workoutID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []WorkoutRevision{}
+	for rows.Next() {
+		var rev WorkoutRevision
+		err = rows.Scan(&rev.ID, &rev.WorkoutID, &rev.Revision, &rev.EditorID, &rev.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, rev)
+	}
+	return revisions, rows.Err()
+}
+
+// GetWorkoutRevision returns the revision with its snapshot, or the latest
+// revision when revision is 0
+func (pg *PostgresWorkoutStore) GetWorkoutRevision(ctx context.Context, workoutID int64, revision int) (*WorkoutRevision, error) {
+	ctx, cancel := startQuery(ctx, "GetWorkoutRevision")
+	defer cancel()
+
+	rev := &WorkoutRevision{}
+	var snapshot []byte
+	query := `
+	SELECT id, workout_id, revision, editor_id, created_at, snapshot
+	FROM workout_revisions
+	WHERE workout_id = $1 AND ($2 = 0 OR revision = $2)
+	ORDER BY revision DESC
+	LIMIT 1
+	`
+	err := pg.db.QueryRowContext(ctx, query, workoutID, revision).Scan(&rev.ID, &rev.WorkoutID, &rev.Revision, &rev.EditorID, &rev.CreatedAt, &snapshot)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rev.Workout = &Workout{}
+	err = json.Unmarshal(snapshot, rev.Workout)
+	if err != nil {
+		return nil, fmt.Errorf("decoding revision %d of workout %d: %w", rev.Revision, workoutID, err)
+	}
+	return rev, nil
+}
+
+type FieldChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+const (
+	EntryAdded   = "added"
+	EntryRemoved = "removed"
+	EntryChanged = "changed"
+)
+
+type EntryChange struct {
+	Change       string        `json:"change"`
+	ExerciseName string        `json:"exercise_name"`
+	FromIndex    *int          `json:"from_order_index,omitempty"`
+	ToIndex      *int          `json:"to_order_index,omitempty"`
+	Fields       []FieldChange `json:"fields,omitempty"`
+}
+
+type WorkoutDiff struct {
+	From    int           `json:"from"`
+	To      int           `json:"to"`
+	Fields  []FieldChange `json:"fields"`
+	Entries []EntryChange `json:"entries"`
+	Groups  []FieldChange `json:"groups,omitempty"`
+}
+
+// fields that identify a row rather than describe it, or are derived
+var diffIgnored = map[string]bool{
+	"id":                  true,
+	"user_id":             true,
+	"entries":             true,
+	"groups":              true,
+	"deleted_at":          true,
+	"pace_seconds_per_km": true,
+	"speed_kmh":           true,
+	"calories_estimated":  true,
+	"version":             true,
+}
+
+// DiffWorkouts compares two snapshots of a workout field by field. Entries
+// are paired by ID where both snapshots share one and by order_index
+// otherwise, since a full update re-creates entry rows.
+func DiffWorkouts(from, to *Workout) (WorkoutDiff, error) {
+	diff := WorkoutDiff{Fields: []FieldChange{}, Entries: []EntryChange{}}
+
+	var err error
+	diff.Fields, err = diffJSON(from, to)
+	if err != nil {
+		return diff, err
+	}
+
+	if !reflect.DeepEqual(stripGroupEntries(from.Groups), stripGroupEntries(to.Groups)) {
+		diff.Groups = []FieldChange{{Field: "groups", From: stripGroupEntries(from.Groups), To: stripGroupEntries(to.Groups)}}
+	}
+
+	pairedFrom := map[int]bool{}
+	pairedTo := map[int]bool{}
+	var pairs [][2]int
+
+	for i, a := range from.Entries {
+		for j, b := range to.Entries {
+			if !pairedTo[j] && a.ID != 0 && a.ID == b.ID {
+				pairs = append(pairs, [2]int{i, j})
+				pairedFrom[i], pairedTo[j] = true, true
+				break
+			}
+		}
+	}
+	for i, a := range from.Entries {
+		if pairedFrom[i] {
+			continue
+		}
+		for j, b := range to.Entries {
+			if !pairedTo[j] && a.OrderIndex == b.OrderIndex {
+				pairs = append(pairs, [2]int{i, j})
+				pairedFrom[i], pairedTo[j] = true, true
+				break
+			}
+		}
+	}
+
+	for _, pair := range pairs {
+		a, b := from.Entries[pair[0]], to.Entries[pair[1]]
+		fields, err := diffJSON(a, b)
+		if err != nil {
+			return diff, err
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		diff.Entries = append(diff.Entries, EntryChange{
+			Change:       EntryChanged,
+			ExerciseName: b.ExerciseName,
+			FromIndex:    &a.OrderIndex,
+			ToIndex:      &b.OrderIndex,
+			Fields:       fields,
+		})
+	}
+	for i := range from.Entries {
+		if !pairedFrom[i] {
+			diff.Entries = append(diff.Entries, EntryChange{Change: EntryRemoved, ExerciseName: from.Entries[i].ExerciseName, FromIndex: &from.Entries[i].OrderIndex})
+		}
+	}
+	for j := range to.Entries {
+		if !pairedTo[j] {
+			diff.Entries = append(diff.Entries, EntryChange{Change: EntryAdded, ExerciseName: to.Entries[j].ExerciseName, ToIndex: &to.Entries[j].OrderIndex})
+		}
+	}
+
+	return diff, nil
+}
+
+func stripGroupEntries(groups []EntryGroup) []EntryGroup {
+	stripped := make([]EntryGroup, len(groups))
+	for i, group := range groups {
+		group.ID = 0
+		group.Entries = nil
+		stripped[i] = group
+	}
+	return stripped
+}
+
+// diffJSON compares the JSON form of two values key by key, so new fields
+// are picked up without touching the diff
+func diffJSON(from, to interface{}) ([]FieldChange, error) {
+	a, err := jsonFields(from)
+	if err != nil {
+		return nil, err
+	}
+	b, err := jsonFields(to)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := map[string]bool{}
+	for k := range a {
+		keys[k] = true
+	}
+	for k := range b {
+		keys[k] = true
+	}
+
+	changes := []FieldChange{}
+	for k := range keys {
+		if diffIgnored[k] || reflect.DeepEqual(a[k], b[k]) {
+			continue
+		}
+		changes = append(changes, FieldChange{Field: k, From: a[k], To: b[k]})
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes, nil
+}
+
+func jsonFields(v interface{}) (map[string]interface{}, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]interface{}{}
+	err = json.Unmarshal(raw, &fields)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range fields {
+		fields[k] = stripIDs(v)
+	}
+	return fields, nil
+}
+
+// stripIDs drops row IDs from nested values such as set_details, which are
+// re-created on every save
+func stripIDs(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		delete(v, "id")
+		for k, nested := range v {
+			v[k] = stripIDs(nested)
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = stripIDs(v[i])
+		}
+	}
+	return v
+}
@@ -0,0 +1,55 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffWorkouts(t *testing.T) {
+	from := &Workout{
+		ID:              1,
+		Title:           "push day",
+		DurationMinutes: 60,
+		Entries: []WorkoutEntry{
+			{ID: 10, ExerciseName: "bench press", Sets: 3, Reps: IntPtr(10), Weight: FloatPtr(80), OrderIndex: 0},
+			{ID: 11, ExerciseName: "dips", Sets: 3, Reps: IntPtr(12), OrderIndex: 1},
+		},
+	}
+	// a full update re-creates entry rows, so IDs no longer line up
+	to := &Workout{
+		ID:              1,
+		Title:           "push day",
+		DurationMinutes: 75,
+		Entries: []WorkoutEntry{
+			{ID: 20, ExerciseName: "bench press", Sets: 3, Reps: IntPtr(10), Weight: FloatPtr(85), OrderIndex: 0},
+			{ID: 21, ExerciseName: "dips", Sets: 3, Reps: IntPtr(12), OrderIndex: 1},
+			{ID: 22, ExerciseName: "push ups", Sets: 2, Reps: IntPtr(20), OrderIndex: 2},
+		},
+	}
+
+	diff, err := DiffWorkouts(from, to)
+	require.NoError(t, err)
+
+	assert.Equal(t, []FieldChange{{Field: "duration_minutes", From: float64(60), To: float64(75)}}, diff.Fields)
+	require.Len(t, diff.Entries, 2)
+
+	assert.Equal(t, EntryChanged, diff.Entries[0].Change)
+	assert.Equal(t, "bench press", diff.Entries[0].ExerciseName)
+	assert.Equal(t, []FieldChange{{Field: "weight", From: float64(80), To: float64(85)}}, diff.Entries[0].Fields)
+
+	assert.Equal(t, EntryAdded, diff.Entries[1].Change)
+	assert.Equal(t, "push ups", diff.Entries[1].ExerciseName)
+}
+
+func TestDiffWorkoutsIgnoresVersion(t *testing.T) {
+	from := &Workout{ID: 1, Title: "push day", Version: 3}
+	to := &Workout{ID: 1, Title: "push day", Version: 4}
+
+	diff, err := DiffWorkouts(from, to)
+	require.NoError(t, err)
+	assert.Empty(t, diff.Fields)
+	assert.Empty(t, diff.Entries)
+	assert.Empty(t, diff.Groups)
+}
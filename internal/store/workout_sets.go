@@ -0,0 +1,188 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+const (
+	SetTypeWarmUp  = "warm_up"
+	SetTypeWorking = "working"
+	SetTypeDrop    = "drop"
+	SetTypeFailure = "failure"
+)
+
+type WorkoutSet struct {
+	ID              int      `json:"id"`
+	SetIndex        int      `json:"set_index"`
+	SetType         string   `json:"set_type"`
+	Reps            *int     `json:"reps"`
+	Weight          *float64 `json:"weight"`
+	DurationSeconds *int     `json:"duration_seconds"`
+	RPE             *float64 `json:"rpe"`
+	Completed       *bool    `json:"completed"`
+}
+
+func (s *WorkoutSet) validate() error {
+	switch s.SetType {
+	case SetTypeWarmUp, SetTypeWorking, SetTypeDrop, SetTypeFailure:
+	default:
+		return fmt.Errorf("set_type must be one of %s, %s, %s or %s", SetTypeWarmUp, SetTypeWorking, SetTypeDrop, SetTypeFailure)
+	}
+	if s.Reps != nil && *s.Reps < 0 {
+		return errors.New("reps cannot be negative")
+	}
+	if s.Weight != nil && *s.Weight < 0 {
+		return errors.New("weight cannot be negative")
+	}
+	if s.DurationSeconds != nil && *s.DurationSeconds < 0 {
+		return errors.New("duration_seconds cannot be negative")
+	}
+	if s.RPE != nil && (*s.RPE < 1 || *s.RPE > 10) {
+		return errors.New("rpe must be between 1 and 10")
+	}
+	return nil
+}
+
+// SummarizeSets keeps the flat Sets/Reps/Weight/DurationSeconds fields in
+// step with the logged sets for clients that predate per-set logging. The
+// summary describes the top completed working set (heaviest, then most
+// reps) and the number of working sets; warm-ups only count when nothing
+// else was logged. It also fills in set defaults and validates each set.
+func (e *WorkoutEntry) SummarizeSets() error {
+	if len(e.SetDetails) == 0 {
+		return nil
+	}
+
+	var top, fallback *WorkoutSet
+	working := 0
+	for i := range e.SetDetails {
+		set := &e.SetDetails[i]
+		set.SetIndex = i + 1
+		if set.SetType == "" {
+			set.SetType = SetTypeWorking
+		}
+		if set.Completed == nil {
+			completed := true
+			set.Completed = &completed
+		}
+		err := set.validate()
+		if err != nil {
+			return fmt.Errorf("set_details[%d]: %w", i, err)
+		}
+
+		if set.SetType == SetTypeWarmUp {
+			continue
+		}
+		working++
+		if fallback == nil {
+			fallback = set
+		}
+		if *set.Completed && (top == nil || heavierSet(set, top)) {
+			top = set
+		}
+	}
+
+	if top == nil {
+		top = fallback
+	}
+	if top == nil {
+		top = &e.SetDetails[0]
+		working = len(e.SetDetails)
+	}
+
+	e.Sets = working
+	e.Reps = top.Reps
+	e.Weight = top.Weight
+	if e.MeasurementType == MeasurementDistance || e.Distance != nil {
+		// distance entries keep their own total duration
+		return nil
+	}
+	e.DurationSeconds = top.DurationSeconds
+	if e.Reps != nil {
+		e.DurationSeconds = nil
+	}
+	return nil
+}
+
+func heavierSet(a, b *WorkoutSet) bool {
+	aw, bw := 0.0, 0.0
+	if a.Weight != nil {
+		aw = *a.Weight
+	}
+	if b.Weight != nil {
+		bw = *b.Weight
+	}
+	if aw != bw {
+		return aw > bw
+	}
+	ar, br := 0, 0
+	if a.Reps != nil {
+		ar = *a.Reps
+	}
+	if b.Reps != nil {
+		br = *b.Reps
+	}
+	return ar > br
+}
+
+// insertWorkoutSets expects SummarizeSets to have filled in the set defaults
+func insertWorkoutSets(ctx context.Context, tx *sql.Tx, entry *WorkoutEntry) error {
+	for i := range entry.SetDetails {
+		set := &entry.SetDetails[i]
+		query := `
+		INSERT INTO workout_sets (workout_entry_id, set_index, set_type, reps, weight, duration_seconds, rpe, completed)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id
+		`
+		err := tx.QueryRowContext(ctx, query, entry.ID, set.SetIndex, set.SetType, set.Reps, set.Weight, set.DurationSeconds, set.RPE, *set.Completed).Scan(&set.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getWorkoutSets loads every logged set of a workout keyed by entry ID
+func (pg *PostgresWorkoutStore) getWorkoutSets(ctx context.Context, workoutID int64) (map[int][]WorkoutSet, error) {
+	query := `
+	SELECT s.workout_entry_id, s.id, s.set_index, s.set_type, s.reps, s.weight, s.duration_seconds, s.rpe, s.completed
+	FROM workout_sets s
+	INNER JOIN workout_entries e ON e.id = s.workout_entry_id
+	WHERE e.workout_id = $1
+	ORDER BY s.workout_entry_id, s.set_index
+	`
+
+	rows, err := pg.db.QueryContext(ctx, query, workoutID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sets := map[int][]WorkoutSet{}
+	for rows.Next() {
+		var entryID int
+		var set WorkoutSet
+		var completed bool
+		err = rows.Scan(
+			&entryID,
+			&set.ID,
+			&set.SetIndex,
+			&set.SetType,
+			&set.Reps,
+			&set.Weight,
+			&set.DurationSeconds,
+			&set.RPE,
+			&completed,
+		)
+		if err != nil {
+			return nil, err
+		}
+		set.Completed = &completed
+		sets[entryID] = append(sets[entryID], set)
+	}
+
+	return sets, rows.Err()
+}
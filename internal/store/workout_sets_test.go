@@ -0,0 +1,41 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSummarizeSets(t *testing.T) {
+	entry := WorkoutEntry{
+		ExerciseName: "bench press",
+		SetDetails: []WorkoutSet{
+			{SetType: SetTypeWarmUp, Reps: IntPtr(15), Weight: FloatPtr(40)},
+			{Reps: IntPtr(12), Weight: FloatPtr(60)},
+			{Reps: IntPtr(10), Weight: FloatPtr(70)},
+			{Reps: IntPtr(8), Weight: FloatPtr(80)},
+			{SetType: SetTypeFailure, Reps: IntPtr(3), Weight: FloatPtr(85), Completed: BoolPtr(false)},
+		},
+	}
+
+	require.NoError(t, entry.SummarizeSets())
+	assert.Equal(t, 4, entry.Sets)
+	assert.Equal(t, 8, *entry.Reps)
+	assert.Equal(t, 80.0, *entry.Weight)
+	assert.Nil(t, entry.DurationSeconds)
+	assert.Equal(t, 5, entry.SetDetails[4].SetIndex)
+	assert.True(t, *entry.SetDetails[1].Completed)
+
+	require.NoError(t, entry.ResolveMeasurementType())
+	assert.Equal(t, MeasurementReps, entry.MeasurementType)
+}
+
+func TestSummarizeSetsRejectsUnknownSetType(t *testing.T) {
+	entry := WorkoutEntry{SetDetails: []WorkoutSet{{SetType: "cluster", Reps: IntPtr(5)}}}
+	assert.Error(t, entry.SummarizeSets())
+}
+
+func BoolPtr(b bool) *bool {
+	return &b
+}
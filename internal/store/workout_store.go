@@ -1,29 +1,199 @@
 package store
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/cykj40/beginner_go/internal/logging"
+	"github.com/cykj40/beginner_go/internal/units"
 )
 
 type Workout struct {
-	ID              int            `json:"id"`
-	UserID          int            `json:"user_id"`
-	Title           string         `json:"title"`
-	Description     string         `json:"description"`
-	DurationMinutes int            `json:"duration_minutes"`
-	CaloriesBurned  int            `json:"calories_burned"`
-	Entries         []WorkoutEntry `json:"entries"`
+	ID                int            `json:"id"`
+	UserID            int            `json:"user_id"`
+	Title             string         `json:"title"`
+	Description       string         `json:"description"`
+	DurationMinutes   int            `json:"duration_minutes"`
+	CaloriesBurned    int            `json:"calories_burned"`
+	CaloriesEstimated bool           `json:"calories_estimated"`
+	StartedAt         time.Time      `json:"started_at"`
+	EndedAt           *time.Time     `json:"ended_at"`
+	Timezone          string         `json:"timezone"`
+	Entries           []WorkoutEntry `json:"entries"`
+	Groups            []EntryGroup   `json:"groups,omitempty"`
+	Version           int            `json:"version"`
+	DeletedAt         *time.Time     `json:"deleted_at,omitempty"`
+}
+
+// ErrVersionConflict is returned when a write names a workout version that
+// is no longer current, because someone else saved in between
+var ErrVersionConflict = errors.New("workout version conflict")
+
+// Location returns the IANA location the workout was performed in,
+// falling back to UTC when the timezone is empty or unknown.
+func (w *Workout) Location() *time.Location {
+	if w.Timezone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(w.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// localizeTimes renders the performed-at timestamps in the workout's own timezone
+func (w *Workout) localizeTimes() {
+	loc := w.Location()
+	w.StartedAt = w.StartedAt.In(loc)
+	if w.EndedAt != nil {
+		endedAt := w.EndedAt.In(loc)
+		w.EndedAt = &endedAt
+	}
+}
+
+// WorkoutFilter narrows and orders workout listings by performed time.
+// From is inclusive and To is exclusive.
+type WorkoutFilter struct {
+	From *time.Time
+	To   *time.Time
+	Sort string
+}
+
+var workoutSortColumns = map[string]string{
+	"":            "started_at DESC, id DESC",
+	"-started_at": "started_at DESC, id DESC",
+	"started_at":  "started_at ASC, id ASC",
+}
+
+func ValidWorkoutSort(sort string) bool {
+	_, ok := workoutSortColumns[sort]
+	return ok
 }
 
 type WorkoutEntry struct {
-	ID              int      `json:"id"`
-	ExerciseName    string   `json:"exercise_name"`
-	Sets            int      `json:"sets"`
-	Reps            *int     `json:"reps"`
-	DurationSeconds *int     `json:"duration_seconds"`
-	Weight          *float64 `json:"weight"`
-	Notes           *string  `json:"notes"`
-	OrderIndex      int      `json:"order_index"`
+	ID                  int      `json:"id"`
+	ExerciseName        string   `json:"exercise_name"`
+	MeasurementType     string   `json:"measurement_type"`
+	Sets                int      `json:"sets"`
+	Reps                *int     `json:"reps"`
+	DurationSeconds     *int     `json:"duration_seconds"`
+	Weight              *float64 `json:"weight"`
+	WeightUnit          string   `json:"weight_unit,omitempty"` // applies to the set weights too
+	Distance            *float64 `json:"distance"`
+	DistanceUnit        *string  `json:"distance_unit"`
+	AvgHeartRate        *int     `json:"avg_heart_rate"`
+	MaxHeartRate        *int     `json:"max_heart_rate"`
+	ElevationGainMeters *float64 `json:"elevation_gain_meters"`
+	Cadence             *int     `json:"cadence"`
+	RPE                 *float64 `json:"rpe"`
+	Notes               *string  `json:"notes"`
+	OrderIndex          int      `json:"order_index"`
+	GroupIndex          *int     `json:"group_index,omitempty"`
+
+	// the individual sets; when present Sets, Reps, Weight and
+	// DurationSeconds are a summary derived from them
+	SetDetails []WorkoutSet `json:"set_details,omitempty"`
+
+	// derived from distance and duration, never stored
+	PaceSecondsPerKm *float64 `json:"pace_seconds_per_km,omitempty"`
+	SpeedKmh         *float64 `json:"speed_kmh,omitempty"`
+}
+
+const (
+	MeasurementReps     = "reps"
+	MeasurementDuration = "duration"
+	MeasurementDistance = "distance"
+)
+
+var distanceUnitMeters = map[string]float64{
+	"m":  1,
+	"km": 1000,
+	"mi": 1609.344,
+}
+
+// ResolveMeasurementType infers the measurement type from the fields that
+// are set when the client did not send one, then checks that the entry
+// carries what that type requires. It mirrors the valid_workout_entry CHECK.
+func (e *WorkoutEntry) ResolveMeasurementType() error {
+	e.inferMeasurementType()
+
+	switch e.MeasurementType {
+	case MeasurementReps:
+		if e.Reps == nil {
+			return errors.New("reps is required for reps entries")
+		}
+		if e.DurationSeconds != nil {
+			return errors.New("reps and duration_seconds cannot both be set")
+		}
+	case MeasurementDuration:
+		if e.DurationSeconds == nil {
+			return errors.New("duration_seconds is required for duration entries")
+		}
+		if e.Reps != nil {
+			return errors.New("reps and duration_seconds cannot both be set")
+		}
+	case MeasurementDistance:
+		if e.Distance == nil {
+			return errors.New("distance is required for distance entries")
+		}
+		if e.Reps != nil {
+			return errors.New("reps cannot be set on distance entries")
+		}
+	default:
+		return fmt.Errorf("measurement_type must be one of %s, %s or %s", MeasurementReps, MeasurementDuration, MeasurementDistance)
+	}
+
+	if e.Distance != nil {
+		if _, ok := distanceUnitMeters[*e.DistanceUnit]; !ok {
+			return errors.New("distance_unit must be one of m, km or mi")
+		}
+	}
+
+	return nil
+}
+
+func (e *WorkoutEntry) inferMeasurementType() {
+	if e.Distance != nil && e.DistanceUnit == nil {
+		unit := "km"
+		e.DistanceUnit = &unit
+	}
+	if e.MeasurementType != "" {
+		return
+	}
+	switch {
+	case e.Reps != nil:
+		e.MeasurementType = MeasurementReps
+	case e.Distance != nil:
+		e.MeasurementType = MeasurementDistance
+	default:
+		e.MeasurementType = MeasurementDuration
+	}
+}
+
+// computeDerived fills in pace and speed for entries that have both a
+// distance and a duration
+func (e *WorkoutEntry) computeDerived() {
+	e.PaceSecondsPerKm = nil
+	e.SpeedKmh = nil
+	if e.Distance == nil || e.DistanceUnit == nil || e.DurationSeconds == nil || *e.DurationSeconds <= 0 {
+		return
+	}
+	km := *e.Distance * distanceUnitMeters[*e.DistanceUnit] / 1000
+	if km <= 0 {
+		return
+	}
+
+	seconds := float64(*e.DurationSeconds)
+	pace := math.Round(seconds/km*10) / 10
+	speed := math.Round(km/(seconds/3600)*100) / 100
+	e.PaceSecondsPerKm = &pace
+	e.SpeedKmh = &speed
 }
 
 type PostgresWorkoutStore struct {
@@ -35,59 +205,232 @@ func NewPostgresWorkoutStore(db *sql.DB) *PostgresWorkoutStore {
 }
 
 type WorkoutStore interface {
-	CreateWorkout(*Workout) (*Workout, error)
-	GetWorkoutByID(id int64) (*Workout, error)
-	UpdateWorkout(*Workout) error
-	DeleteWorkout(id int64) error
-	GetWorkoutOwner(id int64) (int, error)
+	CreateWorkout(ctx context.Context, workout *Workout) (*Workout, error)
+	GetWorkoutByID(ctx context.Context, id int64) (*Workout, error)
+	ListWorkouts(ctx context.Context, userID int64, filter WorkoutFilter) ([]Workout, error)
+	UpdateWorkout(ctx context.Context, workout *Workout, editorID int64) error
+	DeleteWorkout(ctx context.Context, id int64, version int) error
+	GetWorkoutVersion(ctx context.Context, id int64) (int, error)
+	GetWorkoutOwner(ctx context.Context, id int64) (int, error)
+	CreateWorkouts(ctx context.Context, workouts []*Workout) error
+	CreateWorkoutWithActivity(ctx context.Context, workout *Workout, activity *WorkoutActivity) (*Workout, error)
+	GetWorkoutActivity(ctx context.Context, workoutID int64) (*WorkoutActivity, error)
+	ListTrashedWorkouts(ctx context.Context, userID int64) ([]Workout, error)
+	RestoreWorkout(ctx context.Context, id int64) error
+	PurgeDeletedWorkouts(ctx context.Context, before time.Time) (int64, error)
+	ListWorkoutRevisions(ctx context.Context, workoutID int64) ([]WorkoutRevision, error)
+	GetWorkoutRevision(ctx context.Context, workoutID int64, revision int) (*WorkoutRevision, error)
 }
 
-func (pg *PostgresWorkoutStore) CreateWorkout(workout *Workout) (*Workout, error) {
-	tx, err := pg.db.Begin()
+func (pg *PostgresWorkoutStore) CreateWorkout(ctx context.Context, workout *Workout) (*Workout, error) {
+	ctx, cancel := startQuery(ctx, "CreateWorkout")
+	defer cancel()
+
+	tx, err := pg.db.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, err
 	}
 	defer tx.Rollback()
 
-	query := `
-	INSERT INTO workouts (user_id, title, description, duration_minutes, calories_burned)
-	VALUES ($1, $2, $3, $4, $5)
-	RETURNING id
-	`
-	err = tx.QueryRow(query, workout.UserID, workout.Title, workout.Description, workout.DurationMinutes, workout.CaloriesBurned).Scan(&workout.ID)
+	err = insertWorkout(ctx, tx, workout)
 	if err != nil {
 		return nil, err
 	}
 
-	for i := range workout.Entries {
-		entry := &workout.Entries[i]
-		query := `
-		INSERT INTO workout_entries (workout_id, exercise_name, sets, reps, duration_seconds, weight, notes, order_index)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-		RETURNING id
-		`
-		err = tx.QueryRow(query, workout.ID, entry.ExerciseName, entry.Sets, entry.Reps, entry.DurationSeconds, entry.Weight, entry.Notes, entry.OrderIndex).Scan(&entry.ID)
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	workout.localizeTimes()
+	return workout, nil
+}
+
+// CreateWorkouts inserts a batch of workouts in a single transaction, so
+// either every workout is stored or none are
+func (pg *PostgresWorkoutStore) CreateWorkouts(ctx context.Context, workouts []*Workout) error {
+	ctx, cancel := startQuery(ctx, "CreateWorkouts")
+	defer cancel()
+
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, workout := range workouts {
+		err = insertWorkout(ctx, tx, workout)
 		if err != nil {
-			return nil, err
+			return err
 		}
 	}
 
 	err = tx.Commit()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return workout, nil
+	for _, workout := range workouts {
+		workout.localizeTimes()
+	}
+	return nil
+}
+
+func insertWorkout(ctx context.Context, tx *sql.Tx, workout *Workout) error {
+	if workout.StartedAt.IsZero() {
+		workout.StartedAt = time.Now()
+	}
+	if workout.Timezone == "" {
+		workout.Timezone = "UTC"
+	}
+
+	query := `
+	INSERT INTO workouts (user_id, title, description, duration_minutes, calories_burned, calories_estimated, started_at, ended_at, timezone)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	RETURNING id, version
+	`
+	err := tx.QueryRowContext(ctx, query, workout.UserID, workout.Title, workout.Description, workout.DurationMinutes, workout.CaloriesBurned, workout.CaloriesEstimated, workout.StartedAt, workout.EndedAt, workout.Timezone).Scan(&workout.ID, &workout.Version)
+	if err != nil {
+		return err
+	}
+
+	err = insertWorkoutEntries(ctx, tx, workout)
+	if err != nil {
+		return err
+	}
+
+	return insertWorkoutRevision(ctx, tx, workout, int64(workout.UserID))
+}
+
+// insertWorkoutEntries stores the workout's groups, entries and sets
+func insertWorkoutEntries(ctx context.Context, tx *sql.Tx, workout *Workout) error {
+	return saveWorkoutEntries(ctx, tx, workout, nil)
+}
+
+// saveWorkoutEntries stores the workout's groups and sets, and its entries.
+// Entries whose ID is in existing are updated in place so they keep their
+// ID; every other entry is inserted as a new row.
+func saveWorkoutEntries(ctx context.Context, tx *sql.Tx, workout *Workout, existing map[int]bool) error {
+	err := workout.NormalizeWeights()
+	if err != nil {
+		return err
+	}
+
+	groupIDs, err := insertEntryGroups(ctx, tx, workout)
+	if err != nil {
+		return err
+	}
+
+	for i := range workout.Entries {
+		entry := &workout.Entries[i]
+		err := entry.SummarizeSets()
+		if err != nil {
+			return err
+		}
+
+		var groupID *int
+		if entry.GroupIndex != nil {
+			if *entry.GroupIndex < 0 || *entry.GroupIndex >= len(groupIDs) {
+				return fmt.Errorf("entry %q references group %d which does not exist", entry.ExerciseName, *entry.GroupIndex)
+			}
+			groupID = &groupIDs[*entry.GroupIndex]
+		}
+		// callers are expected to have validated the entry already, anything
+		// inconsistent is rejected by the valid_workout_entry CHECK
+		entry.inferMeasurementType()
+
+		args := []interface{}{
+			workout.ID,
+			entry.ExerciseName,
+			entry.MeasurementType,
+			entry.Sets,
+			entry.Reps,
+			entry.DurationSeconds,
+			entry.Weight,
+			entry.Distance,
+			entry.DistanceUnit,
+			entry.AvgHeartRate,
+			entry.MaxHeartRate,
+			entry.ElevationGainMeters,
+			entry.Cadence,
+			entry.RPE,
+			entry.Notes,
+			entry.OrderIndex,
+			groupID,
+		}
+
+		if existing[entry.ID] {
+			query := `
+			UPDATE workout_entries
+			SET exercise_name = $2, measurement_type = $3, sets = $4, reps = $5, duration_seconds = $6, weight = $7,
+				distance = $8, distance_unit = $9, avg_heart_rate = $10, max_heart_rate = $11, elevation_gain_meters = $12,
+				cadence = $13, rpe = $14, notes = $15, order_index = $16, group_id = $17
+			WHERE workout_id = $1 AND id = $18
+			`
+			_, err = tx.ExecContext(ctx, query, append(args, entry.ID)...)
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.ExecContext(ctx, `DELETE FROM workout_sets WHERE workout_entry_id = $1`, entry.ID)
+			if err != nil {
+				return err
+			}
+		} else {
+			query := `
+			INSERT INTO workout_entries (workout_id, exercise_name, measurement_type, sets, reps, duration_seconds, weight,
+				distance, distance_unit, avg_heart_rate, max_heart_rate, elevation_gain_meters, cadence, rpe, notes, order_index, group_id)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
+			RETURNING id
+			`
+			err = tx.QueryRowContext(ctx, query, args...).Scan(&entry.ID)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = insertWorkoutSets(ctx, tx, entry)
+		if err != nil {
+			return err
+		}
+		entry.computeDerived()
+	}
+
+	for i := range workout.Groups {
+		workout.Groups[i].Entries = nil
+	}
+	for _, entry := range workout.Entries {
+		if entry.GroupIndex != nil {
+			group := &workout.Groups[*entry.GroupIndex]
+			group.Entries = append(group.Entries, entry)
+		}
+	}
+	return nil
 }
 
-func (pg *PostgresWorkoutStore) GetWorkoutByID(id int64) (*Workout, error) {
+func (pg *PostgresWorkoutStore) GetWorkoutByID(ctx context.Context, id int64) (*Workout, error) {
+	ctx, cancel := startQuery(ctx, "GetWorkoutByID")
+	defer cancel()
+
 	workout := &Workout{}
 	query := `
-	SELECT id, title, description, duration_minutes, calories_burned
+	SELECT id, user_id, title, description, duration_minutes, calories_burned, calories_estimated, started_at, ended_at, timezone, version
 	FROM workouts
-	WHERE id = $1 
+	WHERE id = $1 AND deleted_at IS NULL
 	`
-	err := pg.db.QueryRow(query, id).Scan(&workout.ID, &workout.Title, &workout.Description, &workout.DurationMinutes, &workout.CaloriesBurned)
+	err := pg.db.QueryRowContext(ctx, query, id).Scan(
+		&workout.ID,
+		&workout.UserID,
+		&workout.Title,
+		&workout.Description,
+		&workout.DurationMinutes,
+		&workout.CaloriesBurned,
+		&workout.CaloriesEstimated,
+		&workout.StartedAt,
+		&workout.EndedAt,
+		&workout.Timezone,
+		&workout.Version,
+	)
 
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -96,121 +439,360 @@ func (pg *PostgresWorkoutStore) GetWorkoutByID(id int64) (*Workout, error) {
 	if err != nil {
 		return nil, err
 	}
-	// lets get the entries
+
+	err = pg.loadWorkoutEntries(ctx, workout)
+	if err != nil {
+		return nil, err
+	}
+
+	workout.localizeTimes()
+	return workout, nil
+}
+
+func (pg *PostgresWorkoutStore) ListWorkouts(ctx context.Context, userID int64, filter WorkoutFilter) ([]Workout, error) {
+	ctx, cancel := startQuery(ctx, "ListWorkouts")
+	defer cancel()
+
+	orderBy, ok := workoutSortColumns[filter.Sort]
+	if !ok {
+		return nil, fmt.Errorf("invalid workout sort %q", filter.Sort)
+	}
+
+	query := `
+	SELECT ` + workoutColumns + `
+	FROM workouts
+	WHERE user_id = $1 AND deleted_at IS NULL
+	AND ($2::timestamptz IS NULL OR started_at >= $2)
+	AND ($3::timestamptz IS NULL OR started_at < $3)
+	ORDER BY ` + orderBy
+
+	return pg.queryWorkouts(ctx, query, userID, filter.From, filter.To)
+}
+
+// ListTrashedWorkouts returns the user's deleted workouts, most recently
+// deleted first
+func (pg *PostgresWorkoutStore) ListTrashedWorkouts(ctx context.Context, userID int64) ([]Workout, error) {
+	ctx, cancel := startQuery(ctx, "ListTrashedWorkouts")
+	defer cancel()
+
+	query := `
+	SELECT ` + workoutColumns + `
+	FROM workouts
+	WHERE user_id = $1 AND deleted_at IS NOT NULL
+	ORDER BY deleted_at DESC, id DESC
+	`
+
+	return pg.queryWorkouts(ctx, query, userID)
+}
+
+const workoutColumns = `id, user_id, title, description, duration_minutes, calories_burned, calories_estimated, started_at, ended_at, timezone, version, deleted_at`
+
+// queryWorkouts runs a query selecting workoutColumns and loads each
+// workout's entries
+func (pg *PostgresWorkoutStore) queryWorkouts(ctx context.Context, query string, args ...interface{}) ([]Workout, error) {
+	rows, err := pg.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	workouts := []Workout{}
+	for rows.Next() {
+		var workout Workout
+		err = rows.Scan(
+			&workout.ID,
+			&workout.UserID,
+			&workout.Title,
+			&workout.Description,
+			&workout.DurationMinutes,
+			&workout.CaloriesBurned,
+			&workout.CaloriesEstimated,
+			&workout.StartedAt,
+			&workout.EndedAt,
+			&workout.Timezone,
+			&workout.Version,
+			&workout.DeletedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		workouts = append(workouts, workout)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range workouts {
+		err = pg.loadWorkoutEntries(ctx, &workouts[i])
+		if err != nil {
+			return nil, err
+		}
+		workouts[i].localizeTimes()
+	}
+
+	return workouts, nil
+}
+
+// loadWorkoutEntries fills in the entries, their sets and the entry groups
+func (pg *PostgresWorkoutStore) loadWorkoutEntries(ctx context.Context, workout *Workout) error {
+	workoutID := int64(workout.ID)
 	entryQuery := `
-	SELECT id, exercise_name, sets, reps, duration_seconds, weight, notes, order_index
+	SELECT id, exercise_name, measurement_type, sets, reps, duration_seconds, weight,
+		distance, distance_unit, avg_heart_rate, max_heart_rate, elevation_gain_meters, cadence, rpe, notes, order_index, group_id
 	FROM  workout_entries
 	WHERE workout_id = $1
 	ORDER BY order_index
 	`
 
-	rows, err := pg.db.Query(entryQuery, id)
+	rows, err := pg.db.QueryContext(ctx, entryQuery, workoutID)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer rows.Close()
 
+	var entries []WorkoutEntry
+	groupIDs := map[int]int64{}
 	for rows.Next() {
 		var entry WorkoutEntry
+		var groupID sql.NullInt64
 		err = rows.Scan(
 			&entry.ID,
 			&entry.ExerciseName,
+			&entry.MeasurementType,
 			&entry.Sets,
 			&entry.Reps,
 			&entry.DurationSeconds,
 			&entry.Weight,
+			&entry.Distance,
+			&entry.DistanceUnit,
+			&entry.AvgHeartRate,
+			&entry.MaxHeartRate,
+			&entry.ElevationGainMeters,
+			&entry.Cadence,
+			&entry.RPE,
 			&entry.Notes,
 			&entry.OrderIndex,
+			&groupID,
 		)
 		if err != nil {
+			return err
+		}
+		if groupID.Valid {
+			groupIDs[entry.ID] = groupID.Int64
+		}
+		entry.WeightUnit = units.Kilograms
+		entry.computeDerived()
+		entries = append(entries, entry)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	sets, err := pg.getWorkoutSets(ctx, workoutID)
+	if err != nil {
+		return err
+	}
+	for i := range entries {
+		entries[i].SetDetails = sets[entries[i].ID]
+	}
+
+	workout.Entries = entries
+	workout.Groups, err = pg.getEntryGroups(ctx, workoutID)
+	if err != nil {
+		return err
+	}
+
+	return nestEntries(workout, groupIDs)
+}
+
+// removeDroppedEntries deletes the stored entries the workout no longer
+// lists and returns the IDs of the ones it keeps
+func removeDroppedEntries(ctx context.Context, tx *sql.Tx, workout *Workout) (map[int]bool, error) {
+	keep := map[int]bool{}
+	for _, entry := range workout.Entries {
+		if entry.ID != 0 {
+			keep[entry.ID] = true
+		}
+	}
+
+	rows, err := tx.QueryContext(ctx, `SELECT id FROM workout_entries WHERE workout_id = $1`, workout.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	existing := map[int]bool{}
+	var dropped []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
 			return nil, err
 		}
-		workout.Entries = append(workout.Entries, entry)
+		if keep[id] {
+			existing[id] = true
+		} else {
+			dropped = append(dropped, id)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
 	}
+	rows.Close()
 
-	return workout, nil
+	for _, id := range dropped {
+		_, err = tx.ExecContext(ctx, `DELETE FROM workout_entries WHERE id = $1`, id)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return existing, nil
 }
 
-func (pg *PostgresWorkoutStore) UpdateWorkout(workout *Workout) error {
-	fmt.Printf("Updating workout ID %d with %d entries\n", workout.ID, len(workout.Entries))
+// UpdateWorkout replaces the workout and its entries and records the
+// result as a new revision attributed to editorID. Entries that carry the
+// ID of one of the workout's stored entries are updated in place; the rest
+// are inserted, and stored entries not listed are deleted. A non-zero
+// workout.Version must match the stored version, or ErrVersionConflict is
+// returned; on success it holds the new version.
+func (pg *PostgresWorkoutStore) UpdateWorkout(ctx context.Context, workout *Workout, editorID int64) error {
+	ctx, cancel := startQuery(ctx, "UpdateWorkout")
+	defer cancel()
+
+	logger := logging.FromContext(ctx).With("workout_id", workout.ID)
+	logger.Debug("updating workout", "entries", len(workout.Entries), "expected_version", workout.Version)
+
+	// workouts created before revision history have no revision 1, so the
+	// state being overwritten is kept as one
+	original, err := pg.unrevisionedWorkout(ctx, int64(workout.ID))
+	if err != nil {
+		return err
+	}
 
-	tx, err := pg.db.Begin()
+	tx, err := pg.db.BeginTx(ctx, nil)
 	if err != nil {
-		fmt.Printf("Error beginning transaction: %v\n", err)
 		return err
 	}
 	defer tx.Rollback()
 
+	if workout.Timezone == "" {
+		workout.Timezone = "UTC"
+	}
+
 	query := `
 	UPDATE workouts 
-	SET title = $1, description = $2, duration_minutes = $3, calories_burned = $4
-	WHERE id = $5
+	SET title = $1, description = $2, duration_minutes = $3, calories_burned = $4, calories_estimated = $5, started_at = $6, ended_at = $7, timezone = $8,
+		version = version + 1
+	WHERE id = $9 AND deleted_at IS NULL AND ($10 = 0 OR version = $10)
+	RETURNING version
 	`
 
-	result, err := tx.Exec(query, workout.Title, workout.Description, workout.DurationMinutes, workout.CaloriesBurned, workout.ID)
+	err = tx.QueryRowContext(ctx, query, workout.Title, workout.Description, workout.DurationMinutes, workout.CaloriesBurned, workout.CaloriesEstimated, workout.StartedAt, workout.EndedAt, workout.Timezone, workout.ID, workout.Version).Scan(&workout.Version)
+	if err == sql.ErrNoRows {
+		logger.Debug("update matched no workout", "expected_version", workout.Version)
+		return pg.missingOrConflict(ctx, int64(workout.ID))
+	}
 	if err != nil {
-		fmt.Printf("Error executing update query: %v\n", err)
 		return err
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	if original != nil {
+		err = insertFirstRevision(ctx, tx, original)
+		if err != nil {
+			return err
+		}
+	}
+
+	existing, err := removeDroppedEntries(ctx, tx, workout)
 	if err != nil {
-		fmt.Printf("Error getting rows affected: %v\n", err)
 		return err
 	}
 
-	if rowsAffected == 0 {
-		fmt.Printf("No rows affected when updating workout ID %d\n", workout.ID)
-		return sql.ErrNoRows
+	_, err = tx.ExecContext(ctx, `DELETE FROM workout_entry_groups WHERE workout_id = $1`, workout.ID)
+	if err != nil {
+		return err
 	}
 
-	_, err = tx.Exec(`DELETE FROM workout_entries WHERE workout_id = $1`, workout.ID)
+	err = saveWorkoutEntries(ctx, tx, workout, existing)
 	if err != nil {
-		fmt.Printf("Error deleting existing entries: %v\n", err)
 		return err
 	}
 
-	for i, entry := range workout.Entries {
-		fmt.Printf("Adding entry %d: %s\n", i, entry.ExerciseName)
-		query := `
-		INSERT INTO workout_entries (workout_id, exercise_name, sets, reps, duration_seconds, weight, notes, order_index)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-		`
-
-		_, err = tx.Exec(query,
-			workout.ID,
-			entry.ExerciseName,
-			entry.Sets,
-			entry.Reps,
-			entry.DurationSeconds,
-			entry.Weight,
-			entry.Notes,
-			entry.OrderIndex,
-		)
-		if err != nil {
-			fmt.Printf("Error inserting entry %d: %v\n", i, err)
-			return err
-		}
+	err = insertWorkoutRevision(ctx, tx, workout, editorID)
+	if err != nil {
+		return err
 	}
 
 	err = tx.Commit()
 	if err != nil {
-		fmt.Printf("Error committing transaction: %v\n", err)
 		return err
 	}
 
-	fmt.Printf("Successfully updated workout ID %d\n", workout.ID)
+	logger.Debug("updated workout", "version", workout.Version)
+	workout.localizeTimes()
 	return nil
 }
 
-func (pg *PostgresWorkoutStore) DeleteWorkout(id int64) error {
+// DeleteWorkout moves the workout to the trash. It stays restorable until
+// PurgeDeletedWorkouts removes it for good. A non-zero version must match
+// the stored one.
+func (pg *PostgresWorkoutStore) DeleteWorkout(ctx context.Context, id int64, version int) error {
+	ctx, cancel := startQuery(ctx, "DeleteWorkout")
+	defer cancel()
+
 	query := `
-	DELETE from workouts
-	WHERE id = $1
+	UPDATE workouts
+	SET deleted_at = CURRENT_TIMESTAMP, version = version + 1
+	WHERE id = $1 AND deleted_at IS NULL AND ($2 = 0 OR version = $2)
+	`
+
+	result, err := pg.db.ExecContext(ctx, query, id, version)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return pg.missingOrConflict(ctx, id)
+	}
+	return nil
+}
+
+// GetWorkoutVersion returns the current version of a workout that is not
+// in the trash
+func (pg *PostgresWorkoutStore) GetWorkoutVersion(ctx context.Context, id int64) (int, error) {
+	ctx, cancel := startQuery(ctx, "GetWorkoutVersion")
+	defer cancel()
+
+	var version int
+	err := pg.db.QueryRowContext(ctx, `SELECT version FROM workouts WHERE id = $1 AND deleted_at IS NULL`, id).Scan(&version)
+	return version, err
+}
 
+// missingOrConflict explains why a versioned write touched no rows
+func (pg *PostgresWorkoutStore) missingOrConflict(ctx context.Context, id int64) error {
+	_, err := pg.GetWorkoutVersion(ctx, id)
+	if err != nil {
+		return err
+	}
+	return ErrVersionConflict
+
+}
+
+func (pg *PostgresWorkoutStore) RestoreWorkout(ctx context.Context, id int64) error {
+	ctx, cancel := startQuery(ctx, "RestoreWorkout")
+	defer cancel()
+
+	query := `
+	UPDATE workouts
+	SET deleted_at = NULL, version = version + 1
+	WHERE id = $1 AND deleted_at IS NOT NULL
 	`
 
-	result, err := pg.db.Exec(query, id)
+	result, err := pg.db.ExecContext(ctx, query, id)
 	if err != nil {
 		return err
 	}
@@ -224,10 +806,27 @@ func (pg *PostgresWorkoutStore) DeleteWorkout(id int64) error {
 		return sql.ErrNoRows
 	}
 	return nil
+}
 
+// PurgeDeletedWorkouts permanently removes workouts trashed before the
+// cutoff, along with their entries, and reports how many were removed
+func (pg *PostgresWorkoutStore) PurgeDeletedWorkouts(ctx context.Context, before time.Time) (int64, error) {
+	ctx, cancel := startQuery(ctx, "PurgeDeletedWorkouts")
+	defer cancel()
+
+	result, err := pg.db.ExecContext(ctx, `DELETE FROM workouts WHERE deleted_at IS NOT NULL AND deleted_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
 }
 
-func (pg *PostgresWorkoutStore) GetWorkoutOwner(id int64) (int, error) {
+// GetWorkoutOwner also sees trashed workouts, so ownership can be checked
+// before a restore
+func (pg *PostgresWorkoutStore) GetWorkoutOwner(ctx context.Context, id int64) (int, error) {
+	ctx, cancel := startQuery(ctx, "GetWorkoutOwner")
+	defer cancel()
+
 	var userID int
 	query := `
 	SELECT user_id
@@ -235,10 +834,21 @@ func (pg *PostgresWorkoutStore) GetWorkoutOwner(id int64) (int, error) {
 	WHERE id = $1
 	`
 
-	err := pg.db.QueryRow(query, id).Scan(&userID)
+	err := pg.db.QueryRowContext(ctx, query, id).Scan(&userID)
 	if err != nil {
 		return 0, err
 	}
 
 	return userID, nil
 }
+
+// RenumberEntries sorts entries by order_index, keeping the current order
+// for ties, and renumbers them 1..n so the sequence has no gaps
+func (w *Workout) RenumberEntries() {
+	sort.SliceStable(w.Entries, func(i, j int) bool {
+		return w.Entries[i].OrderIndex < w.Entries[j].OrderIndex
+	})
+	for i := range w.Entries {
+		w.Entries[i].OrderIndex = i + 1
+	}
+}
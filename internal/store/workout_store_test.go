@@ -1,6 +1,7 @@
 package store
 
 import (
+	"context"
 	"database/sql"
 
 	"testing"
@@ -92,7 +93,7 @@ func TestCreateWorkout(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			createdWorkout, err := store.CreateWorkout(tt.workout)
+			createdWorkout, err := store.CreateWorkout(context.Background(), tt.workout)
 			if tt.wantErr {
 				assert.Error(t, err)
 				return
@@ -102,7 +103,7 @@ func TestCreateWorkout(t *testing.T) {
 			assert.Equal(t, tt.workout.Description, createdWorkout.Description)
 			assert.Equal(t, tt.workout.DurationMinutes, createdWorkout.DurationMinutes)
 
-			retrieved, err := store.GetWorkoutByID(int64(createdWorkout.ID))
+			retrieved, err := store.GetWorkoutByID(context.Background(), int64(createdWorkout.ID))
 			require.NoError(t, err)
 
 			assert.Equal(t, createdWorkout.ID, retrieved.ID)
@@ -117,6 +118,24 @@ func TestCreateWorkout(t *testing.T) {
 	}
 }
 
+func TestRenumberEntries(t *testing.T) {
+	w := &Workout{Entries: []WorkoutEntry{
+		{ID: 1, ExerciseName: "squat", OrderIndex: 5},
+		{ID: 2, ExerciseName: "lunge", OrderIndex: 2},
+		{ID: 3, ExerciseName: "deadlift", OrderIndex: 5},
+	}}
+
+	w.RenumberEntries()
+
+	var ids, order []int
+	for _, e := range w.Entries {
+		ids = append(ids, e.ID)
+		order = append(order, e.OrderIndex)
+	}
+	assert.Equal(t, []int{2, 1, 3}, ids)
+	assert.Equal(t, []int{1, 2, 3}, order)
+}
+
 func IntPtr(i int) *int {
 	return &i
 }
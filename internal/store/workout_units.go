@@ -0,0 +1,71 @@
+package store
+
+import (
+	"fmt"
+
+	"github.com/cykj40/beginner_go/internal/units"
+)
+
+// NormalizeWeights converts entry and set weights from the unit the client
+// sent them in to kilograms, the unit they are stored in
+func (w *Workout) NormalizeWeights() error {
+	for i := range w.Entries {
+		entry := &w.Entries[i]
+		unit := entry.WeightUnit
+		if unit == "" {
+			unit = units.Kilograms
+		}
+		if !units.ValidWeightUnit(unit) {
+			return fmt.Errorf("entries[%d]: weight_unit must be kg or lb", i)
+		}
+
+		entry.Weight = toKilograms(entry.Weight, unit)
+		for j := range entry.SetDetails {
+			entry.SetDetails[j].Weight = toKilograms(entry.SetDetails[j].Weight, unit)
+		}
+		entry.WeightUnit = units.Kilograms
+	}
+	return nil
+}
+
+// ConvertWeights expresses every stored (kilogram) weight in unit
+func (w *Workout) ConvertWeights(unit string) {
+	if unit == "" {
+		unit = units.Kilograms
+	}
+	for i := range w.Entries {
+		w.Entries[i].convertWeights(unit)
+	}
+	for i := range w.Groups {
+		for j := range w.Groups[i].Entries {
+			w.Groups[i].Entries[j].convertWeights(unit)
+		}
+	}
+}
+
+func (e *WorkoutEntry) convertWeights(unit string) {
+	if e.WeightUnit == unit {
+		return
+	}
+	e.Weight = fromKilograms(e.Weight, unit)
+	for i := range e.SetDetails {
+		e.SetDetails[i].Weight = fromKilograms(e.SetDetails[i].Weight, unit)
+	}
+	e.WeightUnit = unit
+}
+
+func toKilograms(weight *float64, unit string) *float64 {
+	if weight == nil {
+		return nil
+	}
+	kg, _ := units.ToKilograms(*weight, unit)
+	return &kg
+}
+
+func fromKilograms(weight *float64, unit string) *float64 {
+	if weight == nil {
+		return nil
+	}
+	converted := units.FromKilograms(*weight, unit)
+	return &converted
+}
@@ -0,0 +1,64 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cykj40/beginner_go/internal/config"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestMiddleware(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	_, err := Setup(context.Background(), config.Tracing{Exporter: "none"})
+	require.NoError(t, err)
+
+	r := chi.NewRouter()
+	r.Use(Middleware)
+	r.Get("/workouts/{id}", func(w http.ResponseWriter, r *http.Request) {
+		_, span := Tracer().Start(r.Context(), "store.GetWorkoutByID")
+		span.End()
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/workouts/7", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	store, server := spans[0], spans[1]
+
+	assert.Equal(t, "GET /workouts/{id}", server.Name())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", server.Parent().SpanID().String())
+	assert.Equal(t, server.SpanContext().SpanID(), store.Parent().SpanID())
+}
+
+func TestSetupFileExporter(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "spans.json")
+	shutdown, err := Setup(context.Background(), config.Tracing{
+		Exporter:    "file",
+		File:        file,
+		SampleRatio: 1,
+		ServiceName: "test",
+	})
+	require.NoError(t, err)
+
+	_, span := Tracer().Start(context.Background(), "store.CreateWorkout")
+	span.End()
+	require.NoError(t, shutdown(context.Background()))
+
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"Name":"store.CreateWorkout"`)
+}
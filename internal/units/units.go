@@ -0,0 +1,77 @@
+package units
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	Kilograms = "kg"
+	Pounds    = "lb"
+
+	poundsPerKilogram = 2.2046226218
+)
+
+func ValidWeightUnit(unit string) bool {
+	return unit == Kilograms || unit == Pounds
+}
+
+// ToKilograms converts a weight in unit to the canonical kilograms it is stored in
+func ToKilograms(value float64, unit string) (float64, error) {
+	switch unit {
+	case Kilograms, "":
+		return value, nil
+	case Pounds:
+		return value / poundsPerKilogram, nil
+	}
+	return 0, fmt.Errorf("unknown weight unit %q, expected kg or lb", unit)
+}
+
+// FromKilograms converts a stored weight for display, rounded to 2 decimals
+func FromKilograms(kg float64, unit string) float64 {
+	value := kg
+	if unit == Pounds {
+		value = kg * poundsPerKilogram
+	}
+	return math.Round(value*100) / 100
+}
+
+const (
+	Centimeters = "cm"
+	Inches      = "in"
+	Percent     = "%"
+
+	centimetersPerInch = 2.54
+)
+
+func ValidLengthUnit(unit string) bool {
+	return unit == Centimeters || unit == Inches
+}
+
+// ToCentimeters converts a length in unit to the canonical centimeters it is stored in
+func ToCentimeters(value float64, unit string) (float64, error) {
+	switch unit {
+	case Centimeters, "":
+		return value, nil
+	case Inches:
+		return value * centimetersPerInch, nil
+	}
+	return 0, fmt.Errorf("unknown length unit %q, expected cm or in", unit)
+}
+
+// FromCentimeters converts a stored length for display, rounded to 2 decimals
+func FromCentimeters(cm float64, unit string) float64 {
+	value := cm
+	if unit == Inches {
+		value = cm / centimetersPerInch
+	}
+	return math.Round(value*100) / 100
+}
+
+// LengthUnitFor pairs a weight unit with the length unit of the same system
+func LengthUnitFor(weightUnit string) string {
+	if weightUnit == Pounds {
+		return Inches
+	}
+	return Centimeters
+}
@@ -0,0 +1,108 @@
+// Package validator collects every problem with a request at once, keyed
+// by the JSON path of the offending field, so clients can show them all.
+package validator
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+var EmailRX = regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
+
+// Validator maps field paths such as "entries[0].reps" to their messages.
+// It satisfies error, so validation functions can return it directly.
+type Validator struct {
+	Errors map[string][]string
+	prefix string
+}
+
+func New() *Validator {
+	return &Validator{Errors: map[string][]string{}}
+}
+
+// Scope returns a validator that records into the same errors with prefix
+// prepended to every field, for validating nested objects
+func (v *Validator) Scope(prefix string) *Validator {
+	return &Validator{Errors: v.Errors, prefix: v.prefix + prefix}
+}
+
+func (v *Validator) Valid() bool {
+	return len(v.Errors) == 0
+}
+
+// Has reports whether field, relative to the scope, already has an error
+func (v *Validator) Has(field string) bool {
+	_, ok := v.Errors[v.prefix+field]
+	return ok
+}
+
+// HasPrefix reports whether anything in this scope has an error
+func (v *Validator) HasPrefix() bool {
+	for field := range v.Errors {
+		if strings.HasPrefix(field, v.prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *Validator) Add(field, message string) {
+	field = v.prefix + field
+	v.Errors[field] = append(v.Errors[field], message)
+}
+
+func (v *Validator) Check(ok bool, field, message string) {
+	if !ok {
+		v.Add(field, message)
+	}
+}
+
+// Err returns the validator as an error when it recorded anything, and nil
+// otherwise
+func (v *Validator) Err() error {
+	if v.Valid() {
+		return nil
+	}
+	return v
+}
+
+func (v *Validator) Error() string {
+	fields := make([]string, 0, len(v.Errors))
+	for field := range v.Errors {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	parts := make([]string, 0, len(fields))
+	for _, field := range fields {
+		parts = append(parts, field+": "+strings.Join(v.Errors[field], ", "))
+	}
+	return strings.Join(parts, "; ")
+}
+
+func NotBlank(value string) bool {
+	return strings.TrimSpace(value) != ""
+}
+
+func MaxChars(value string, n int) bool {
+	return utf8.RuneCountInString(value) <= n
+}
+
+func Matches(value string, rx *regexp.Regexp) bool {
+	return rx.MatchString(value)
+}
+
+func PermittedValue[T comparable](value T, permitted ...T) bool {
+	for _, p := range permitted {
+		if value == p {
+			return true
+		}
+	}
+	return false
+}
+
+func Between[T int | float64](value, min, max T) bool {
+	return value >= min && value <= max
+}
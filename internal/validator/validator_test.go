@@ -0,0 +1,41 @@
+package validator
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidator(t *testing.T) {
+	v := New()
+	v.Check(NotBlank(" "), "title", "title is required")
+
+	entry := v.Scope("entries[0].")
+	entry.Check(Between(-1, 0, 10), "sets", "sets cannot be negative")
+	entry.Check(PermittedValue("st", "kg", "lb"), "weight_unit", "weight_unit must be kg or lb")
+	entry.Check(Between(0, 0, 10), "reps", "never recorded")
+
+	assert.False(t, v.Valid())
+	assert.True(t, entry.HasPrefix())
+	assert.False(t, v.Scope("entries[1].").HasPrefix())
+	assert.True(t, entry.Has("sets"))
+	assert.Equal(t, map[string][]string{
+		"title":                  {"title is required"},
+		"entries[0].sets":        {"sets cannot be negative"},
+		"entries[0].weight_unit": {"weight_unit must be kg or lb"},
+	}, v.Errors)
+
+	var verr *Validator
+	assert.True(t, errors.As(v.Err(), &verr))
+	assert.Equal(t, "entries[0].sets: sets cannot be negative; entries[0].weight_unit: weight_unit must be kg or lb; title: title is required", v.Error())
+}
+
+func TestValidNilErr(t *testing.T) {
+	assert.NoError(t, New().Err())
+}
+
+func TestEmailRX(t *testing.T) {
+	assert.True(t, Matches("jane@example.com", EmailRX))
+	assert.False(t, Matches("jane@example", EmailRX))
+}
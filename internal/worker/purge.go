@@ -0,0 +1,88 @@
+// Package worker holds the background jobs that run alongside the API.
+package worker
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+// TrashStore is the part of the workout store the purger needs
+type TrashStore interface {
+	PurgeDeletedWorkouts(ctx context.Context, before time.Time) (int64, error)
+}
+
+// TrashPurger periodically removes workouts that have been in the trash for
+// longer than the retention period
+type TrashPurger struct {
+	store     TrashStore
+	retention time.Duration
+	interval  time.Duration
+	logger    *slog.Logger
+	now       func() time.Time
+	// lastSuccess only moves on passes that succeed, so a purger that keeps
+	// failing goes stale in /readyz just like one that stopped running
+	lastSuccess atomic.Int64
+}
+
+func NewTrashPurger(store TrashStore, retention, interval time.Duration, logger *slog.Logger) *TrashPurger {
+	return &TrashPurger{
+		store:     store,
+		retention: retention,
+		interval:  interval,
+		logger:    logger,
+		now:       time.Now,
+	}
+}
+
+func (p *TrashPurger) Retention() time.Duration {
+	return p.retention
+}
+
+func (p *TrashPurger) Interval() time.Duration {
+	return p.interval
+}
+
+// LastSuccess is when the purger last finished a pass without error, zero
+// before the first
+func (p *TrashPurger) LastSuccess() time.Time {
+	nanos := p.lastSuccess.Load()
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
+
+// PurgeOnce removes everything trashed before now minus the retention period
+func (p *TrashPurger) PurgeOnce(ctx context.Context) (int64, error) {
+	return p.store.PurgeDeletedWorkouts(ctx, p.now().Add(-p.retention))
+}
+
+// Run purges once immediately and then on every interval until ctx is done
+func (p *TrashPurger) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := p.PurgeOnce(ctx)
+		if err != nil && ctx.Err() != nil {
+			// shutting down mid-purge; the next run picks up the rest
+			return
+		}
+		if err != nil {
+			p.logger.Error("purgeDeletedWorkouts", "error", err)
+		} else {
+			if purged > 0 {
+				p.logger.Info("purged workouts from the trash", "count", purged)
+			}
+			p.lastSuccess.Store(p.now().UnixNano())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
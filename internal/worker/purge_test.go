@@ -0,0 +1,66 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeTrashStore struct {
+	cutoffs []time.Time
+}
+
+func (f *fakeTrashStore) PurgeDeletedWorkouts(ctx context.Context, before time.Time) (int64, error) {
+	f.cutoffs = append(f.cutoffs, before)
+	return 1, nil
+}
+
+type failingTrashStore struct {
+	calls chan struct{}
+}
+
+func (f *failingTrashStore) PurgeDeletedWorkouts(ctx context.Context, before time.Time) (int64, error) {
+	f.calls <- struct{}{}
+	return 0, errors.New("connection refused")
+}
+
+func TestTrashPurger(t *testing.T) {
+	store := &fakeTrashStore{}
+	purger := NewTrashPurger(store, 30*24*time.Hour, time.Hour, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	now := time.Date(2025, 3, 31, 12, 0, 0, 0, time.UTC)
+	purger.now = func() time.Time { return now }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	purger.Run(ctx)
+
+	require.Len(t, store.cutoffs, 1)
+	assert.Equal(t, now, purger.LastSuccess().UTC())
+	assert.Equal(t, time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC), store.cutoffs[0])
+}
+
+func TestTrashPurgerFailureKeepsHeartbeat(t *testing.T) {
+	store := &failingTrashStore{calls: make(chan struct{}, 100)}
+	purger := NewTrashPurger(store, 30*24*time.Hour, time.Millisecond, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		purger.Run(ctx)
+		close(done)
+	}()
+
+	// the second call means the first failed pass has been fully handled
+	<-store.calls
+	<-store.calls
+	cancel()
+	<-done
+
+	assert.True(t, purger.LastSuccess().IsZero())
+}
@@ -0,0 +1,421 @@
+package workoutcsv
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cykj40/beginner_go/internal/store"
+	"github.com/cykj40/beginner_go/internal/units"
+)
+
+// Columns is the canonical column layout used for export, and the field
+// names a column mapping refers to on import
+var Columns = []string{
+	"workout_id",
+	"title",
+	"description",
+	"started_at",
+	"ended_at",
+	"timezone",
+	"duration_minutes",
+	"calories_burned",
+	"entry_id",
+	"exercise_name",
+	"measurement_type",
+	"sets",
+	"reps",
+	"duration_seconds",
+	"weight",
+	"weight_unit",
+	"distance",
+	"distance_unit",
+	"avg_heart_rate",
+	"max_heart_rate",
+	"elevation_gain_meters",
+	"cadence",
+	"rpe",
+	"notes",
+	"order_index",
+}
+
+// Export writes one row per workout entry with the workout columns
+// repeated on every row. Workouts without entries get a single row.
+// Weights are written in whatever unit the workouts were converted to.
+func Export(w io.Writer, workouts []store.Workout) error {
+	cw := csv.NewWriter(w)
+	err := cw.Write(Columns)
+	if err != nil {
+		return err
+	}
+
+	for _, workout := range workouts {
+		workoutCols := []string{
+			strconv.Itoa(workout.ID),
+			workout.Title,
+			workout.Description,
+			workout.StartedAt.Format(time.RFC3339),
+			formatTimePtr(workout.EndedAt),
+			workout.Timezone,
+			strconv.Itoa(workout.DurationMinutes),
+			strconv.Itoa(workout.CaloriesBurned),
+		}
+
+		if len(workout.Entries) == 0 {
+			err = cw.Write(append(workoutCols, make([]string, len(Columns)-len(workoutCols))...))
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		for _, entry := range workout.Entries {
+			row := append([]string{}, workoutCols...)
+			row = append(row,
+				strconv.Itoa(entry.ID),
+				entry.ExerciseName,
+				entry.MeasurementType,
+				strconv.Itoa(entry.Sets),
+				formatIntPtr(entry.Reps),
+				formatIntPtr(entry.DurationSeconds),
+				formatFloatPtr(entry.Weight),
+				entry.WeightUnit,
+				formatFloatPtr(entry.Distance),
+				formatStringPtr(entry.DistanceUnit),
+				formatIntPtr(entry.AvgHeartRate),
+				formatIntPtr(entry.MaxHeartRate),
+				formatFloatPtr(entry.ElevationGainMeters),
+				formatIntPtr(entry.Cadence),
+				formatFloatPtr(entry.RPE),
+				formatStringPtr(entry.Notes),
+				strconv.Itoa(entry.OrderIndex),
+			)
+			err = cw.Write(row)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// RowError reports a problem with a single CSV row. Rows are numbered the
+// way a spreadsheet shows them, so the header is row 1.
+type RowError struct {
+	Row     int    `json:"row"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e RowError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("row %d: %s", e.Row, e.Message)
+	}
+	return fmt.Sprintf("row %d: %s: %s", e.Row, e.Field, e.Message)
+}
+
+// ParsedWorkout is a workout assembled from one or more CSV rows
+type ParsedWorkout struct {
+	Row     int
+	Workout *store.Workout
+}
+
+// Import reads workouts from CSV. mapping translates canonical field names
+// to the header names used in the file; unmapped fields are looked up by
+// their canonical name. Rows sharing a workout_id, or when that column is
+// absent the same title and started_at, are grouped into one workout.
+// Problems with individual rows are collected rather than aborting.
+func Import(r io.Reader, mapping map[string]string) ([]ParsedWorkout, []RowError, error) {
+	for field := range mapping {
+		if !isColumn(field) {
+			return nil, nil, fmt.Errorf("unknown field %q in column mapping", field)
+		}
+	}
+
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, nil, errors.New("csv is empty")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	index := map[string]int{}
+	for i, name := range header {
+		index[strings.TrimSpace(name)] = i
+	}
+
+	columns := map[string]int{}
+	for _, field := range Columns {
+		name := field
+		if mapped, ok := mapping[field]; ok {
+			name = mapped
+		}
+		if i, ok := index[name]; ok {
+			columns[field] = i
+		}
+	}
+
+	for _, required := range []string{"title"} {
+		if _, ok := columns[required]; !ok {
+			return nil, nil, fmt.Errorf("csv is missing the %s column", required)
+		}
+	}
+
+	var parsed []ParsedWorkout
+	var rowErrors []RowError
+	byKey := map[string]int{}
+
+	for rowNum := 2; ; rowNum++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				rowErrors = append(rowErrors, RowError{Row: rowNum, Message: parseErr.Err.Error()})
+				continue
+			}
+			return nil, nil, err
+		}
+
+		row := rowReader{record: record, columns: columns, rowNum: rowNum}
+		workout := row.workout()
+		entry := row.entry()
+		if len(row.errors) > 0 {
+			rowErrors = append(rowErrors, row.errors...)
+			continue
+		}
+
+		key := row.get("workout_id")
+		if key == "" {
+			key = workout.Title + "|" + row.get("started_at")
+		}
+
+		i, seen := byKey[key]
+		if !seen {
+			i = len(parsed)
+			byKey[key] = i
+			parsed = append(parsed, ParsedWorkout{Row: rowNum, Workout: workout})
+		}
+
+		if entry != nil {
+			current := parsed[i].Workout
+			if entry.OrderIndex == 0 {
+				entry.OrderIndex = len(current.Entries) + 1
+			}
+			current.Entries = append(current.Entries, *entry)
+		}
+	}
+
+	return parsed, rowErrors, nil
+}
+
+func isColumn(field string) bool {
+	for _, c := range Columns {
+		if c == field {
+			return true
+		}
+	}
+	return false
+}
+
+type rowReader struct {
+	record  []string
+	columns map[string]int
+	rowNum  int
+	errors  []RowError
+}
+
+func (rr *rowReader) get(field string) string {
+	i, ok := rr.columns[field]
+	if !ok || i >= len(rr.record) {
+		return ""
+	}
+	return strings.TrimSpace(rr.record[i])
+}
+
+func (rr *rowReader) fail(field, message string) {
+	rr.errors = append(rr.errors, RowError{Row: rr.rowNum, Field: field, Message: message})
+}
+
+func (rr *rowReader) parseInt(field string) *int {
+	value := rr.get(field)
+	if value == "" {
+		return nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		rr.fail(field, "must be a whole number")
+		return nil
+	}
+	if n < 0 {
+		rr.fail(field, "cannot be negative")
+		return nil
+	}
+	return &n
+}
+
+func (rr *rowReader) parseFloat(field string) *float64 {
+	value := rr.get(field)
+	if value == "" {
+		return nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		rr.fail(field, "must be a number")
+		return nil
+	}
+	if f < 0 {
+		rr.fail(field, "cannot be negative")
+		return nil
+	}
+	return &f
+}
+
+var timeLayouts = []string{
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// parseTime parses RFC 3339 timestamps, or local timestamps interpreted in the
+// row's timezone
+func (rr *rowReader) parseTime(field string, loc *time.Location) *time.Time {
+	value := rr.get(field)
+	if value == "" {
+		return nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return &t
+		}
+	}
+	rr.fail(field, "must be an RFC 3339 timestamp or YYYY-MM-DD [HH:MM[:SS]]")
+	return nil
+}
+
+func (rr *rowReader) workout() *store.Workout {
+	workout := &store.Workout{
+		Title:       rr.get("title"),
+		Description: rr.get("description"),
+		Timezone:    rr.get("timezone"),
+	}
+	if workout.Title == "" {
+		rr.fail("title", "is required")
+	}
+
+	loc := time.UTC
+	if workout.Timezone != "" {
+		var err error
+		loc, err = time.LoadLocation(workout.Timezone)
+		if err != nil {
+			rr.fail("timezone", "must be a valid IANA timezone name")
+			loc = time.UTC
+		}
+	}
+
+	if startedAt := rr.parseTime("started_at", loc); startedAt != nil {
+		workout.StartedAt = *startedAt
+	}
+	workout.EndedAt = rr.parseTime("ended_at", loc)
+	if duration := rr.parseInt("duration_minutes"); duration != nil {
+		workout.DurationMinutes = *duration
+	}
+	// a blank calories_burned is left to be estimated
+	if calories := rr.parseInt("calories_burned"); calories != nil {
+		workout.CaloriesBurned = *calories
+	} else {
+		workout.CaloriesEstimated = true
+	}
+
+	return workout
+}
+
+// entry returns nil for rows that only describe a workout
+func (rr *rowReader) entry() *store.WorkoutEntry {
+	name := rr.get("exercise_name")
+	if name == "" {
+		return nil
+	}
+
+	entry := &store.WorkoutEntry{
+		ExerciseName:        name,
+		MeasurementType:     rr.get("measurement_type"),
+		Reps:                rr.parseInt("reps"),
+		DurationSeconds:     rr.parseInt("duration_seconds"),
+		Weight:              rr.parseFloat("weight"),
+		WeightUnit:          rr.get("weight_unit"),
+		Distance:            rr.parseFloat("distance"),
+		AvgHeartRate:        rr.parseInt("avg_heart_rate"),
+		MaxHeartRate:        rr.parseInt("max_heart_rate"),
+		ElevationGainMeters: rr.parseFloat("elevation_gain_meters"),
+		Cadence:             rr.parseInt("cadence"),
+		RPE:                 rr.parseFloat("rpe"),
+	}
+	if unit := rr.get("distance_unit"); unit != "" {
+		entry.DistanceUnit = &unit
+	}
+	if sets := rr.parseInt("sets"); sets != nil {
+		entry.Sets = *sets
+	}
+	if orderIndex := rr.parseInt("order_index"); orderIndex != nil {
+		entry.OrderIndex = *orderIndex
+	}
+	if notes := rr.get("notes"); notes != "" {
+		entry.Notes = &notes
+	}
+
+	if entry.WeightUnit != "" && !units.ValidWeightUnit(entry.WeightUnit) {
+		rr.fail("weight_unit", "must be kg or lb")
+	}
+
+	err := entry.ResolveMeasurementType()
+	if err != nil {
+		rr.fail("measurement_type", err.Error())
+	}
+
+	return entry
+}
+
+func formatTimePtr(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+func formatIntPtr(n *int) string {
+	if n == nil {
+		return ""
+	}
+	return strconv.Itoa(*n)
+}
+
+func formatFloatPtr(f *float64) string {
+	if f == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*f, 'f', -1, 64)
+}
+
+func formatStringPtr(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
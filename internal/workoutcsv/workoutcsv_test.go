@@ -0,0 +1,92 @@
+package workoutcsv
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cykj40/beginner_go/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportImportRoundTrip(t *testing.T) {
+	started := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	workouts := []store.Workout{
+		{
+			ID:              7,
+			Title:           "push day",
+			Description:     "upper body, heavy",
+			StartedAt:       started,
+			Timezone:        "UTC",
+			DurationMinutes: 60,
+			CaloriesBurned:  300,
+			Entries: []store.WorkoutEntry{
+				{ExerciseName: "bench press", Sets: 3, Reps: intPtr(10), Weight: floatPtr(135.5), OrderIndex: 1},
+				{ExerciseName: "plank", Sets: 3, DurationSeconds: intPtr(60), OrderIndex: 2},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, Export(&buf, workouts))
+
+	parsed, rowErrors, err := Import(&buf, nil)
+	require.NoError(t, err)
+	require.Empty(t, rowErrors)
+	require.Len(t, parsed, 1)
+
+	got := parsed[0].Workout
+	assert.Equal(t, 2, parsed[0].Row)
+	assert.Equal(t, "push day", got.Title)
+	assert.Equal(t, "upper body, heavy", got.Description)
+	assert.True(t, started.Equal(got.StartedAt))
+	require.Len(t, got.Entries, 2)
+	assert.Equal(t, 10, *got.Entries[0].Reps)
+	assert.Equal(t, 135.5, *got.Entries[0].Weight)
+	assert.Equal(t, 60, *got.Entries[1].DurationSeconds)
+}
+
+func TestImportWithMappingAndRowErrors(t *testing.T) {
+	input := strings.Join([]string{
+		"Workout,Date,Exercise,Sets,Reps,Seconds",
+		"legs,2025-03-02,squat,5,5,",
+		"legs,2025-03-02,wall sit,3,,45",
+		"legs,2025-03-02,lunge,three,10,",
+		"arms,2025-03-03,curl,3,10,30",
+	}, "\n")
+
+	mapping := map[string]string{
+		"title":            "Workout",
+		"started_at":       "Date",
+		"exercise_name":    "Exercise",
+		"reps":             "Reps",
+		"duration_seconds": "Seconds",
+		"sets":             "Sets",
+	}
+
+	parsed, rowErrors, err := Import(strings.NewReader(input), mapping)
+	require.NoError(t, err)
+
+	require.Len(t, parsed, 1)
+	assert.Len(t, parsed[0].Workout.Entries, 2)
+	assert.Equal(t, 2, parsed[0].Workout.Entries[1].OrderIndex)
+
+	require.Len(t, rowErrors, 2)
+	assert.Equal(t, RowError{Row: 4, Field: "sets", Message: "must be a whole number"}, rowErrors[0])
+	assert.Equal(t, 5, rowErrors[1].Row)
+}
+
+func TestImportRejectsUnknownMappingField(t *testing.T) {
+	_, _, err := Import(strings.NewReader("title\nx\n"), map[string]string{"name": "title"})
+	assert.Error(t, err)
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func floatPtr(f float64) *float64 {
+	return &f
+}
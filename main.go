@@ -1,50 +1,159 @@
 package main
 
 import (
-	"flag"
+	"context"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
+	_ "time/tzdata"
 
 	"github.com/cykj40/beginner_go/internal/app"
+	"github.com/cykj40/beginner_go/internal/config"
+	"github.com/cykj40/beginner_go/internal/logging"
 	"github.com/cykj40/beginner_go/internal/routes"
+	"github.com/cykj40/beginner_go/internal/tracing"
+	"github.com/go-chi/chi/v5"
 )
 
 func main() {
-	var port int
-	flag.IntVar(&port, "port", 8080, "port to start the server on")
-	flag.Parse()
+	if len(os.Args) > 2 && os.Args[1] == "config" && os.Args[2] == "print" {
+		printConfig(os.Args[3:])
+		return
+	}
+
+	cfg, err := config.Load(os.Args[1:], os.Getenv)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	logger := logging.New(cfg.Log, os.Stdout)
+	slog.SetDefault(logger)
+
+	logger.Info("starting application")
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		logger.Error("failed to set up tracing", "error", err)
+		os.Exit(1)
+	}
 
-	log.Println("Starting application...")
-	app, err := app.NewApplication()
+	app, err := app.NewApplication(cfg, logger)
 	if err != nil {
-		log.Fatalf("Failed to create application: %v", err)
+		logger.Error("failed to create application", "error", err)
+		os.Exit(1)
 	}
 
-	log.Println("Setting up routes...")
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	var workers sync.WaitGroup
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		app.TrashPurger.Run(workerCtx)
+	}()
+
 	r := routes.SetupRoutes(app)
 
 	server := &http.Server{
-		Addr:         fmt.Sprintf(":%d", port),
+		Addr:         fmt.Sprintf(":%d", cfg.Server.Port),
 		Handler:      r,
-		IdleTimeout:  time.Minute,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 30 * time.Second,
+		IdleTimeout:  cfg.Server.IdleTimeout,
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
+	}
+
+	chi.Walk(r, func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		logger.Debug("route", "method", method, "pattern", route)
+		return nil
+	})
+	logger.Info("server starting", "port", cfg.Server.Port)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serverErr := make(chan error, 2)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+
+	var adminServer *http.Server
+	if adminRoutes := routes.SetupAdminRoutes(app); adminRoutes != nil {
+		adminServer = &http.Server{
+			Addr:        fmt.Sprintf(":%d", cfg.Metrics.AdminPort),
+			Handler:     adminRoutes,
+			ReadTimeout: cfg.Server.ReadTimeout,
+			IdleTimeout: cfg.Server.IdleTimeout,
+		}
+		logger.Info("admin server starting", "port", cfg.Metrics.AdminPort)
+		go func() {
+			serverErr <- adminServer.ListenAndServe()
+		}()
+	}
+	app.SetReady(true)
+
+	select {
+	case err = <-serverErr:
+		logger.Error("server failed to start", "error", err)
+		os.Exit(1)
+	case <-ctx.Done():
 	}
+	stop()
 
-	log.Printf("Server starting on port %d", port)
-	log.Printf("Available endpoints:")
-	log.Printf("  POST /users/register")
-	log.Printf("  POST /users/login")
-	log.Printf("  GET  /health")
-	log.Printf("  GET  /workouts/{id}")
-	log.Printf("  POST /workouts")
-	log.Printf("  PUT  /workouts/{id}")
-	log.Printf("  DELETE /workouts/{id}")
+	// stop advertising readiness first and keep serving for the grace
+	// period, so probes see /readyz fail and load balancers move traffic
+	// away while the port is still open. Then let in-flight requests
+	// finish before anything they depend on goes away. A second signal
+	// kills the process, since stop() restored the default handling.
+	logger.Info("shutting down, failing readiness", "readiness_grace", cfg.Server.ReadinessGrace)
+	app.SetReady(false)
+	time.Sleep(cfg.Server.ReadinessGrace)
 
-	err = server.ListenAndServe()
+	logger.Info("draining requests", "drain_timeout", cfg.Server.DrainTimeout)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.DrainTimeout)
+	defer cancel()
+	err = server.Shutdown(shutdownCtx)
+	if err != nil {
+		logger.Warn("forcing shutdown", "error", err)
+		server.Close()
+	}
+	if adminServer != nil {
+		adminServer.Close()
+	}
+
+	stopWorkers()
+	workers.Wait()
+
+	err = app.Close()
+	if err != nil {
+		logger.Error("closing database", "error", err)
+	}
+
+	// spans are batched, so the last few are only sent on flush. The drain
+	// may have used up shutdownCtx, so the flush gets its own deadline.
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFlush()
+	err = shutdownTracing(flushCtx)
+	if err != nil {
+		logger.Error("flushing traces", "error", err)
+	}
+	logger.Info("shutdown complete")
+}
+
+// printConfig prints the configuration the server would start with, with
+// secrets redacted
+func printConfig(args []string) {
+	cfg, err := config.Load(args, os.Getenv)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	out, err := cfg.Print()
 	if err != nil {
-		log.Fatalf("Server failed to start: %v", err)
+		log.Fatalf("Failed to print configuration: %v", err)
 	}
+	os.Stdout.Write(out)
 }